@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,13 +15,16 @@ import (
 	_ "github.com/antoniofmoliveira/apis/docs"
 	"github.com/antoniofmoliveira/apis/internal/entity"
 	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/antoniofmoliveira/apis/internal/infra/database/bootstrap"
+	"github.com/antoniofmoliveira/apis/internal/infra/database/migrations"
+	"github.com/antoniofmoliveira/apis/internal/infra/mail"
 	"github.com/antoniofmoliveira/apis/internal/infra/webserver/handlers"
+	"github.com/antoniofmoliveira/apis/internal/infra/webserver/middlewares"
+	"github.com/antoniofmoliveira/apis/pkg/ratelimit"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/jwtauth"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"golang.org/x/exp/slog"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
 )
 
 // @title         API
@@ -41,53 +46,243 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	db, err := bootstrap.Open(bootstrap.Config{
+		Driver:   cfg.DBDriver,
+		Host:     cfg.DBHost,
+		Port:     cfg.DBPort,
+		User:     cfg.DBUser,
+		Password: cfg.DBPassword,
+		Name:     cfg.DBName,
+		SSLMode:  cfg.DBSSLMode,
+	})
 	if err != nil {
-		panic("failed to connect database")
+		panic(err)
 	}
 
-	db.AutoMigrate(&entity.Product{}, &entity.User{})
+	migrator := migrations.NewMigrator(db, migrations.All(cfg.DefaultCurrency))
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(migrator, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if _, err := migrator.Up(); err != nil {
+		panic(err)
+	}
+
+	pagination := handlers.Pagination{
+		DefaultLimit: cfg.PageDefaultLimit,
+		MaxLimit:     cfg.PageMaxLimit,
+		Envelope:     cfg.PageEnvelope,
+	}
+	auditDB := database.NewAuditRepository(db)
+	auditor := handlers.NewAuditor(auditDB)
+	auditHandler := handlers.NewAuditHandler(auditDB, pagination)
 
 	productDB := database.NewProductRepository(db)
-	productHandler := handlers.NewProductHandler(productDB)
+	productHandler := handlers.NewProductHandler(productDB, pagination, cfg.DefaultCurrency, auditor)
+	stockDB := database.NewStockRepository(db)
+	stockHandler := handlers.NewStockHandler(stockDB, productDB, time.Duration(cfg.ReservationExpiresIn)*time.Second, auditor)
+	batchHandler := handlers.NewBatchHandler(database.NewUnitOfWork(db), cfg.DefaultCurrency, auditor)
+	idempotencyDB := database.NewIdempotencyRepository(db)
+	categoryDB := database.NewCategoryRepository(db)
+	tagDB := database.NewTagRepository(db)
+	categoryHandler := handlers.NewCategoryHandler(categoryDB, tagDB, productDB, auditor)
 
 	userDB := database.NewUserRepository(db)
-	userHandler := handlers.NewUserHandler(userDB)
+	created, err := bootstrap.SeedAdmin(context.Background(), userDB, cfg.AdminName, cfg.AdminEmail, cfg.AdminPassword)
+	if errors.Is(err, bootstrap.ErrAdminNotConfigured) {
+		slog.Warn(err.Error())
+	} else if errors.Is(err, bootstrap.ErrAdminEmailTaken) {
+		slog.Error(err.Error()+"; set ADMIN_EMAIL to an unused address", "email", cfg.AdminEmail)
+	} else if err != nil {
+		panic(err)
+	} else if created {
+		slog.Info("created admin user", "email", cfg.AdminEmail)
+	}
+
+	registrationMode, err := handlers.ParseRegistrationMode(cfg.RegistrationMode)
+	if err != nil {
+		panic(err)
+	}
+	refreshTokenDB := database.NewRefreshTokenRepository(db)
+	inviteDB := database.NewInviteRepository(db)
+	lockout := entity.LockoutPolicy{
+		Threshold:   cfg.LockoutThreshold,
+		Duration:    time.Duration(cfg.LockoutDuration) * time.Second,
+		MaxDuration: time.Duration(cfg.LockoutMaxDuration) * time.Second,
+	}
+	userHandler := handlers.NewUserHandler(userDB, refreshTokenDB, inviteDB, database.NewUnitOfWork(db), registrationMode, lockout, auditor)
+
+	// MAIL_DRIVER=log writes emails to MAIL_LOG_FILE, or stdout, instead of
+	// sending them
+	var mailer mail.Mailer
+	switch cfg.MailDriver {
+	case "smtp":
+		mailer = mail.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	case "log":
+		out := os.Stdout
+		if cfg.MailLogFile != "" {
+			if out, err = os.OpenFile(cfg.MailLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600); err != nil {
+				panic(err)
+			}
+		}
+		mailer = mail.NewLogMailer(cfg.MailFrom, out)
+	default:
+		panic(fmt.Sprintf("unknown MAIL_DRIVER %q", cfg.MailDriver))
+	}
+	passwordResetDB := database.NewPasswordResetRepository(db)
+	passwordResetHandler := handlers.NewPasswordResetHandler(userDB, passwordResetDB, database.NewUnitOfWork(db), mailer,
+		time.Duration(cfg.PasswordResetExpiresIn)*time.Second, cfg.PasswordResetURL, auditor)
 
-	// public middlewares
-	public := func(next http.Handler) http.Handler {
-		return middleware.Logger(
-			middleware.Recoverer(
-				middleware.WithValue("jwt", cfg.TokenAuth)(
-					middleware.WithValue("jwtExpiresIn", cfg.JWTExpiresIn)(
-						next))))
+	jwksHandler := handlers.NewJWKSHandler(cfg.KeyRing)
+
+	queryTimeout := time.Duration(cfg.DBQueryTimeout) * time.Second
+	bulkTimeout := time.Duration(cfg.DBBulkTimeout) * time.Second
+
+	// public middlewares, bounding repository calls by timeout
+	publicWithin := func(timeout time.Duration) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return middleware.RequestID(
+				middleware.Logger(
+					middlewares.Recoverer(
+						middlewares.QueryTimeout(timeout)(
+							middleware.WithValue("jwt", cfg.TokenAuth)(
+								middleware.WithValue("jwtExpiresIn", cfg.JWTExpiresIn)(
+									middleware.WithValue("jwtRefreshExpiresIn", cfg.JWTRefreshExpiresIn)(
+										middleware.WithValue("inviteExpiresIn", cfg.InviteExpiresIn)(
+											next))))))))
+		}
 	}
+	public := publicWithin(queryTimeout)
 	// public middlewares plus verification
-	private := func(next http.Handler) http.Handler {
+	privateWithin := func(timeout time.Duration) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return publicWithin(timeout)(
+				cfg.KeyRing.Verifier()(
+					jwtauth.Authenticator(
+						next)))
+		}
+	}
+	private := privateWithin(queryTimeout)
+
+	// public middlewares plus optional verification, for routes that behave
+	// differently for signed-in callers
+	optional := func(next http.Handler) http.Handler {
 		return public(
-			jwtauth.Verifier(cfg.TokenAuth)(
-				jwtauth.Authenticator(
-					next)))
+			cfg.KeyRing.Verifier()(
+				next))
+	}
+	// verified users holding any of roles
+	authorizedWithin := func(timeout time.Duration, roles ...string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return privateWithin(timeout)(middlewares.RequireRoles(roles...)(next))
+		}
+	}
+	authorized := func(roles ...string) func(http.Handler) http.Handler {
+		return authorizedWithin(queryTimeout, roles...)
 	}
+	reader := authorized(entity.RoleAdmin, entity.RoleViewer)
+	admin := authorized(entity.RoleAdmin)
+	// imports, exports and batches touch many products, so they get the bulk
+	// timeout
+	bulkReader := authorizedWithin(bulkTimeout, entity.RoleAdmin, entity.RoleViewer)
+	bulkAdmin := authorizedWithin(bulkTimeout, entity.RoleAdmin)
+	// replays the stored response to retries carrying an Idempotency-Key; no
+	// route runs longer than the bulk timeout, so a claim older than that
+	// was left by a request that died
+	idempotent := middlewares.Idempotency(idempotencyDB, time.Duration(cfg.IdempotencyExpiresIn)*time.Second, bulkTimeout)
+	// limits requests to a route per client, answering 429 once spent
+	rateLimits := ratelimit.NewMemoryStore()
+	limited := func(spec string, key middlewares.RateLimitKey) func(http.Handler) http.Handler {
+		limit, err := ratelimit.ParseLimit(spec)
+		if err != nil {
+			panic(err)
+		}
+		return middlewares.RateLimit(rateLimits, limit, key)
+	}
+	loginLimits := func(next http.Handler) http.Handler {
+		return limited(cfg.RateLimitLoginIP, middlewares.RateLimitByIP("login"))(
+			limited(cfg.RateLimitLoginAccount, middlewares.RateLimitByJSONField("login", "email"))(
+				next))
+	}
+	refreshLimit := limited(cfg.RateLimitRefreshIP, middlewares.RateLimitByIP("refresh"))
+	signupLimit := limited(cfg.RateLimitSignupIP, middlewares.RateLimitByIP("signup"))
+	// reset emails are limited per address too, so nobody can flood an inbox
+	resetLimits := func(next http.Handler) http.Handler {
+		return limited(cfg.RateLimitResetIP, middlewares.RateLimitByIP("reset"))(
+			limited(cfg.RateLimitResetAccount, middlewares.RateLimitByJSONField("reset", "email"))(
+				next))
+	}
+	resetLimit := limited(cfg.RateLimitResetIP, middlewares.RateLimitByIP("reset_password"))
+	// guessing the current password is held to the login limit
+	passwordLimit := limited(cfg.RateLimitLoginIP, middlewares.RateLimitByIP("password"))
 
 	r := http.NewServeMux()
 
-	r.Handle("GET /products", private(http.HandlerFunc(productHandler.FindAllProducts)))
-	r.Handle("POST /products", private(http.HandlerFunc(productHandler.CreateProduct)))
-	r.Handle("GET /products/{id}", private(http.HandlerFunc(productHandler.GetProduct)))
-	r.Handle("PUT /products/{id}", private(http.HandlerFunc(productHandler.UpdateProduct)))
-	r.Handle("DELETE /products/{id}", private(http.HandlerFunc(productHandler.DeleteProduct)))
+	r.Handle("GET /products", reader(http.HandlerFunc(productHandler.FindAllProducts)))
+	r.Handle("POST /products", admin(idempotent(http.HandlerFunc(productHandler.CreateProduct))))
+	r.Handle("GET /products/{id}", reader(http.HandlerFunc(productHandler.GetProduct)))
+	r.Handle("PUT /products/{id}", admin(http.HandlerFunc(productHandler.UpdateProduct)))
+	r.Handle("PATCH /products/{id}", admin(http.HandlerFunc(productHandler.PatchProduct)))
+	r.Handle("DELETE /products/{id}", admin(http.HandlerFunc(productHandler.DeleteProduct)))
+	r.Handle("GET /products/trash", admin(http.HandlerFunc(productHandler.FindTrash)))
+	r.Handle("POST /products/{id}/restore", admin(http.HandlerFunc(productHandler.RestoreProduct)))
+	r.Handle("DELETE /products/trash/{id}", admin(http.HandlerFunc(productHandler.PurgeProduct)))
+	r.Handle("POST /products/import", bulkAdmin(http.HandlerFunc(productHandler.ImportProducts)))
+	r.Handle("GET /products/export", bulkReader(http.HandlerFunc(productHandler.ExportProducts)))
+	r.Handle("POST /products/batch", bulkAdmin(idempotent(http.HandlerFunc(batchHandler.BatchProducts))))
 
-	r.Handle("POST /users", private(http.HandlerFunc(userHandler.CreateUser)))
-	r.Handle("GET /users", private(http.HandlerFunc(userHandler.FindByEmail)))
+	r.Handle("POST /products/{id}/stock/adjust", admin(idempotent(http.HandlerFunc(stockHandler.AdjustStock))))
+	r.Handle("POST /products/{id}/reservations", admin(idempotent(http.HandlerFunc(stockHandler.ReserveStock))))
+	r.Handle("GET /reservations/{id}", admin(http.HandlerFunc(stockHandler.GetReservation)))
+	r.Handle("POST /reservations/{id}/commit", admin(http.HandlerFunc(stockHandler.CommitReservation)))
+	r.Handle("POST /reservations/{id}/release", admin(http.HandlerFunc(stockHandler.ReleaseReservation)))
+	r.Handle("GET /products/{id}/categories", reader(http.HandlerFunc(categoryHandler.FindProductCategories)))
+	r.Handle("PUT /products/{id}/categories", admin(http.HandlerFunc(categoryHandler.SetProductCategories)))
+	r.Handle("GET /products/{id}/tags", reader(http.HandlerFunc(categoryHandler.FindProductTags)))
+	r.Handle("PUT /products/{id}/tags", admin(http.HandlerFunc(categoryHandler.SetProductTags)))
+	r.Handle("GET /categories", reader(http.HandlerFunc(categoryHandler.FindCategories)))
+	r.Handle("POST /categories", admin(idempotent(http.HandlerFunc(categoryHandler.CreateCategory))))
+	r.Handle("GET /categories/{id}", reader(http.HandlerFunc(categoryHandler.GetCategory)))
+	r.Handle("PUT /categories/{id}", admin(http.HandlerFunc(categoryHandler.UpdateCategory)))
+	r.Handle("DELETE /categories/{id}", admin(http.HandlerFunc(categoryHandler.DeleteCategory)))
 
-	r.Handle("POST /users/generate_token", public(http.HandlerFunc(userHandler.GetJwt)))
+	if registrationMode == handlers.RegistrationClosed {
+		r.Handle("POST /users", admin(idempotent(http.HandlerFunc(userHandler.CreateUser))))
+	} else {
+		r.Handle("POST /users", optional(signupLimit(idempotent(http.HandlerFunc(userHandler.CreateUser)))))
+	}
+	// not idempotent: a stored response would keep the plaintext invite code
+	r.Handle("POST /users/invites", admin(http.HandlerFunc(userHandler.CreateInvite)))
+	r.Handle("GET /users", admin(http.HandlerFunc(userHandler.FindByEmail)))
+	r.Handle("GET /users/me", private(http.HandlerFunc(userHandler.GetMe)))
+	r.Handle("POST /users/me/password", private(passwordLimit(http.HandlerFunc(userHandler.ChangePassword))))
+	r.Handle("GET /users/{id}", admin(http.HandlerFunc(userHandler.GetUser)))
+	r.Handle("PUT /users/{id}", admin(http.HandlerFunc(userHandler.UpdateUser)))
+	r.Handle("DELETE /users/{id}", admin(http.HandlerFunc(userHandler.DeleteUser)))
+
+	r.Handle("POST /users/generate_token", public(loginLimits(http.HandlerFunc(userHandler.GetJwt))))
+	r.Handle("POST /users/refresh_token", public(refreshLimit(http.HandlerFunc(userHandler.RefreshJwt))))
+	r.Handle("POST /users/logout", public(http.HandlerFunc(userHandler.Logout)))
+	r.Handle("POST /users/password/forgot", public(resetLimits(http.HandlerFunc(passwordResetHandler.ForgotPassword))))
+	r.Handle("POST /users/password/reset", public(resetLimit(http.HandlerFunc(passwordResetHandler.ResetPassword))))
+
+	r.Handle("GET /audit", admin(http.HandlerFunc(auditHandler.FindAudit)))
+
+	r.Handle("GET /.well-known/jwks.json", public(http.HandlerFunc(jwksHandler.GetJWKS)))
 
 	r.Handle("GET /docs/", public(httpSwagger.Handler(httpSwagger.URL("http://localhost:8080/docs/doc.json"))))
 
+	// Request contexts derive from requestsCtx, which is cancelled when the
+	// shutdown grace period runs out so in-flight queries are abandoned.
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%s", cfg.WebServerPort),
-		Handler: r,
+		Addr:        fmt.Sprintf(":%s", cfg.WebServerPort),
+		Handler:     r,
+		BaseContext: func(net.Listener) context.Context { return requestsCtx },
 	}
 
 	go func() {
@@ -99,6 +294,11 @@ func main() {
 		}
 	}()
 
+	go purgeTrash(requestsCtx, productDB, cfg.TrashRetentionDays)
+	go expireReservations(requestsCtx, stockDB)
+	go purgeIdempotencyRecords(requestsCtx, idempotencyDB)
+	go purgePasswordResets(requestsCtx, passwordResetDB)
+
 	termChan := make(chan os.Signal, 1)
 	signal.Notify(termChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
@@ -106,10 +306,13 @@ func main() {
 	slog.Info("server: shutting down")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	context.AfterFunc(ctx, cancelRequests)
 	if err := server.Shutdown(ctx); err != nil {
 		slog.Error("Could not shutdown the server: %v\n", err)
 		os.Exit(1)
 	}
+	// let reset emails requested before shutdown go out
+	passwordResetHandler.Wait()
 	slog.Info("Server stopped")
 	os.Exit(0)
 }
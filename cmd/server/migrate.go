@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/antoniofmoliveira/apis/internal/infra/database/migrations"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  up             apply all pending migrations
+  down [N]       roll back the last N migrations (default 1)
+  status         list migrations and whether they are applied
+  to VERSION     migrate up or down to VERSION (0 rolls back everything)`
+
+var errMigrateUsage = errors.New(migrateUsage)
+
+func runMigrate(migrator *migrations.Migrator, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+	switch args[0] {
+	case "up":
+		count, err := migrator.Up()
+		fmt.Printf("applied %d migration(s)\n", count)
+		return err
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return errMigrateUsage
+			}
+		}
+		count, err := migrator.Down(n)
+		fmt.Printf("rolled back %d migration(s)\n", count)
+		return err
+	case "to":
+		if len(args) < 2 {
+			return errMigrateUsage
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			return errMigrateUsage
+		}
+		count, err := migrator.To(version)
+		fmt.Printf("ran %d migration(s)\n", count)
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return tw.Flush()
+	default:
+		return errMigrateUsage
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"golang.org/x/exp/slog"
+)
+
+// runPeriodically calls fn now and then every interval until ctx is
+// cancelled, logging failures and how many rows each run removed under
+// name.
+func runPeriodically(ctx context.Context, interval time.Duration, name string, fn func(ctx context.Context) (int64, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := fn(ctx); err != nil {
+			slog.Error("periodic task failed", "task", name, "error", err)
+		} else if n > 0 {
+			slog.Info("periodic task done", "task", name, "rows", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// trashPurgeInterval is how often purgeTrash looks for expired products.
+const trashPurgeInterval = time.Hour
+
+// purgeTrash permanently deletes products that have been in the trash for
+// longer than days, until ctx is cancelled. A non-positive days keeps the
+// trash forever.
+func purgeTrash(ctx context.Context, products database.ProductRepositoryInterface, days int) {
+	if days <= 0 {
+		return
+	}
+	runPeriodically(ctx, trashPurgeInterval, "purge trash", func(ctx context.Context) (int64, error) {
+		return products.PurgeDeletedBefore(ctx, time.Now().AddDate(0, 0, -days))
+	})
+}
+
+// reservationExpiryInterval is how often expireReservations frees the stock
+// of lapsed reservations.
+const reservationExpiryInterval = time.Minute
+
+// expireReservations releases lapsed reservations until ctx is cancelled.
+// Reserving also reclaims a product's lapsed reservations, so this only
+// keeps the reserved counts accurate between orders.
+func expireReservations(ctx context.Context, stock database.StockRepositoryInterface) {
+	runPeriodically(ctx, reservationExpiryInterval, "expire reservations", func(ctx context.Context) (int64, error) {
+		return stock.ReleaseExpired(ctx, time.Now())
+	})
+}
+
+// idempotencyPurgeInterval is how often purgeIdempotencyRecords runs.
+const idempotencyPurgeInterval = time.Hour
+
+// purgeIdempotencyRecords deletes expired idempotency records until ctx is
+// cancelled. Expired keys are already ignored, so this only reclaims space.
+func purgeIdempotencyRecords(ctx context.Context, records database.IdempotencyRepositoryInterface) {
+	runPeriodically(ctx, idempotencyPurgeInterval, "purge idempotency records", func(ctx context.Context) (int64, error) {
+		return records.DeleteExpired(ctx, time.Now())
+	})
+}
+
+// passwordResetPurgeInterval is how often purgePasswordResets runs.
+const passwordResetPurgeInterval = time.Hour
+
+// purgePasswordResets deletes expired password resets until ctx is
+// cancelled. Expired tokens are already refused, so this only reclaims space.
+func purgePasswordResets(ctx context.Context, resets database.PasswordResetRepositoryInterface) {
+	runPeriodically(ctx, passwordResetPurgeInterval, "purge password resets", func(ctx context.Context) (int64, error) {
+		return resets.DeleteExpired(ctx, time.Now())
+	})
+}
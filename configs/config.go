@@ -1,6 +1,10 @@
 package configs
 
 import (
+	"errors"
+
+	"github.com/antoniofmoliveira/apis/internal/infra/jwtkeys"
+	"github.com/antoniofmoliveira/apis/pkg/money"
 	"github.com/go-chi/jwtauth"
 	"github.com/spf13/viper"
 )
@@ -8,17 +12,54 @@ import (
 var cfg *conf
 
 type conf struct {
-	DBDriver      string `mapstructure:"DB_DRIVER"`
-	DBHost        string `mapstructure:"DB_HOST"`
-	DBPort        string `mapstructure:"DB_PORT"`
-	DBUser        string `mapstructure:"DB_USER"`
-	DBPassword    string `mapstructure:"DB_PASSWORD"`
-	DBName        string `mapstructure:"DB_NAME"`
-	WebServerPort string `mapstructure:"WEB_SERVER_PORT"`
-	WebServerHost string `mapstructure:"WEB_SERVER_HOST"`
-	JWTSecret     string `mapstructure:"JWT_SECRET"`
-	JWTExpiresIn  int    `mapstructure:"JWT_EXPIRESIN"`
-	TokenAuth     *jwtauth.JWTAuth
+	DBDriver               string `mapstructure:"DB_DRIVER"`
+	DBHost                 string `mapstructure:"DB_HOST"`
+	DBPort                 string `mapstructure:"DB_PORT"`
+	DBUser                 string `mapstructure:"DB_USER"`
+	DBPassword             string `mapstructure:"DB_PASSWORD"`
+	DBName                 string `mapstructure:"DB_NAME"`
+	DBSSLMode              string `mapstructure:"DB_SSLMODE"`
+	WebServerPort          string `mapstructure:"WEB_SERVER_PORT"`
+	WebServerHost          string `mapstructure:"WEB_SERVER_HOST"`
+	JWTSecret              string `mapstructure:"JWT_SECRET"`
+	JWTExpiresIn           int    `mapstructure:"JWT_EXPIRESIN"`
+	JWTRefreshExpiresIn    int    `mapstructure:"JWT_REFRESH_EXPIRESIN"`
+	RegistrationMode       string `mapstructure:"REGISTRATION_MODE"`
+	InviteExpiresIn        int    `mapstructure:"INVITE_EXPIRESIN"`
+	AdminName              string `mapstructure:"ADMIN_NAME"`
+	AdminEmail             string `mapstructure:"ADMIN_EMAIL"`
+	AdminPassword          string `mapstructure:"ADMIN_PASSWORD"`
+	JWTKeys                string `mapstructure:"JWT_KEYS"`
+	JWTSigningKeyID        string `mapstructure:"JWT_SIGNING_KEY_ID"`
+	PageDefaultLimit       int    `mapstructure:"PAGE_DEFAULT_LIMIT"`
+	PageMaxLimit           int    `mapstructure:"PAGE_MAX_LIMIT"`
+	PageEnvelope           bool   `mapstructure:"PAGE_ENVELOPE"`
+	DBQueryTimeout         int    `mapstructure:"DB_QUERY_TIMEOUT"`
+	DBBulkTimeout          int    `mapstructure:"DB_BULK_TIMEOUT"`
+	TrashRetentionDays     int    `mapstructure:"TRASH_RETENTION_DAYS"`
+	DefaultCurrency        string `mapstructure:"DEFAULT_CURRENCY"`
+	ReservationExpiresIn   int    `mapstructure:"RESERVATION_EXPIRESIN"`
+	IdempotencyExpiresIn   int    `mapstructure:"IDEMPOTENCY_EXPIRESIN"`
+	RateLimitLoginIP       string `mapstructure:"RATE_LIMIT_LOGIN_IP"`
+	RateLimitLoginAccount  string `mapstructure:"RATE_LIMIT_LOGIN_ACCOUNT"`
+	RateLimitRefreshIP     string `mapstructure:"RATE_LIMIT_REFRESH_IP"`
+	RateLimitSignupIP      string `mapstructure:"RATE_LIMIT_SIGNUP_IP"`
+	LockoutThreshold       int    `mapstructure:"LOGIN_LOCKOUT_THRESHOLD"`
+	LockoutDuration        int    `mapstructure:"LOGIN_LOCKOUT_DURATION"`
+	LockoutMaxDuration     int    `mapstructure:"LOGIN_LOCKOUT_MAX_DURATION"`
+	RateLimitResetIP       string `mapstructure:"RATE_LIMIT_RESET_IP"`
+	RateLimitResetAccount  string `mapstructure:"RATE_LIMIT_RESET_ACCOUNT"`
+	PasswordResetExpiresIn int    `mapstructure:"PASSWORD_RESET_EXPIRESIN"`
+	PasswordResetURL       string `mapstructure:"PASSWORD_RESET_URL"`
+	MailDriver             string `mapstructure:"MAIL_DRIVER"`
+	MailFrom               string `mapstructure:"MAIL_FROM"`
+	MailLogFile            string `mapstructure:"MAIL_LOG_FILE"`
+	SMTPHost               string `mapstructure:"SMTP_HOST"`
+	SMTPPort               int    `mapstructure:"SMTP_PORT"`
+	SMTPUsername           string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword           string `mapstructure:"SMTP_PASSWORD"`
+	TokenAuth              *jwtauth.JWTAuth
+	KeyRing                *jwtkeys.KeyRing
 }
 
 func LoadConfig(path string) (*conf, error) {
@@ -27,6 +68,30 @@ func LoadConfig(path string) (*conf, error) {
 	viper.AddConfigPath(path)
 	viper.SetConfigFile(".env")
 	viper.AutomaticEnv()
+	viper.SetDefault("DB_SSLMODE", "require")
+	viper.SetDefault("JWT_REFRESH_EXPIRESIN", 30*24*60*60)
+	viper.SetDefault("REGISTRATION_MODE", "closed")
+	viper.SetDefault("INVITE_EXPIRESIN", 7*24*60*60)
+	viper.SetDefault("PAGE_DEFAULT_LIMIT", 20)
+	viper.SetDefault("PAGE_MAX_LIMIT", 100)
+	viper.SetDefault("DB_QUERY_TIMEOUT", 5)
+	viper.SetDefault("DB_BULK_TIMEOUT", 300)
+	viper.SetDefault("TRASH_RETENTION_DAYS", 30)
+	viper.SetDefault("DEFAULT_CURRENCY", "USD")
+	viper.SetDefault("RESERVATION_EXPIRESIN", 15*60)
+	viper.SetDefault("IDEMPOTENCY_EXPIRESIN", 24*60*60)
+	viper.SetDefault("RATE_LIMIT_LOGIN_IP", "20/1m")
+	viper.SetDefault("RATE_LIMIT_LOGIN_ACCOUNT", "5/1m")
+	viper.SetDefault("RATE_LIMIT_REFRESH_IP", "60/1m")
+	viper.SetDefault("RATE_LIMIT_SIGNUP_IP", "10/1h")
+	viper.SetDefault("LOGIN_LOCKOUT_THRESHOLD", 5)
+	viper.SetDefault("LOGIN_LOCKOUT_DURATION", 60)
+	viper.SetDefault("LOGIN_LOCKOUT_MAX_DURATION", 60*60)
+	viper.SetDefault("RATE_LIMIT_RESET_IP", "10/1h")
+	viper.SetDefault("RATE_LIMIT_RESET_ACCOUNT", "3/1h")
+	viper.SetDefault("PASSWORD_RESET_EXPIRESIN", 60*60)
+	viper.SetDefault("MAIL_FROM", "no-reply@localhost")
+	viper.SetDefault("SMTP_PORT", 587)
 
 	if err := viper.ReadInConfig(); err != nil {
 		panic(err)
@@ -35,7 +100,36 @@ func LoadConfig(path string) (*conf, error) {
 	if err := viper.Unmarshal(&cfg); err != nil {
 		panic(err)
 	}
-	cfg.TokenAuth = jwtauth.New("HS256", []byte(cfg.JWTSecret), nil)
+	if _, err := money.Exponent(cfg.DefaultCurrency); err != nil {
+		return nil, err
+	}
+	// a zero limit would drop the LIMIT clause and divide by zero in page counts
+	if cfg.PageDefaultLimit <= 0 || cfg.PageMaxLimit <= 0 {
+		return nil, errors.New("PAGE_DEFAULT_LIMIT and PAGE_MAX_LIMIT must be positive")
+	}
+	if cfg.PageDefaultLimit > cfg.PageMaxLimit {
+		return nil, errors.New("PAGE_DEFAULT_LIMIT must not exceed PAGE_MAX_LIMIT")
+	}
+	// no default: "log" writes reset tokens in the clear, so a deploy has to
+	// choose it explicitly
+	if cfg.MailDriver == "" {
+		return nil, errors.New("MAIL_DRIVER is required: smtp, or log to write emails out instead of sending them")
+	}
+	// JWT_KEYS switches from the shared HS256 secret to asymmetric keys
+	if cfg.JWTKeys != "" {
+		ring, err := jwtkeys.Load(cfg.JWTKeys, cfg.JWTSigningKeyID)
+		if err != nil {
+			return nil, err
+		}
+		cfg.KeyRing = ring
+	} else {
+		cfg.KeyRing = jwtkeys.NewHMAC([]byte(cfg.JWTSecret))
+	}
+	tokenAuth, err := cfg.KeyRing.TokenAuth()
+	if err != nil {
+		return nil, err
+	}
+	cfg.TokenAuth = tokenAuth
 
 	return cfg, nil
 }
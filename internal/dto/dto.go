@@ -1,27 +1,190 @@
 package dto
 
+import (
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/pkg/money"
+)
+
+// CreateProductInput takes the price as a decimal string such as "12.30";
+// Currency defaults to the server's DEFAULT_CURRENCY.
 type CreateProductInput struct {
-	Name  string  `json:"name" binding:"required"`
-	Price float64 `json:"price" binding:"required"`
+	Name     string        `json:"name" binding:"required"`
+	Price    money.Decimal `json:"price" binding:"required" swaggertype:"string" example:"12.30"`
+	Currency string        `json:"currency" example:"USD"`
 }
 
+// UpdateProductInput keeps the product's currency when Currency is empty.
 type UpdateProductInput struct {
-	ID    string  `json:"id" binding:"required"`
-	Name  string  `json:"name" binding:"required"`
-	Price float64 `json:"price" binding:"required"`
+	ID       string        `json:"id" binding:"required"`
+	Name     string        `json:"name" binding:"required"`
+	Price    money.Decimal `json:"price" binding:"required" swaggertype:"string" example:"12.30"`
+	Currency string        `json:"currency" example:"USD"`
+}
+
+// BatchInput lists product writes for POST /products/batch. Mode is atomic
+// (the default) or best_effort.
+type BatchInput struct {
+	Mode       string           `json:"mode" example:"atomic"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+// BatchOperation is a create, update or delete. Update and delete need ID
+// and IfMatch, which takes the same values as the If-Match header; update
+// keeps the product's currency when Currency is empty.
+type BatchOperation struct {
+	Op       string        `json:"op" example:"update"`
+	ID       string        `json:"id,omitempty"`
+	IfMatch  string        `json:"if_match,omitempty" example:"*"`
+	Name     string        `json:"name,omitempty"`
+	Price    money.Decimal `json:"price,omitempty" swaggertype:"string" example:"12.30"`
+	Currency string        `json:"currency,omitempty" example:"USD"`
+}
+
+// BatchResult reports every operation of a batch in request order.
+type BatchResult struct {
+	Mode    string            `json:"mode"`
+	Applied int               `json:"applied"`
+	Failed  int               `json:"failed"`
+	Results []BatchItemResult `json:"results"`
+}
+
+// BatchItemResult carries the HTTP status the operation would have had on
+// its own endpoint. In atomic mode the operations that were not applied
+// because another one failed have status 424.
+type BatchItemResult struct {
+	Index   int             `json:"index"`
+	Op      string          `json:"op"`
+	ID      string          `json:"id,omitempty"`
+	Status  int             `json:"status"`
+	Product *entity.Product `json:"product,omitempty"`
+	Field   string          `json:"field,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// AdjustStockInput changes the quantity on hand by Delta. Reason is one of
+// received, returned, damaged, lost or correction.
+type AdjustStockInput struct {
+	Delta  int64  `json:"delta" binding:"required"`
+	Reason string `json:"reason" binding:"required" example:"received"`
+	Note   string `json:"note"`
+}
+
+// ReserveStockInput holds Quantity units for ExpiresIn seconds, or the
+// server's default when it is zero.
+type ReserveStockInput struct {
+	Quantity  int64 `json:"quantity" binding:"required"`
+	ExpiresIn int   `json:"expires_in"`
+}
+
+// CategoryInput creates or replaces a category. A null parent_id makes it a
+// root category.
+type CategoryInput struct {
+	Name     string  `json:"name" binding:"required"`
+	ParentID *string `json:"parent_id"`
+}
+
+// ProductCategoriesInput replaces the categories of a product.
+type ProductCategoriesInput struct {
+	CategoryIDs []string `json:"category_ids"`
+}
+
+// ProductTagsInput replaces the tags of a product.
+type ProductTagsInput struct {
+	Tags []string `json:"tags"`
 }
 
 type CreateUserInput struct {
-	Name     string `json:"name" binding:"required"`
-	Email    string `json:"email" binding:"required"`
+	Name       string   `json:"name" binding:"required"`
+	Email      string   `json:"email" binding:"required"`
+	Password   string   `json:"password" binding:"required"`
+	Roles      []string `json:"roles"`
+	InviteCode string   `json:"invite_code"`
+}
+
+// UpdateUserInput replaces the name, email and roles of a user. Roles
+// default to viewer when empty.
+type UpdateUserInput struct {
+	Name  string   `json:"name" binding:"required"`
+	Email string   `json:"email" binding:"required"`
+	Roles []string `json:"roles"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required"`
+}
+
+// ResetPasswordInput sets a new password with a token from a reset email.
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
+type CreateInviteInput struct {
+	Email string `json:"email"`
+}
+
+type InviteOutput struct {
+	Code      string    `json:"code"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type GetJWTInput struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
 type AccessToken struct {
-	AccessToken string `json:"access_token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type ProductPage struct {
+	Items      []entity.Product `json:"items"`
+	Page       int              `json:"page"`
+	Limit      int              `json:"limit"`
+	Total      int64            `json:"total"`
+	TotalPages int              `json:"total_pages"`
+}
+
+type ProductCursorPage struct {
+	Items      []entity.Product `json:"items"`
+	Limit      int              `json:"limit"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// ImportResult reports a product import. Imported counts the rows that
+// were created, or that would have been on a dry run.
+type ImportResult struct {
+	DryRun   bool          `json:"dry_run"`
+	Rows     int           `json:"rows"`
+	Imported int           `json:"imported"`
+	Failed   int           `json:"failed"`
+	Errors   []ImportError `json:"errors"`
+}
+
+// ImportError describes a rejected row by its line in the uploaded file.
+type ImportError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+type AuditPage struct {
+	Items      []entity.AuditEntry `json:"items"`
+	Page       int                 `json:"page"`
+	Limit      int                 `json:"limit"`
+	Total      int64               `json:"total"`
+	TotalPages int                 `json:"total_pages"`
 }
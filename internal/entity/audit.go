@@ -0,0 +1,122 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+)
+
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+	AuditLogin   = "login"
+	AuditRefresh = "refresh"
+	AuditLogout  = "logout"
+	AuditRevoke  = "revoke"
+	AuditLockout = "lockout"
+
+	AuditChangePassword = "change_password"
+	AuditResetPassword  = "reset_password"
+
+	AuditAdjustStock = "adjust_stock"
+	AuditReserve     = "reserve"
+	AuditCommit      = "commit"
+	AuditRelease     = "release"
+)
+
+var ErrInvalidAuditEntry = errors.New("audit entry needs an action and entity type")
+
+// AuditEntry records one write made through the API. Before and After hold
+// the JSON representation of the entity, so fields hidden from JSON such as
+// password hashes never reach the log.
+type AuditEntry struct {
+	ID         entity.ID `json:"id"`
+	Actor      string    `json:"actor" gorm:"index"`
+	Action     string    `json:"action"`
+	EntityType string    `json:"entity" gorm:"index:idx_audit_entries_entity"`
+	EntityID   string    `json:"entity_id" gorm:"index:idx_audit_entries_entity"`
+	Before     Snapshot  `json:"before" gorm:"type:text" swaggertype:"object"`
+	After      Snapshot  `json:"after" gorm:"type:text" swaggertype:"object"`
+	RequestID  string    `json:"request_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NewAuditEntry snapshots before and after, either of which may be nil.
+func NewAuditEntry(actor, action, entityType, entityID string, before, after any, requestID string) (*AuditEntry, error) {
+	if action == "" || entityType == "" {
+		return nil, ErrInvalidAuditEntry
+	}
+	b, err := NewSnapshot(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := NewSnapshot(after)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditEntry{
+		ID:         entity.NewId(),
+		Actor:      actor,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Before:     b,
+		After:      a,
+		RequestID:  requestID,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// Snapshot is a JSON document stored as text. An empty snapshot is null.
+type Snapshot []byte
+
+func NewSnapshot(v any) (Snapshot, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	if len(s) == 0 {
+		return []byte("null"), nil
+	}
+	return s, nil
+}
+
+func (s *Snapshot) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = nil
+		return nil
+	}
+	*s = append((*s)[:0], data...)
+	return nil
+}
+
+func (s Snapshot) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	return string(s), nil
+}
+
+func (s *Snapshot) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*s = nil
+	case string:
+		*s = Snapshot(v)
+	case []byte:
+		*s = append(Snapshot(nil), v...)
+	default:
+		return fmt.Errorf("unsupported snapshot value %T", src)
+	}
+	return nil
+}
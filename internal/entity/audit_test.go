@@ -0,0 +1,41 @@
+package entity
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAuditEntry(t *testing.T) {
+	user, _ := NewUser("John Doe", "j@j.com", "123456")
+	entry, err := NewAuditEntry("admin-id", AuditCreate, "user", user.ID.String(), nil, user, "req-1")
+	assert.Nil(t, err)
+	assert.Nil(t, entry.Before)
+	assert.NotContains(t, string(entry.After), user.Password)
+	assert.Contains(t, string(entry.After), `"email":"j@j.com"`)
+
+	b, err := json.Marshal(entry)
+	assert.Nil(t, err)
+	var decoded map[string]any
+	assert.Nil(t, json.Unmarshal(b, &decoded))
+	assert.Nil(t, decoded["before"])
+	assert.Equal(t, "j@j.com", decoded["after"].(map[string]any)["email"])
+
+	_, err = NewAuditEntry("admin-id", "", "user", "", nil, nil, "")
+	assert.Equal(t, ErrInvalidAuditEntry, err)
+}
+
+func TestSnapshotScan(t *testing.T) {
+	var s Snapshot
+	assert.Nil(t, s.Scan(`{"a":1}`))
+	assert.Equal(t, `{"a":1}`, string(s))
+	v, err := s.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":1}`, v)
+
+	assert.Nil(t, s.Scan(nil))
+	v, err = s.Value()
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+}
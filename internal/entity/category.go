@@ -0,0 +1,87 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+)
+
+// MaxTagLength is the longest tag accepted, in characters.
+const MaxTagLength = 50
+
+var (
+	ErrInvalidParent = errors.New("invalid parent category")
+	ErrInvalidTag    = errors.New("invalid tag")
+)
+
+// Category is a node of the catalog tree. Root categories have no parent.
+type Category struct {
+	ID        entity.ID  `json:"id"`
+	Name      string     `json:"name"`
+	ParentID  *entity.ID `json:"parent_id" gorm:"index"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func NewCategory(name string, parentID *entity.ID) (*Category, error) {
+	now := time.Now()
+	c := &Category{
+		ID:        entity.NewId(),
+		Name:      name,
+		ParentID:  parentID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Category) Validate() error {
+	if c.ID.String() == "" {
+		return ErrIDIsRequired
+	}
+	if strings.TrimSpace(c.Name) == "" {
+		return ErrNameIsRequired
+	}
+	if c.ParentID != nil && *c.ParentID == c.ID {
+		return ErrInvalidParent
+	}
+	return nil
+}
+
+// ProductCategory assigns a product to a category.
+type ProductCategory struct {
+	ProductID  entity.ID `gorm:"primaryKey"`
+	CategoryID entity.ID `gorm:"primaryKey;index"`
+}
+
+// ProductTag attaches a free-form tag to a product.
+type ProductTag struct {
+	ProductID entity.ID `gorm:"primaryKey"`
+	Tag       string    `gorm:"primaryKey;index"`
+}
+
+// NormalizeTags trims and lowercases tags, drops duplicates and sorts them,
+// so "Sale" and " sale" are the same tag.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len([]rune(tag)) > MaxTagLength {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
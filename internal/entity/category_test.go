@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCategory(t *testing.T) {
+	root, err := NewCategory("Clothing", nil)
+	assert.Nil(t, err)
+	assert.Nil(t, root.ParentID)
+
+	child, err := NewCategory("Shirts", &root.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, root.ID, *child.ParentID)
+
+	_, err = NewCategory(" ", nil)
+	assert.Equal(t, ErrNameIsRequired, err)
+}
+
+func TestCategoryOwnParent(t *testing.T) {
+	c, _ := NewCategory("Clothing", nil)
+	c.ParentID = &c.ID
+	assert.Equal(t, ErrInvalidParent, c.Validate())
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := NormalizeTags([]string{"Sale", " sale", "cotton", "Summer "})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cotton", "sale", "summer"}, tags)
+
+	_, err = NormalizeTags([]string{""})
+	assert.True(t, errors.Is(err, ErrInvalidTag))
+	_, err = NormalizeTags([]string{strings.Repeat("x", MaxTagLength+1)})
+	assert.True(t, errors.Is(err, ErrInvalidTag))
+}
@@ -0,0 +1,86 @@
+package entity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+)
+
+// MaxIdempotencyKeyLength bounds the Idempotency-Key header.
+const MaxIdempotencyKeyLength = 255
+
+var ErrInvalidIdempotencyKey = errors.New("Idempotency-Key must be 1 to 255 printable ASCII characters")
+
+// IdempotencyRecord holds the first response to a request that carried an
+// Idempotency-Key, so retries of the request can be answered with it. Keys
+// are unique per Scope, which identifies the caller. A zero Status marks a
+// request that is still being processed.
+type IdempotencyRecord struct {
+	ID          entity.ID `json:"id"`
+	Scope       string    `json:"scope" gorm:"uniqueIndex:idx_idempotency_records_scope_key"`
+	Key         string    `json:"key" gorm:"uniqueIndex:idx_idempotency_records_scope_key"`
+	RequestHash string    `json:"-"`
+	Status      int       `json:"status"`
+	// Header is the JSON encoded response header.
+	Header    string    `json:"-"`
+	Body      []byte    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+}
+
+// NewIdempotencyRecord starts a pending record for key in scope. requestHash
+// identifies the request so a reused key with another request is detected.
+func NewIdempotencyRecord(scope, key, requestHash string, ttl time.Duration) (*IdempotencyRecord, error) {
+	if ttl <= 0 {
+		return nil, ErrInvalidExpiration
+	}
+	if !validIdempotencyKey(key) {
+		return nil, ErrInvalidIdempotencyKey
+	}
+	now := time.Now()
+	return &IdempotencyRecord{
+		ID:          entity.NewId(),
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}, nil
+}
+
+// HashRequest fingerprints a request by method, target and body.
+func HashRequest(method, target string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + target + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (r *IdempotencyRecord) IsPending() bool {
+	return r.Status == 0
+}
+
+// IsAbandoned reports whether the record is still pending lease after it
+// was claimed, which means the request holding it died without finishing.
+func (r *IdempotencyRecord) IsAbandoned(now time.Time, lease time.Duration) bool {
+	return r.IsPending() && !now.Before(r.CreatedAt.Add(lease))
+}
+
+func (r *IdempotencyRecord) IsExpired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > MaxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
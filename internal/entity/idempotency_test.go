@@ -0,0 +1,29 @@
+package entity
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewIdempotencyRecord(t *testing.T) {
+	hash := HashRequest("POST", "/products", []byte(`{"name":"A"}`))
+	record, err := NewIdempotencyRecord("user:1", "order-42", hash, time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, record.IsPending())
+	assert.False(t, record.IsExpired(time.Now()))
+	assert.True(t, record.IsExpired(time.Now().Add(time.Hour)))
+	assert.False(t, record.IsAbandoned(time.Now(), time.Minute))
+	assert.True(t, record.IsAbandoned(time.Now().Add(time.Minute), time.Minute))
+	assert.NotEqual(t, hash, HashRequest("POST", "/products", []byte(`{"name":"B"}`)))
+	assert.NotEqual(t, hash, HashRequest("POST", "/users", []byte(`{"name":"A"}`)))
+
+	for _, key := range []string{"", "has space", "é", strings.Repeat("k", MaxIdempotencyKeyLength+1)} {
+		_, err := NewIdempotencyRecord("user:1", key, hash, time.Hour)
+		assert.ErrorIs(t, err, ErrInvalidIdempotencyKey, key)
+	}
+	_, err = NewIdempotencyRecord("user:1", "k", hash, 0)
+	assert.ErrorIs(t, err, ErrInvalidExpiration)
+}
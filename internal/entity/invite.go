@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"strings"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+)
+
+// Invite allows one registration while the API runs in invite-only mode.
+// Only the hash of the code is persisted. An empty Email accepts any address.
+type Invite struct {
+	ID        entity.ID  `json:"id"`
+	CodeHash  string     `json:"-" gorm:"uniqueIndex"`
+	Email     string     `json:"email"`
+	CreatedBy entity.ID  `json:"created_by"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// NewInvite creates an invite and returns it with the plain code to hand out.
+func NewInvite(email string, createdBy entity.ID, ttl time.Duration) (*Invite, string, error) {
+	if ttl <= 0 {
+		return nil, "", ErrInvalidExpiration
+	}
+	if email != "" && !emailRegex.MatchString(email) {
+		return nil, "", ErrInvalidEmail
+	}
+	code, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	return &Invite{
+		ID:        entity.NewId(),
+		CodeHash:  HashInviteCode(code),
+		Email:     email,
+		CreatedBy: createdBy,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}, code, nil
+}
+
+func HashInviteCode(code string) string {
+	return hashSecret(code)
+}
+
+// Accepts reports whether the invite can still register email.
+func (i *Invite) Accepts(email string, now time.Time) bool {
+	if i.UsedAt != nil || !now.Before(i.ExpiresAt) {
+		return false
+	}
+	return i.Email == "" || strings.EqualFold(i.Email, email)
+}
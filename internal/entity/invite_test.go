@@ -0,0 +1,36 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInvite(t *testing.T) {
+	invite, code, err := NewInvite("j@j.com", entity.NewId(), time.Hour)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, code)
+	assert.Equal(t, HashInviteCode(code), invite.CodeHash)
+	assert.True(t, invite.Accepts("j@j.com", time.Now()))
+	assert.False(t, invite.Accepts("x@j.com", time.Now()))
+	assert.False(t, invite.Accepts("j@j.com", time.Now().Add(2*time.Hour)))
+
+	now := time.Now()
+	invite.UsedAt = &now
+	assert.False(t, invite.Accepts("j@j.com", now))
+}
+
+func TestNewInviteAnyEmail(t *testing.T) {
+	invite, _, err := NewInvite("", entity.NewId(), time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, invite.Accepts("x@j.com", time.Now()))
+}
+
+func TestNewInviteInvalid(t *testing.T) {
+	_, _, err := NewInvite("j@j", entity.NewId(), time.Hour)
+	assert.Equal(t, ErrInvalidEmail, err)
+	_, _, err = NewInvite("", entity.NewId(), 0)
+	assert.Equal(t, ErrInvalidExpiration, err)
+}
@@ -0,0 +1,47 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+)
+
+// PasswordReset lets a user who forgot their password set a new one. Only
+// the hash of the token mailed to them is persisted, and it works once.
+type PasswordReset struct {
+	ID        entity.ID  `json:"id"`
+	UserID    entity.ID  `json:"user_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// NewPasswordReset creates a reset for userID and returns it with the plain
+// token to mail to the user.
+func NewPasswordReset(userID entity.ID, ttl time.Duration) (*PasswordReset, string, error) {
+	if ttl <= 0 {
+		return nil, "", ErrInvalidExpiration
+	}
+	token, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	return &PasswordReset{
+		ID:        entity.NewId(),
+		UserID:    userID,
+		TokenHash: HashPasswordResetToken(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}, token, nil
+}
+
+func HashPasswordResetToken(token string) string {
+	return hashSecret(token)
+}
+
+// IsUsable reports whether the reset can still change the password at now.
+func (p *PasswordReset) IsUsable(now time.Time) bool {
+	return p.UsedAt == nil && now.Before(p.ExpiresAt)
+}
@@ -0,0 +1,25 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPasswordReset(t *testing.T) {
+	reset, token, err := NewPasswordReset(entity.NewId(), time.Hour)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, HashPasswordResetToken(token), reset.TokenHash)
+	assert.True(t, reset.IsUsable(time.Now()))
+	assert.False(t, reset.IsUsable(time.Now().Add(2*time.Hour)))
+
+	now := time.Now()
+	reset.UsedAt = &now
+	assert.False(t, reset.IsUsable(now))
+
+	_, _, err = NewPasswordReset(entity.NewId(), 0)
+	assert.Equal(t, ErrInvalidExpiration, err)
+}
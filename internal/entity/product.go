@@ -1,10 +1,14 @@
 package entity
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"github.com/antoniofmoliveira/apis/pkg/money"
+	"gorm.io/gorm"
 )
 
 var (
@@ -13,21 +17,38 @@ var (
 	ErrNameIsRequired  = errors.New("name is required")
 	ErrPriceIsRequired = errors.New("price is required")
 	ErrInvalidPrice    = errors.New("invalid price")
+	ErrInvalidCurrency = errors.New("invalid currency")
 )
 
 type Product struct {
-	ID        entity.ID `json:"id"`
-	Name      string    `json:"name"`
-	Price     float64   `json:"price"`
+	ID   entity.ID `json:"id"`
+	Name string    `json:"name"`
+	// PriceMinor is the price in the minor unit of Currency, e.g. cents.
+	// MarshalJSON replaces it with a decimal string, which is what the tag
+	// describes to swag.
+	PriceMinor int64 `json:"price" gorm:"not null" swaggertype:"string" example:"12.30"`
+	// Currency is an ISO 4217 code.
+	Currency string `json:"currency" gorm:"size:3;not null"`
+	// Stock is the quantity on hand and Reserved the part of it held by
+	// pending reservations. Both change only through the stock endpoints.
+	Stock     int64     `json:"stock" gorm:"not null;default:0"`
+	Reserved  int64     `json:"reserved" gorm:"not null;default:0"`
 	CreatedAt time.Time `json:"created_at"`
+	// Version is incremented on every update and backs optimistic locking.
+	Version int64 `json:"version" gorm:"not null;default:1"`
+	// DeletedAt marks a product moved to the trash. GORM hides such rows
+	// from ordinary queries.
+	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index" swaggertype:"string" format:"date-time"`
 }
 
-func NewProduct(name string, price float64) (*Product, error) {
+func NewProduct(name string, priceMinor int64, currency string) (*Product, error) {
 	p := &Product{
-		ID:        entity.NewId(),
-		Name:      name,
-		Price:     price,
-		CreatedAt: time.Now(),
+		ID:         entity.NewId(),
+		Name:       name,
+		PriceMinor: priceMinor,
+		Currency:   currency,
+		CreatedAt:  time.Now(),
+		Version:    1,
 	}
 	if err := p.Validate(); err != nil {
 		return nil, err
@@ -45,11 +66,79 @@ func (p *Product) Validate() error {
 	if p.Name == "" {
 		return ErrNameIsRequired
 	}
-	if p.Price == 0 {
+	if _, err := money.Exponent(p.Currency); err != nil {
+		return ErrInvalidCurrency
+	}
+	if p.PriceMinor == 0 {
 		return ErrPriceIsRequired
 	}
-	if p.Price < 0 {
+	if p.PriceMinor < 0 {
 		return ErrInvalidPrice
 	}
 	return nil
 }
+
+// Available is the stock that can still be reserved.
+func (p *Product) Available() int64 {
+	return p.Stock - p.Reserved
+}
+
+// Price returns the price as a decimal string in the product's currency.
+func (p *Product) Price() money.Decimal {
+	return money.Decimal(money.Format(p.PriceMinor, p.Currency))
+}
+
+// ParsePrice converts a decimal price in currency into minor units. The
+// price may not have more decimal places than the currency's exponent.
+func ParsePrice(price money.Decimal, currency string) (int64, error) {
+	if _, err := money.Exponent(currency); err != nil {
+		return 0, ErrInvalidCurrency
+	}
+	if price == "" {
+		return 0, ErrPriceIsRequired
+	}
+	minor, err := money.Parse(string(price), currency)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidPrice, err)
+	}
+	return minor, nil
+}
+
+// SetPrice parses a decimal price in currency and stores both.
+func (p *Product) SetPrice(price money.Decimal, currency string) error {
+	minor, err := ParsePrice(price, currency)
+	if err != nil {
+		return err
+	}
+	p.PriceMinor, p.Currency = minor, currency
+	return nil
+}
+
+// productJSON is Product without its methods, so the JSON methods below do
+// not recurse.
+type productJSON Product
+
+// productWire shadows the embedded PriceMinor with the decimal price.
+type productWire struct {
+	*productJSON
+	Price money.Decimal `json:"price"`
+}
+
+// MarshalJSON emits the price as a decimal string with the currency's
+// number of fraction digits.
+func (p Product) MarshalJSON() ([]byte, error) {
+	return json.Marshal(productWire{productJSON: (*productJSON)(&p), Price: p.Price()})
+}
+
+// UnmarshalJSON reads the price as a decimal string or number in the
+// document's currency.
+func (p *Product) UnmarshalJSON(data []byte) error {
+	wire := productWire{productJSON: (*productJSON)(p)}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	if wire.Price == "" && p.Currency == "" {
+		return nil
+	}
+	return p.SetPrice(wire.Price, p.Currency)
+}
@@ -1,40 +1,85 @@
 package entity
 
 import (
+	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewProduct(t *testing.T) {
-	product, err := NewProduct("Product", 10.0)
+	product, err := NewProduct("Product", 1000, "USD")
 	assert.Nil(t, err)
 	assert.NotNil(t, product)
 	assert.NotEmpty(t, product.ID)
 	assert.Equal(t, "Product", product.Name)
-	assert.Equal(t, 10.0, product.Price)
+	assert.Equal(t, int64(1000), product.PriceMinor)
+	assert.Equal(t, "USD", product.Currency)
 }
 func TestNewProductWithEmptyName(t *testing.T) {
-	p, err := NewProduct("", 10.0)
+	p, err := NewProduct("", 1000, "USD")
 	assert.Nil(t, p)
 	assert.Equal(t, ErrNameIsRequired, err)
 }
 
 func TestNewProductWithInvalidPrice(t *testing.T) {
-	p, err := NewProduct("Product", -10.0)
+	p, err := NewProduct("Product", -1000, "USD")
 	assert.Nil(t, p)
 	assert.Equal(t, ErrInvalidPrice, err)
 }
 
 func TestNewProductWith0Price(t *testing.T) {
-	p, err := NewProduct("Product", 0.0)
+	p, err := NewProduct("Product", 0, "USD")
 	assert.Nil(t, p)
 	assert.Equal(t, ErrPriceIsRequired, err)
 }
 
+func TestNewProductWithInvalidCurrency(t *testing.T) {
+	p, err := NewProduct("Product", 1000, "XYZ")
+	assert.Nil(t, p)
+	assert.Equal(t, ErrInvalidCurrency, err)
+}
+
 func TestValidate(t *testing.T) {
-	p, err := NewProduct("Product", 10.0)
+	p, err := NewProduct("Product", 1000, "USD")
 	assert.Nil(t, err)
 	assert.NotNil(t, p)
 	assert.Nil(t, p.Validate())
 }
+
+func TestProductPrice(t *testing.T) {
+	p, err := NewProduct("Product", 1050, "USD")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.50", string(p.Price()))
+
+	assert.Nil(t, p.SetPrice("1500", "JPY"))
+	assert.Equal(t, int64(1500), p.PriceMinor)
+	assert.Equal(t, "1500", string(p.Price()))
+
+	// the currency exponent limits the fraction digits
+	assert.True(t, errors.Is(p.SetPrice("10.5", "JPY"), ErrInvalidPrice))
+	assert.True(t, errors.Is(p.SetPrice("1.005", "EUR"), ErrInvalidPrice))
+	assert.Nil(t, p.SetPrice("1.005", "KWD"))
+	assert.Equal(t, ErrInvalidCurrency, p.SetPrice("1", "usd"))
+}
+
+func TestProductJSON(t *testing.T) {
+	p, err := NewProduct("Product", 1230, "EUR")
+	assert.Nil(t, err)
+	data, err := json.Marshal(p)
+	assert.Nil(t, err)
+	var fields map[string]any
+	assert.Nil(t, json.Unmarshal(data, &fields))
+	assert.Equal(t, "12.30", fields["price"])
+	assert.Equal(t, "EUR", fields["currency"])
+
+	var decoded Product
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, p.ID, decoded.ID)
+	assert.Equal(t, int64(1230), decoded.PriceMinor)
+	assert.Equal(t, "EUR", decoded.Currency)
+
+	err = json.Unmarshal([]byte(`{"price":"0.001","currency":"USD"}`), &decoded)
+	assert.True(t, errors.Is(err, ErrInvalidPrice))
+}
@@ -0,0 +1,58 @@
+package entity
+
+import (
+	"errors"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+)
+
+var ErrInvalidExpiration = errors.New("invalid expiration")
+
+// RefreshToken is a stored, single-use refresh token. Only the hash of the
+// token is persisted. Tokens rotated from the same login share a FamilyID.
+type RefreshToken struct {
+	ID        entity.ID  `json:"id"`
+	UserID    entity.ID  `json:"user_id" gorm:"index"`
+	FamilyID  entity.ID  `json:"family_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// NewRefreshToken creates a token for userID in familyID and returns it with
+// the plain token value that is handed to the client.
+func NewRefreshToken(userID, familyID entity.ID, ttl time.Duration) (*RefreshToken, string, error) {
+	if ttl <= 0 {
+		return nil, "", ErrInvalidExpiration
+	}
+	token, err := newSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	return &RefreshToken{
+		ID:        entity.NewId(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: HashRefreshToken(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}, token, nil
+}
+
+func HashRefreshToken(token string) string {
+	return hashSecret(token)
+}
+
+// IsSpent reports whether the token was already rotated or revoked; presenting
+// a spent token again means it leaked.
+func (t *RefreshToken) IsSpent() bool {
+	return t.UsedAt != nil || t.RevokedAt != nil
+}
+
+func (t *RefreshToken) IsExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
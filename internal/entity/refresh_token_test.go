@@ -0,0 +1,35 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRefreshToken(t *testing.T) {
+	userID, familyID := entity.NewId(), entity.NewId()
+	rt, token, err := NewRefreshToken(userID, familyID, time.Hour)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, userID, rt.UserID)
+	assert.Equal(t, familyID, rt.FamilyID)
+	assert.Equal(t, HashRefreshToken(token), rt.TokenHash)
+	assert.NotEqual(t, token, rt.TokenHash)
+	assert.False(t, rt.IsSpent())
+	assert.False(t, rt.IsExpired(time.Now()))
+	assert.True(t, rt.IsExpired(time.Now().Add(2*time.Hour)))
+}
+
+func TestNewRefreshTokenInvalidTTL(t *testing.T) {
+	_, _, err := NewRefreshToken(entity.NewId(), entity.NewId(), 0)
+	assert.Equal(t, ErrInvalidExpiration, err)
+}
+
+func TestRefreshTokenIsSpent(t *testing.T) {
+	rt, _, _ := NewRefreshToken(entity.NewId(), entity.NewId(), time.Hour)
+	now := time.Now()
+	rt.UsedAt = &now
+	assert.True(t, rt.IsSpent())
+}
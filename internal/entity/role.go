@@ -0,0 +1,85 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// RoleAdmin may manage users and write to the catalog.
+	RoleAdmin = "admin"
+	// RoleViewer may only read the catalog.
+	RoleViewer = "viewer"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+var validRoles = map[string]bool{
+	RoleAdmin:  true,
+	RoleViewer: true,
+}
+
+// Roles is stored as a comma separated column and serialized as a JSON array.
+type Roles []string
+
+func NewRoles(roles ...string) (Roles, error) {
+	if len(roles) == 0 {
+		return Roles{RoleViewer}, nil
+	}
+	seen := make(map[string]bool, len(roles))
+	result := make(Roles, 0, len(roles))
+	for _, role := range roles {
+		if !validRoles[role] {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+		}
+		if !seen[role] {
+			seen[role] = true
+			result = append(result, role)
+		}
+	}
+	return result, nil
+}
+
+func (r Roles) Has(role string) bool {
+	for _, have := range r {
+		if have == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Roles) HasAny(roles ...string) bool {
+	for _, role := range roles {
+		if r.Has(role) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Roles) Value() (driver.Value, error) {
+	return strings.Join(r, ","), nil
+}
+
+func (r *Roles) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("unsupported roles value %T", src)
+	}
+	*r = nil
+	for _, role := range strings.Split(s, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			*r = append(*r, role)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRoles(t *testing.T) {
+	roles, err := NewRoles()
+	assert.Nil(t, err)
+	assert.Equal(t, Roles{RoleViewer}, roles)
+
+	roles, err = NewRoles(RoleAdmin, RoleViewer, RoleAdmin)
+	assert.Nil(t, err)
+	assert.Equal(t, Roles{RoleAdmin, RoleViewer}, roles)
+
+	_, err = NewRoles("root")
+	assert.True(t, errors.Is(err, ErrInvalidRole))
+}
+
+func TestRolesHasAny(t *testing.T) {
+	roles := Roles{RoleViewer}
+	assert.True(t, roles.Has(RoleViewer))
+	assert.False(t, roles.Has(RoleAdmin))
+	assert.True(t, roles.HasAny(RoleAdmin, RoleViewer))
+	assert.False(t, roles.HasAny(RoleAdmin))
+}
+
+func TestRolesScanValue(t *testing.T) {
+	value, err := Roles{RoleAdmin, RoleViewer}.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "admin,viewer", value)
+
+	var roles Roles
+	assert.Nil(t, roles.Scan([]byte("admin, viewer")))
+	assert.Equal(t, Roles{RoleAdmin, RoleViewer}, roles)
+	assert.Nil(t, roles.Scan(""))
+	assert.Empty(t, roles)
+}
+
+func TestUserSetRoles(t *testing.T) {
+	user, err := NewUser("John Doe", "j@j.com", "123456")
+	assert.Nil(t, err)
+	assert.Equal(t, Roles{RoleViewer}, user.Roles)
+	assert.Nil(t, user.SetRoles(RoleAdmin))
+	assert.True(t, user.Roles.Has(RoleAdmin))
+	assert.NotNil(t, user.SetRoles("root"))
+}
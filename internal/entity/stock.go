@@ -0,0 +1,109 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+)
+
+// Reason codes for stock movements. StockSold is recorded when a
+// reservation is committed and cannot be used for manual adjustments.
+const (
+	StockReceived   = "received"
+	StockReturned   = "returned"
+	StockDamaged    = "damaged"
+	StockLost       = "lost"
+	StockCorrection = "correction"
+	StockSold       = "sold"
+)
+
+// Reservation statuses. Only pending reservations hold stock.
+const (
+	ReservationPending   = "pending"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired"
+)
+
+var (
+	ErrInvalidQuantity    = errors.New("quantity must be positive")
+	ErrInvalidDelta       = errors.New("delta must not be zero")
+	ErrInvalidStockReason = errors.New("invalid stock reason")
+)
+
+// adjustReasons are the reasons accepted for manual adjustments.
+var adjustReasons = map[string]bool{
+	StockReceived:   true,
+	StockReturned:   true,
+	StockDamaged:    true,
+	StockLost:       true,
+	StockCorrection: true,
+}
+
+// StockMovement records one change to a product's quantity on hand.
+type StockMovement struct {
+	ID            entity.ID `json:"id"`
+	ProductID     entity.ID `json:"product_id" gorm:"index"`
+	Delta         int64     `json:"delta"`
+	Reason        string    `json:"reason"`
+	Note          string    `json:"note,omitempty"`
+	ReservationID string    `json:"reservation_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// NewStockAdjustment creates a manual movement with one of the adjustment
+// reason codes.
+func NewStockAdjustment(productID entity.ID, delta int64, reason, note string) (*StockMovement, error) {
+	if delta == 0 {
+		return nil, ErrInvalidDelta
+	}
+	if !adjustReasons[reason] {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidStockReason, reason)
+	}
+	return &StockMovement{
+		ID:        entity.NewId(),
+		ProductID: productID,
+		Delta:     delta,
+		Reason:    reason,
+		Note:      note,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// Reservation holds Quantity units of a product for an order until it is
+// committed, released or ExpiresAt passes.
+type Reservation struct {
+	ID        entity.ID `json:"id"`
+	ProductID entity.ID `json:"product_id" gorm:"index"`
+	Quantity  int64     `json:"quantity"`
+	Status    string    `json:"status" gorm:"index:idx_reservations_status_expires_at"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index:idx_reservations_status_expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewReservation(productID entity.ID, quantity int64, ttl time.Duration) (*Reservation, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+	if ttl <= 0 {
+		return nil, ErrInvalidExpiration
+	}
+	now := time.Now()
+	return &Reservation{
+		ID:        entity.NewId(),
+		ProductID: productID,
+		Quantity:  quantity,
+		Status:    ReservationPending,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// Open reports whether the reservation still holds stock at now.
+func (r *Reservation) Open(now time.Time) bool {
+	return r.Status == ReservationPending && now.Before(r.ExpiresAt)
+}
@@ -0,0 +1,35 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStockAdjustment(t *testing.T) {
+	m, err := NewStockAdjustment(entity.NewId(), -3, StockDamaged, "dropped")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-3), m.Delta)
+	assert.Equal(t, StockDamaged, m.Reason)
+
+	_, err = NewStockAdjustment(entity.NewId(), 0, StockReceived, "")
+	assert.Equal(t, ErrInvalidDelta, err)
+	_, err = NewStockAdjustment(entity.NewId(), 1, StockSold, "")
+	assert.True(t, errors.Is(err, ErrInvalidStockReason))
+}
+
+func TestNewReservation(t *testing.T) {
+	r, err := NewReservation(entity.NewId(), 2, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, ReservationPending, r.Status)
+	assert.True(t, r.Open(time.Now()))
+	assert.False(t, r.Open(time.Now().Add(2*time.Minute)))
+
+	_, err = NewReservation(entity.NewId(), 0, time.Minute)
+	assert.Equal(t, ErrInvalidQuantity, err)
+	_, err = NewReservation(entity.NewId(), 1, 0)
+	assert.Equal(t, ErrInvalidExpiration, err)
+}
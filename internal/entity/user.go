@@ -3,6 +3,7 @@ package entity
 import (
 	"errors"
 	"regexp"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -12,8 +13,13 @@ import (
 type User struct {
 	ID       entity.ID `json:"id"`
 	Name     string    `json:"name"`
-	Email    string    `json:"email"`
+	Email    string    `json:"email" gorm:"uniqueIndex"`
 	Password string    `json:"-"`
+	Roles    Roles     `json:"roles" gorm:"size:255"`
+	// FailedLogins counts consecutive failed logins; LockedUntil is set
+	// once they reach the lockout threshold.
+	FailedLogins int        `json:"-" gorm:"not null;default:0"`
+	LockedUntil  *time.Time `json:"-"`
 }
 
 var (
@@ -27,25 +33,88 @@ func NewUser(name, email, password string) (*User, error) {
 	if password == "" {
 		return nil, ErrInvalidPassword
 	}
-	if name == "" {
-		return nil, ErrInvalidName
+	roles, _ := NewRoles()
+	user := &User{
+		ID:    entity.NewId(),
+		Name:  name,
+		Email: email,
+		Roles: roles,
 	}
-	if email == "" || !emailRegex.MatchString(email) {
-		return nil, ErrInvalidEmail
+	if err := user.Validate(); err != nil {
+		return nil, err
+	}
+	if err := user.SetPassword(password); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Validate checks the name and email, which are the fields users can edit.
+func (u *User) Validate() error {
+	if u.Name == "" {
+		return ErrInvalidName
+	}
+	if u.Email == "" || !emailRegex.MatchString(u.Email) {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// SetPassword replaces the password with a bcrypt hash of password.
+func (u *User) SetPassword(password string) error {
+	if password == "" {
+		return ErrInvalidPassword
 	}
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &User{
-		ID:       entity.NewId(),
-		Name:     name,
-		Email:    email,
-		Password: string(hash),
-	}, nil
+	u.Password = string(hash)
+	return nil
+}
+
+// SetRoles replaces the user's roles, defaulting to RoleViewer when none are given.
+func (u *User) SetRoles(roles ...string) error {
+	r, err := NewRoles(roles...)
+	if err != nil {
+		return err
+	}
+	u.Roles = r
+	return nil
 }
 
 func (u *User) ValidatePassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	return err == nil
 }
+
+// IsLocked reports whether failed logins have locked the account at now.
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// LockoutPolicy locks an account once Threshold consecutive logins have
+// failed. The first lock lasts Duration and each further failure doubles
+// it, up to MaxDuration; with a zero MaxDuration locks do not grow. A zero
+// Threshold disables lockout.
+type LockoutPolicy struct {
+	Threshold   int
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// LockDuration returns how long to lock an account after failures
+// consecutive failed logins, or zero when it should stay unlocked.
+func (p LockoutPolicy) LockDuration(failures int) time.Duration {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return 0
+	}
+	d := p.Duration
+	for i := p.Threshold; i < failures && d < p.MaxDuration; i++ {
+		d *= 2
+	}
+	if p.MaxDuration > 0 && d > p.MaxDuration {
+		d = p.MaxDuration
+	}
+	return d
+}
@@ -3,6 +3,7 @@ package entity
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -55,3 +56,46 @@ func TestValidatePassword(t *testing.T) {
 	assert.False(t, user.ValidatePassword("654321"))
 	assert.NotEqual(t, "123456", user.Password)
 }
+
+func TestLockoutPolicy(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 3, Duration: time.Minute, MaxDuration: 5 * time.Minute}
+	for failures, want := range map[int]time.Duration{
+		0: 0,
+		2: 0,
+		3: time.Minute,
+		4: 2 * time.Minute,
+		5: 4 * time.Minute,
+		6: 5 * time.Minute,
+		9: 5 * time.Minute,
+	} {
+		assert.Equal(t, want, policy.LockDuration(failures), failures)
+	}
+	assert.Equal(t, time.Duration(0), LockoutPolicy{}.LockDuration(10))
+	assert.Equal(t, time.Minute, LockoutPolicy{Threshold: 1, Duration: time.Minute}.LockDuration(10))
+
+	user := &User{}
+	assert.False(t, user.IsLocked(time.Now()))
+	until := time.Now().Add(time.Minute)
+	user.LockedUntil = &until
+	assert.True(t, user.IsLocked(time.Now()))
+	assert.False(t, user.IsLocked(until))
+}
+
+func TestUserSetPassword(t *testing.T) {
+	user, _ := NewUser("John Doe", "j@j.com", "123456")
+	assert.Nil(t, user.SetPassword("654321"))
+	assert.True(t, user.ValidatePassword("654321"))
+	assert.False(t, user.ValidatePassword("123456"))
+	assert.Equal(t, ErrInvalidPassword, user.SetPassword(""))
+	assert.NotNil(t, user.SetPassword(strings.Repeat("a", 73)))
+	assert.True(t, user.ValidatePassword("654321"))
+}
+
+func TestUserValidate(t *testing.T) {
+	user, _ := NewUser("John Doe", "j@j.com", "123456")
+	assert.Nil(t, user.Validate())
+	user.Email = "j@j"
+	assert.Equal(t, ErrInvalidEmail, user.Validate())
+	user.Name = ""
+	assert.Equal(t, ErrInvalidName, user.Validate())
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"gorm.io/gorm"
+)
+
+// AuditFilter narrows an audit search. Empty fields do not filter.
+type AuditFilter struct {
+	EntityType string
+	EntityID   string
+	Actor      string
+}
+
+type AuditQuery struct {
+	Page   int
+	Limit  int
+	Filter AuditFilter
+}
+
+func (f AuditFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.EntityType != "" {
+		db = db.Where("entity_type = ?", f.EntityType)
+	}
+	if f.EntityID != "" {
+		db = db.Where("entity_id = ?", f.EntityID)
+	}
+	if f.Actor != "" {
+		db = db.Where("actor = ?", f.Actor)
+	}
+	return db
+}
+
+type AuditRepository struct {
+	DB *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{
+		DB: db,
+	}
+}
+
+func (r *AuditRepository) Create(ctx context.Context, entry *entity.AuditEntry) error {
+	return translateError(r.DB.WithContext(ctx).Create(entry).Error)
+}
+
+// Search lists entries newest first.
+func (r *AuditRepository) Search(ctx context.Context, query AuditQuery) ([]entity.AuditEntry, error) {
+	var entries []entity.AuditEntry
+	db := query.Filter.apply(r.DB.WithContext(ctx)).Order("created_at desc").Order("id asc")
+	if query.Page != 0 && query.Limit != 0 {
+		db = db.Limit(query.Limit).Offset((query.Page - 1) * query.Limit)
+	}
+	err := db.Find(&entries).Error
+	return entries, translateError(err)
+}
+
+func (r *AuditRepository) Count(ctx context.Context, filter AuditFilter) (int64, error) {
+	var count int64
+	err := filter.apply(r.DB.WithContext(ctx).Model(&entity.AuditEntry{})).Count(&count).Error
+	return count, translateError(err)
+}
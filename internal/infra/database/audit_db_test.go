@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAuditSearch(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.AuditEntry{})
+
+	ctx := context.Background()
+	auditRepository := NewAuditRepository(db)
+	product, _ := entity.NewProduct("Product", 1000, "USD")
+	for i, action := range []string{entity.AuditCreate, entity.AuditUpdate, entity.AuditDelete} {
+		entry, err := entity.NewAuditEntry("admin", action, "product", product.ID.String(), nil, product, "req")
+		assert.Nil(t, err)
+		entry.CreatedAt = entry.CreatedAt.Add(time.Duration(i) * time.Second)
+		assert.Nil(t, auditRepository.Create(ctx, entry))
+	}
+	other, _ := entity.NewAuditEntry("viewer", entity.AuditCreate, "user", "u1", nil, nil, "req")
+	assert.Nil(t, auditRepository.Create(ctx, other))
+
+	filter := AuditFilter{EntityType: "product", EntityID: product.ID.String()}
+	entries, err := auditRepository.Search(ctx, AuditQuery{Page: 1, Limit: 2, Filter: filter})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, entity.AuditDelete, entries[0].Action)
+	assert.Contains(t, string(entries[0].After), `"name":"Product"`)
+
+	count, err := auditRepository.Count(ctx, filter)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+
+	count, err = auditRepository.Count(ctx, AuditFilter{Actor: "viewer"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
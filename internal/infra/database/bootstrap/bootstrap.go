@@ -0,0 +1,118 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	DriverSQLite       = "sqlite"
+	DriverSQLiteMemory = "sqlite-memory"
+	DriverPostgres     = "postgres"
+	DriverMySQL        = "mysql"
+)
+
+var (
+	ErrUnknownDriver  = errors.New("unknown database driver")
+	ErrDBNameRequired = errors.New("database name is required")
+)
+
+// Config holds the DB_* settings needed to open a connection.
+type Config struct {
+	Driver   string
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+	// SSLMode is the Postgres sslmode, such as require or verify-full.
+	SSLMode string
+}
+
+// Dialector returns the GORM dialector matching cfg.Driver.
+func Dialector(cfg Config) (gorm.Dialector, error) {
+	switch strings.ToLower(cfg.Driver) {
+	case DriverSQLite:
+		if cfg.Name == "" {
+			return nil, ErrDBNameRequired
+		}
+		return sqlite.Open(SQLiteDSN(cfg.Name)), nil
+	case DriverSQLiteMemory:
+		return sqlite.Open("file::memory:"), nil
+	case DriverPostgres:
+		if cfg.Name == "" {
+			return nil, ErrDBNameRequired
+		}
+		return postgres.Open(PostgresDSN(cfg)), nil
+	case DriverMySQL:
+		if cfg.Name == "" {
+			return nil, ErrDBNameRequired
+		}
+		return mysql.Open(MySQLDSN(cfg)), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDriver, cfg.Driver)
+	}
+}
+
+// SQLiteDSN makes concurrent writers to a SQLite file wait for each other
+// instead of failing with "database is locked". Names that already carry
+// options are left alone.
+func SQLiteDSN(name string) string {
+	if strings.Contains(name, "?") {
+		return name
+	}
+	return name + "?_busy_timeout=5000&_txlock=immediate"
+}
+
+// PostgresDSN builds a postgres:// URL for pgx, escaping each setting so
+// passwords may hold any character. An empty SSLMode means require.
+func PostgresDSN(cfg Config) string {
+	sslMode := cfg.SSLMode
+	if sslMode == "" {
+		sslMode = "require"
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:     "/" + cfg.Name,
+		RawQuery: url.Values{"sslmode": {sslMode}}.Encode(),
+	}
+	return dsn.String()
+}
+
+// MySQLDSN builds a go-sql-driver/mysql connection string.
+func MySQLDSN(cfg Config) string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Name)
+}
+
+// Open picks the dialector for cfg and opens the connection.
+func Open(cfg Config) (*gorm.DB, error) {
+	dialector, err := Dialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect database (%s): %w", cfg.Driver, err)
+	}
+	if strings.ToLower(cfg.Driver) == DriverSQLiteMemory {
+		// each connection to file::memory: gets its own empty database, so
+		// keep one open connection that sees the migrated schema
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
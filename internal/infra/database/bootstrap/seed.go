@@ -0,0 +1,45 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+)
+
+var (
+	ErrAdminNotConfigured = errors.New("no admin user exists and ADMIN_EMAIL/ADMIN_PASSWORD are not set")
+	ErrAdminEmailTaken    = errors.New("no admin user exists and ADMIN_EMAIL belongs to a user who is not an admin")
+)
+
+// SeedAdmin creates the configured admin when the database has no admin yet,
+// so a fresh install can obtain its first token. It reports whether a user
+// was created.
+func SeedAdmin(ctx context.Context, users database.UserRepositoryInterface, name, email, password string) (bool, error) {
+	count, err := users.CountByRole(ctx, entity.RoleAdmin)
+	if err != nil || count > 0 {
+		return false, err
+	}
+	if email == "" || password == "" {
+		return false, ErrAdminNotConfigured
+	}
+	if name == "" {
+		name = "Admin"
+	}
+	user, err := entity.NewUser(name, email, password)
+	if err != nil {
+		return false, err
+	}
+	if err := user.SetRoles(entity.RoleAdmin); err != nil {
+		return false, err
+	}
+	err = users.Create(ctx, user)
+	if errors.Is(err, database.ErrConflict) {
+		return false, ErrAdminEmailTaken
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,53 @@
+package bootstrap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func newUserRepository() *database.UserRepository {
+	db, err := Open(Config{Driver: DriverSQLiteMemory})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	db.AutoMigrate(&entity.User{})
+	return database.NewUserRepository(db)
+}
+
+func TestSeedAdmin(t *testing.T) {
+	users := newUserRepository()
+
+	created, err := SeedAdmin(context.Background(), users, "", "admin@j.com", "123456")
+	assert.Nil(t, err)
+	assert.True(t, created)
+
+	admin, err := users.FindByEmail(context.Background(), "admin@j.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "Admin", admin.Name)
+	assert.True(t, admin.Roles.Has(entity.RoleAdmin))
+	assert.True(t, admin.ValidatePassword("123456"))
+
+	created, err = SeedAdmin(context.Background(), users, "", "other@j.com", "123456")
+	assert.Nil(t, err)
+	assert.False(t, created)
+}
+
+func TestSeedAdminEmailTaken(t *testing.T) {
+	users := newUserRepository()
+	viewer, _ := entity.NewUser("John Doe", "admin@j.com", "123456")
+	assert.Nil(t, users.Create(context.Background(), viewer))
+
+	created, err := SeedAdmin(context.Background(), users, "", "admin@j.com", "654321")
+	assert.False(t, created)
+	assert.Equal(t, ErrAdminEmailTaken, err)
+}
+
+func TestSeedAdminNotConfigured(t *testing.T) {
+	created, err := SeedAdmin(context.Background(), newUserRepository(), "", "", "")
+	assert.False(t, created)
+	assert.Equal(t, ErrAdminNotConfigured, err)
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+	"gorm.io/gorm"
+)
+
+// categorySubtree selects the id of a category and all of its descendants.
+// Recursive CTEs work in SQLite, PostgreSQL and MySQL 8.
+const categorySubtree = `WITH RECURSIVE subtree(id) AS (
+	SELECT ?
+	UNION ALL
+	SELECT categories.id FROM categories JOIN subtree ON categories.parent_id = subtree.id
+) SELECT id FROM subtree`
+
+// categoryAncestors selects the id of a category and all of its ancestors.
+const categoryAncestors = `WITH RECURSIVE ancestors(id, parent_id) AS (
+	SELECT id, parent_id FROM categories WHERE id = ?
+	UNION ALL
+	SELECT categories.id, categories.parent_id FROM categories JOIN ancestors ON categories.id = ancestors.parent_id
+) SELECT id FROM ancestors`
+
+type CategoryRepository struct {
+	DB *gorm.DB
+}
+
+func NewCategoryRepository(db *gorm.DB) *CategoryRepository {
+	return &CategoryRepository{
+		DB: db,
+	}
+}
+
+// Create stores category. Its parent, if any, must exist.
+func (r *CategoryRepository) Create(ctx context.Context, category *entity.Category) error {
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkParent(tx, category); err != nil {
+			return err
+		}
+		return tx.Create(category).Error
+	})
+	return translateError(err)
+}
+
+func (r *CategoryRepository) FindByID(ctx context.Context, id string) (*entity.Category, error) {
+	if id == "" {
+		return nil, ErrInvalidInput
+	}
+	var category entity.Category
+	if err := r.DB.WithContext(ctx).Where("id = ?", id).First(&category).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &category, nil
+}
+
+// FindAll lists every category by name. Clients build the tree from
+// parent_id.
+func (r *CategoryRepository) FindAll(ctx context.Context) ([]entity.Category, error) {
+	var categories []entity.Category
+	err := r.DB.WithContext(ctx).Order("name asc").Order("id asc").Find(&categories).Error
+	return categories, translateError(err)
+}
+
+// FindChildren lists the direct subcategories of parentID by name, or the
+// root categories when parentID is empty.
+func (r *CategoryRepository) FindChildren(ctx context.Context, parentID string) ([]entity.Category, error) {
+	var categories []entity.Category
+	db := r.DB.WithContext(ctx)
+	if parentID == "" {
+		db = db.Where("parent_id IS NULL")
+	} else {
+		db = db.Where("parent_id = ?", parentID)
+	}
+	err := db.Order("name asc").Order("id asc").Find(&categories).Error
+	return categories, translateError(err)
+}
+
+// Update renames or moves category. Moving it below one of its own
+// descendants returns ErrCategoryCycle.
+func (r *CategoryRepository) Update(ctx context.Context, category *entity.Category) (int64, error) {
+	if category == nil || category.ID == (pkgentity.ID{}) {
+		return 0, ErrInvalidInput
+	}
+	var rows int64
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkParent(tx, category); err != nil {
+			return err
+		}
+		if category.ParentID != nil {
+			var ancestors []string
+			if err := tx.Raw(categoryAncestors, *category.ParentID).Scan(&ancestors).Error; err != nil {
+				return err
+			}
+			for _, id := range ancestors {
+				if id == category.ID.String() {
+					return ErrCategoryCycle
+				}
+			}
+		}
+		category.UpdatedAt = time.Now()
+		s := tx.Model(&entity.Category{}).Where("id = ?", category.ID).Updates(map[string]any{
+			"name":       category.Name,
+			"parent_id":  category.ParentID,
+			"updated_at": category.UpdatedAt,
+		})
+		rows = s.RowsAffected
+		return s.Error
+	})
+	return rows, translateError(err)
+}
+
+// Delete removes a category without subcategories and unassigns its
+// products.
+func (r *CategoryRepository) Delete(ctx context.Context, id string) (int64, error) {
+	if id == "" {
+		return 0, ErrInvalidInput
+	}
+	var rows int64
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Model(&entity.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return ErrCategoryHasChildren
+		}
+		if err := tx.Where("category_id = ?", id).Delete(&entity.ProductCategory{}).Error; err != nil {
+			return err
+		}
+		s := tx.Where("id = ?", id).Delete(&entity.Category{})
+		rows = s.RowsAffected
+		return s.Error
+	})
+	return rows, translateError(err)
+}
+
+// SetProductCategories replaces the categories of a product. Unknown
+// category ids return ErrInvalidInput.
+func (r *CategoryRepository) SetProductCategories(ctx context.Context, productID string, categoryIDs []string) error {
+	id, err := pkgentity.ParseId(productID)
+	if err != nil {
+		return ErrInvalidInput
+	}
+	assignments := make([]entity.ProductCategory, 0, len(categoryIDs))
+	seen := make(map[pkgentity.ID]bool, len(categoryIDs))
+	for _, s := range categoryIDs {
+		categoryID, err := pkgentity.ParseId(s)
+		if err != nil {
+			return fmt.Errorf("%w: invalid category id %q", ErrInvalidInput, s)
+		}
+		if !seen[categoryID] {
+			seen[categoryID] = true
+			assignments = append(assignments, entity.ProductCategory{ProductID: id, CategoryID: categoryID})
+		}
+	}
+	err = r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(assignments) > 0 {
+			ids := make([]pkgentity.ID, 0, len(assignments))
+			for _, a := range assignments {
+				ids = append(ids, a.CategoryID)
+			}
+			var found int64
+			if err := tx.Model(&entity.Category{}).Where("id IN ?", ids).Count(&found).Error; err != nil {
+				return err
+			}
+			if found != int64(len(ids)) {
+				return fmt.Errorf("%w: unknown category", ErrInvalidInput)
+			}
+		}
+		if err := tx.Where("product_id = ?", id).Delete(&entity.ProductCategory{}).Error; err != nil {
+			return err
+		}
+		if len(assignments) == 0 {
+			return nil
+		}
+		return tx.Create(&assignments).Error
+	})
+	return translateError(err)
+}
+
+// FindProductCategories lists the categories of a product by name.
+func (r *CategoryRepository) FindProductCategories(ctx context.Context, productID string) ([]entity.Category, error) {
+	var categories []entity.Category
+	err := r.DB.WithContext(ctx).
+		Joins("JOIN product_categories ON product_categories.category_id = categories.id").
+		Where("product_categories.product_id = ?", productID).
+		Order("categories.name asc").
+		Find(&categories).Error
+	return categories, translateError(err)
+}
+
+// checkParent returns ErrInvalidInput if category names a parent that does
+// not exist.
+func checkParent(tx *gorm.DB, category *entity.Category) error {
+	if category.ParentID == nil {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&entity.Category{}).Where("id = ?", *category.ParentID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: unknown parent category", ErrInvalidInput)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// categoryTree creates Clothing > Shirts > Polos and a separate Shoes root.
+func categoryTree(t *testing.T, categoryRepository *CategoryRepository) (clothing, shirts, polos, shoes *entity.Category) {
+	clothing, _ = entity.NewCategory("Clothing", nil)
+	shirts, _ = entity.NewCategory("Shirts", &clothing.ID)
+	polos, _ = entity.NewCategory("Polos", &shirts.ID)
+	shoes, _ = entity.NewCategory("Shoes", nil)
+	for _, c := range []*entity.Category{clothing, shirts, polos, shoes} {
+		assert.Nil(t, categoryRepository.Create(context.Background(), c))
+	}
+	return clothing, shirts, polos, shoes
+}
+
+func TestCategoryTree(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.Category{}, &entity.ProductCategory{})
+
+	categoryRepository := NewCategoryRepository(db)
+	clothing, shirts, polos, _ := categoryTree(t, categoryRepository)
+
+	missing := pkgentity.NewId()
+	orphan, _ := entity.NewCategory("Orphan", &missing)
+	assert.True(t, errors.Is(categoryRepository.Create(context.Background(), orphan), ErrInvalidInput))
+
+	all, err := categoryRepository.FindAll(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, all, 4)
+
+	roots, err := categoryRepository.FindChildren(context.Background(), "")
+	assert.Nil(t, err)
+	assert.Len(t, roots, 2)
+	assert.Equal(t, "Clothing", roots[0].Name)
+	children, err := categoryRepository.FindChildren(context.Background(), clothing.ID.String())
+	assert.Nil(t, err)
+	assert.Len(t, children, 1)
+	assert.Equal(t, shirts.ID, children[0].ID)
+
+	// Clothing cannot move below its own grandchild
+	clothing.ParentID = &polos.ID
+	_, err = categoryRepository.Update(context.Background(), clothing)
+	assert.Equal(t, ErrCategoryCycle, err)
+
+	polos.ParentID, polos.Name = nil, "Polo Shirts"
+	rows, err := categoryRepository.Update(context.Background(), polos)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rows)
+	stored, err := categoryRepository.FindByID(context.Background(), polos.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, "Polo Shirts", stored.Name)
+	assert.Nil(t, stored.ParentID)
+
+	_, err = categoryRepository.Delete(context.Background(), clothing.ID.String())
+	assert.Equal(t, ErrCategoryHasChildren, err)
+	rows, err = categoryRepository.Delete(context.Background(), shirts.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rows)
+}
+
+func TestSearchProductsByCategoryAndTag(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.Product{}, &entity.Category{}, &entity.ProductCategory{}, &entity.ProductTag{})
+
+	productRepository := NewProductRepository(db)
+	categoryRepository := NewCategoryRepository(db)
+	tagRepository := NewTagRepository(db)
+	clothing, shirts, polos, shoes := categoryTree(t, categoryRepository)
+
+	products := map[string]*entity.Product{}
+	for _, name := range []string{"Tee", "Polo", "Sneaker"} {
+		products[name], _ = entity.NewProduct(name, 1000, "USD")
+		assert.Nil(t, productRepository.Create(context.Background(), products[name]))
+	}
+	assign := func(name string, categories ...*entity.Category) {
+		var ids []string
+		for _, c := range categories {
+			ids = append(ids, c.ID.String())
+		}
+		assert.Nil(t, categoryRepository.SetProductCategories(context.Background(), products[name].ID.String(), ids))
+	}
+	assign("Tee", shirts)
+	assign("Polo", polos, shirts)
+	assign("Sneaker", shoes)
+	assert.Nil(t, tagRepository.SetProductTags(context.Background(), products["Tee"].ID.String(), []string{"cotton", "sale"}))
+	assert.Nil(t, tagRepository.SetProductTags(context.Background(), products["Polo"].ID.String(), []string{"cotton"}))
+
+	search := func(filter ProductFilter) []string {
+		found, err := productRepository.Search(context.Background(), ProductQuery{Filter: filter, Sort: []SortField{{Field: "name"}}})
+		assert.Nil(t, err)
+		var names []string
+		for _, p := range found {
+			names = append(names, p.Name)
+		}
+		return names
+	}
+	assert.Empty(t, search(ProductFilter{CategoryID: clothing.ID.String()}))
+	assert.Equal(t, []string{"Polo", "Tee"}, search(ProductFilter{CategoryID: clothing.ID.String(), IncludeSubcategories: true}))
+	assert.Equal(t, []string{"Polo"}, search(ProductFilter{CategoryID: polos.ID.String()}))
+	assert.Equal(t, []string{"Polo", "Tee"}, search(ProductFilter{Tags: []string{"cotton"}}))
+	assert.Equal(t, []string{"Tee"}, search(ProductFilter{Tags: []string{"cotton", "sale"}}))
+	assert.Equal(t, []string{"Tee"}, search(ProductFilter{CategoryID: clothing.ID.String(), IncludeSubcategories: true, Tags: []string{"sale"}}))
+
+	categories, err := categoryRepository.FindProductCategories(context.Background(), products["Polo"].ID.String())
+	assert.Nil(t, err)
+	assert.Len(t, categories, 2)
+	tags, err := tagRepository.FindProductTags(context.Background(), products["Tee"].ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cotton", "sale"}, tags)
+
+	err = categoryRepository.SetProductCategories(context.Background(), products["Tee"].ID.String(), []string{pkgentity.NewId().String()})
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+
+	// purging a product drops its assignments
+	tee := products["Tee"]
+	_, err = productRepository.Delete(context.Background(), tee.ID.String(), 0)
+	assert.Nil(t, err)
+	_, err = productRepository.Purge(context.Background(), tee.ID.String())
+	assert.Nil(t, err)
+	var count int64
+	db.Model(&entity.ProductTag{}).Where("product_id = ?", tee.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+	db.Model(&entity.ProductCategory{}).Where("product_id = ?", tee.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotFound     = errors.New("record not found")
+	ErrConflict     = errors.New("record conflicts with an existing one")
+	ErrInvalidInput = errors.New("invalid input")
+
+	ErrVersionMismatch = errors.New("record was modified by another request")
+
+	ErrInsufficientStock  = errors.New("insufficient stock")
+	ErrReservationClosed  = errors.New("reservation is no longer pending")
+	ErrReservationExpired = errors.New("reservation has expired")
+
+	ErrCategoryCycle       = errors.New("category cannot be moved below itself")
+	ErrCategoryHasChildren = errors.New("category has subcategories")
+)
+
+// translateError converts GORM errors into the repository error set so that
+// callers never depend on the ORM. Unknown errors are returned unchanged.
+func translateError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrConflict
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return ErrInvalidInput
+	default:
+		return err
+	}
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"gorm.io/gorm"
+)
+
+type IdempotencyRepository struct {
+	DB *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{
+		DB: db,
+	}
+}
+
+// Create stores a pending record. It returns ErrConflict when the scope
+// already holds the key, which makes it the lock a request takes on its key.
+func (r *IdempotencyRepository) Create(ctx context.Context, record *entity.IdempotencyRecord) error {
+	return translateError(r.DB.WithContext(ctx).Create(record).Error)
+}
+
+func (r *IdempotencyRepository) Find(ctx context.Context, scope, key string) (*entity.IdempotencyRecord, error) {
+	var record entity.IdempotencyRecord
+	// A map condition lets GORM quote key, which is reserved in MySQL.
+	if err := r.DB.WithContext(ctx).Where(map[string]any{"scope": scope, "key": key}).First(&record).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &record, nil
+}
+
+// Complete stores the response of a pending record.
+func (r *IdempotencyRepository) Complete(ctx context.Context, record *entity.IdempotencyRecord) error {
+	err := r.DB.WithContext(ctx).Model(&entity.IdempotencyRecord{}).Where("id = ?", record.ID).
+		Updates(map[string]any{"status": record.Status, "header": record.Header, "body": record.Body}).Error
+	return translateError(err)
+}
+
+func (r *IdempotencyRepository) Delete(ctx context.Context, id string) error {
+	return translateError(r.DB.WithContext(ctx).Where("id = ?", id).Delete(&entity.IdempotencyRecord{}).Error)
+}
+
+// DeleteExpired removes records that expired before now.
+func (r *IdempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	s := r.DB.WithContext(ctx).Where("expires_at <= ?", now).Delete(&entity.IdempotencyRecord{})
+	return s.RowsAffected, translateError(s.Error)
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestIdempotencyRepository(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	db.AutoMigrate(&entity.IdempotencyRecord{})
+	ctx := context.Background()
+	repository := NewIdempotencyRepository(db)
+
+	record, _ := entity.NewIdempotencyRecord("user:1", "key", "hash", time.Hour)
+	assert.Nil(t, repository.Create(ctx, record))
+	again, _ := entity.NewIdempotencyRecord("user:1", "key", "other", time.Hour)
+	assert.ErrorIs(t, repository.Create(ctx, again), ErrConflict)
+	other, _ := entity.NewIdempotencyRecord("user:2", "key", "hash", time.Minute)
+	assert.Nil(t, repository.Create(ctx, other))
+
+	record.Status, record.Header, record.Body = 201, `{"Location":["/products/1"]}`, []byte("{}")
+	assert.Nil(t, repository.Complete(ctx, record))
+	found, err := repository.Find(ctx, "user:1", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, 201, found.Status)
+	assert.Equal(t, "hash", found.RequestHash)
+	assert.Equal(t, []byte("{}"), found.Body)
+
+	n, err := repository.DeleteExpired(ctx, time.Now().Add(30*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = repository.Find(ctx, "user:2", "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.Nil(t, repository.Delete(ctx, record.ID.String()))
+	_, err = repository.Find(ctx, "user:1", "key")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
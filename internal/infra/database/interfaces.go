@@ -1,16 +1,101 @@
 package database
 
-import "github.com/antoniofmoliveira/apis/internal/entity"
+import (
+	"context"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+)
 
 type UserRepositoryInterface interface {
-	Create(user *entity.User) error
-	FindByEmail(email string) (*entity.User, error)
+	Create(ctx context.Context, user *entity.User) error
+	FindByEmail(ctx context.Context, email string) (*entity.User, error)
+	FindByID(ctx context.Context, id string) (*entity.User, error)
+	CountByRole(ctx context.Context, role string) (int64, error)
+	Update(ctx context.Context, user *entity.User) (int64, error)
+	UpdatePassword(ctx context.Context, id, hash string) (int64, error)
+	Delete(ctx context.Context, id string) (int64, error)
+	RecordFailedLogin(ctx context.Context, id string, policy entity.LockoutPolicy, now time.Time) (*time.Time, error)
+	ResetFailedLogins(ctx context.Context, id string) error
 }
 
 type ProductRepositoryInterface interface {
-	Create(product *entity.Product) error
-	FindAll(page, limit int, sort string) ([]entity.Product, error)
-	FindByID(id string) (*entity.Product, error)
-	Update(product *entity.Product) (int64, error)
-	Delete(id string) (int64, error)
+	Create(ctx context.Context, product *entity.Product) error
+	FindAll(ctx context.Context, page, limit int, sort string) ([]entity.Product, error)
+	Search(ctx context.Context, query ProductQuery) ([]entity.Product, error)
+	SearchAfter(ctx context.Context, filter ProductFilter, after *ProductCursor, limit int) ([]entity.Product, error)
+	Count(ctx context.Context, filter ProductFilter) (int64, error)
+	FindByID(ctx context.Context, id string) (*entity.Product, error)
+	Update(ctx context.Context, product *entity.Product) (int64, error)
+	Delete(ctx context.Context, id string, version int64) (int64, error)
+	Restore(ctx context.Context, id string) (int64, error)
+	Purge(ctx context.Context, id string) (int64, error)
+	PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+type StockRepositoryInterface interface {
+	Adjust(ctx context.Context, movement *entity.StockMovement) error
+	Reserve(ctx context.Context, reservation *entity.Reservation) error
+	FindReservation(ctx context.Context, id string) (*entity.Reservation, error)
+	Commit(ctx context.Context, id string) (*entity.Reservation, error)
+	Release(ctx context.Context, id string) (*entity.Reservation, error)
+	ReleaseExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type CategoryRepositoryInterface interface {
+	Create(ctx context.Context, category *entity.Category) error
+	FindByID(ctx context.Context, id string) (*entity.Category, error)
+	FindAll(ctx context.Context) ([]entity.Category, error)
+	FindChildren(ctx context.Context, parentID string) ([]entity.Category, error)
+	Update(ctx context.Context, category *entity.Category) (int64, error)
+	Delete(ctx context.Context, id string) (int64, error)
+	SetProductCategories(ctx context.Context, productID string, categoryIDs []string) error
+	FindProductCategories(ctx context.Context, productID string) ([]entity.Category, error)
+}
+
+type TagRepositoryInterface interface {
+	SetProductTags(ctx context.Context, productID string, tags []string) error
+	FindProductTags(ctx context.Context, productID string) ([]string, error)
+}
+
+type RefreshTokenRepositoryInterface interface {
+	Create(ctx context.Context, token *entity.RefreshToken) error
+	FindByHash(ctx context.Context, hash string) (*entity.RefreshToken, error)
+	MarkUsed(ctx context.Context, id string) (int64, error)
+	RevokeFamily(ctx context.Context, familyID string) (int64, error)
+	RevokeUser(ctx context.Context, userID string) (int64, error)
+}
+
+type InviteRepositoryInterface interface {
+	Create(ctx context.Context, invite *entity.Invite) error
+	FindByHash(ctx context.Context, hash string) (*entity.Invite, error)
+	MarkUsed(ctx context.Context, id string) (int64, error)
+	Release(ctx context.Context, id string) error
+}
+
+type PasswordResetRepositoryInterface interface {
+	Create(ctx context.Context, reset *entity.PasswordReset) error
+	FindByHash(ctx context.Context, hash string) (*entity.PasswordReset, error)
+	MarkUsed(ctx context.Context, id string, now time.Time) (int64, error)
+	InvalidateUser(ctx context.Context, userID string) (int64, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type AuditRepositoryInterface interface {
+	Create(ctx context.Context, entry *entity.AuditEntry) error
+	Search(ctx context.Context, query AuditQuery) ([]entity.AuditEntry, error)
+	Count(ctx context.Context, filter AuditFilter) (int64, error)
+}
+
+type IdempotencyRepositoryInterface interface {
+	Create(ctx context.Context, record *entity.IdempotencyRecord) error
+	Find(ctx context.Context, scope, key string) (*entity.IdempotencyRecord, error)
+	Complete(ctx context.Context, record *entity.IdempotencyRecord) error
+	Delete(ctx context.Context, id string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+// UnitOfWorkInterface runs several repository calls as one transaction.
+type UnitOfWorkInterface interface {
+	Do(ctx context.Context, fn func(repos Repositories) error) error
 }
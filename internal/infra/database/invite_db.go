@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"gorm.io/gorm"
+)
+
+type InviteRepository struct {
+	DB *gorm.DB
+}
+
+func NewInviteRepository(db *gorm.DB) *InviteRepository {
+	return &InviteRepository{
+		DB: db,
+	}
+}
+
+func (r *InviteRepository) Create(ctx context.Context, invite *entity.Invite) error {
+	return translateError(r.DB.WithContext(ctx).Create(invite).Error)
+}
+
+func (r *InviteRepository) FindByHash(ctx context.Context, hash string) (*entity.Invite, error) {
+	if hash == "" {
+		return nil, ErrInvalidInput
+	}
+	var invite entity.Invite
+	if err := r.DB.WithContext(ctx).Where("code_hash = ?", hash).First(&invite).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &invite, nil
+}
+
+// MarkUsed consumes the invite only if it is still unused, so an invite
+// cannot register two accounts concurrently.
+func (r *InviteRepository) MarkUsed(ctx context.Context, id string) (int64, error) {
+	s := r.DB.WithContext(ctx).Model(&entity.Invite{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	return s.RowsAffected, translateError(s.Error)
+}
+
+// Release makes a consumed invite usable again after a failed registration.
+func (r *InviteRepository) Release(ctx context.Context, id string) error {
+	return translateError(r.DB.WithContext(ctx).Model(&entity.Invite{}).Where("id = ?", id).Update("used_at", nil).Error)
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCreateInvite(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.Invite{})
+
+	inviteRepository := NewInviteRepository(db)
+	invite, code, _ := entity.NewInvite("j@j.com", pkgentity.NewId(), time.Hour)
+	err = inviteRepository.Create(context.Background(), invite)
+	assert.Nil(t, err)
+
+	found, err := inviteRepository.FindByHash(context.Background(), entity.HashInviteCode(code))
+	assert.Nil(t, err)
+	assert.Equal(t, invite.ID, found.ID)
+	assert.Equal(t, "j@j.com", found.Email)
+
+	_, err = inviteRepository.FindByHash(context.Background(), entity.HashInviteCode("unknown"))
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestMarkInviteUsedAndRelease(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.Invite{})
+
+	inviteRepository := NewInviteRepository(db)
+	invite, code, _ := entity.NewInvite("", pkgentity.NewId(), time.Hour)
+	assert.Nil(t, inviteRepository.Create(context.Background(), invite))
+
+	rows, err := inviteRepository.MarkUsed(context.Background(), invite.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rows)
+	rows, err = inviteRepository.MarkUsed(context.Background(), invite.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), rows)
+
+	assert.Nil(t, inviteRepository.Release(context.Background(), invite.ID.String()))
+	found, _ := inviteRepository.FindByHash(context.Background(), entity.HashInviteCode(code))
+	assert.Nil(t, found.UsedAt)
+}
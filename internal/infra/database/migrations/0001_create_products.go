@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"gorm.io/gorm"
+)
+
+type productV1 struct {
+	ID        entity.ID
+	Name      string
+	Price     float64
+	CreatedAt time.Time
+}
+
+func (productV1) TableName() string {
+	return "products"
+}
+
+// createProducts adopts databases created by the old AutoMigrate call, so the
+// table is only created when missing.
+var createProducts = Migration{
+	Version: 1,
+	Name:    "create_products",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasTable(&productV1{}) {
+			return nil
+		}
+		return tx.Migrator().CreateTable(&productV1{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&productV1{})
+	},
+}
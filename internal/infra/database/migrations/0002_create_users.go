@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"gorm.io/gorm"
+)
+
+type userV1 struct {
+	ID       entity.ID
+	Name     string
+	Email    string
+	Password string
+}
+
+func (userV1) TableName() string {
+	return "users"
+}
+
+var createUsers = Migration{
+	Version: 2,
+	Name:    "create_users",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasTable(&userV1{}) {
+			return nil
+		}
+		return tx.Migrator().CreateTable(&userV1{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&userV1{})
+	},
+}
@@ -0,0 +1,21 @@
+package migrations
+
+import "gorm.io/gorm"
+
+const userEmailIndex = "idx_users_email"
+
+// uniqueUserEmail lets the repository report duplicate registrations as
+// conflicts instead of silently storing a second account.
+var uniqueUserEmail = Migration{
+	Version: 3,
+	Name:    "unique_user_email",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasIndex(&userV1{}, userEmailIndex) {
+			return nil
+		}
+		return tx.Exec("CREATE UNIQUE INDEX " + userEmailIndex + " ON users (email)").Error
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropIndex(&userV1{}, userEmailIndex)
+	},
+}
@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"gorm.io/gorm"
+)
+
+type refreshTokenV1 struct {
+	ID        entity.ID
+	UserID    entity.ID `gorm:"index"`
+	FamilyID  entity.ID `gorm:"index"`
+	TokenHash string    `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+func (refreshTokenV1) TableName() string {
+	return "refresh_tokens"
+}
+
+var createRefreshTokens = Migration{
+	Version: 4,
+	Name:    "create_refresh_tokens",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&refreshTokenV1{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&refreshTokenV1{})
+	},
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type userV2 struct {
+	Roles string `gorm:"size:255"`
+}
+
+func (userV2) TableName() string {
+	return "users"
+}
+
+// addUserRoles grants admin to users that existed before roles, since any
+// authenticated user could previously manage the whole API.
+var addUserRoles = Migration{
+	Version: 5,
+	Name:    "add_user_roles",
+	Up: func(tx *gorm.DB) error {
+		if !tx.Migrator().HasColumn(&userV2{}, "Roles") {
+			if err := tx.Migrator().AddColumn(&userV2{}, "Roles"); err != nil {
+				return err
+			}
+		}
+		return tx.Exec("UPDATE users SET roles = ? WHERE roles IS NULL OR roles = ''", "admin").Error
+	},
+	Down: func(tx *gorm.DB) error {
+		return dropColumns(tx, "users", "roles")
+	},
+}
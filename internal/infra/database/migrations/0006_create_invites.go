@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"gorm.io/gorm"
+)
+
+type inviteV1 struct {
+	ID        entity.ID
+	CodeHash  string `gorm:"uniqueIndex"`
+	Email     string
+	CreatedBy entity.ID
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+}
+
+func (inviteV1) TableName() string {
+	return "invites"
+}
+
+var createInvites = Migration{
+	Version: 6,
+	Name:    "create_invites",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&inviteV1{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&inviteV1{})
+	},
+}
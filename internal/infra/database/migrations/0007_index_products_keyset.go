@@ -0,0 +1,20 @@
+package migrations
+
+import "gorm.io/gorm"
+
+const productKeysetIndex = "idx_products_created_at_id"
+
+// indexProductsKeyset backs cursor pagination, which seeks on (created_at, id).
+var indexProductsKeyset = Migration{
+	Version: 7,
+	Name:    "index_products_keyset",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasIndex(&productV1{}, productKeysetIndex) {
+			return nil
+		}
+		return tx.Exec("CREATE INDEX " + productKeysetIndex + " ON products (created_at, id)").Error
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropIndex(&productV1{}, productKeysetIndex)
+	},
+}
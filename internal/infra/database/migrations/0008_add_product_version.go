@@ -0,0 +1,27 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type productV2 struct {
+	Version int64 `gorm:"not null;default:1"`
+}
+
+func (productV2) TableName() string {
+	return "products"
+}
+
+// addProductVersion adds the counter behind product ETags. Existing rows
+// start at version 1.
+var addProductVersion = Migration{
+	Version: 8,
+	Name:    "add_product_version",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&productV2{}, "Version") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&productV2{}, "Version")
+	},
+	Down: func(tx *gorm.DB) error {
+		return dropColumns(tx, "products", "version")
+	},
+}
@@ -0,0 +1,36 @@
+package migrations
+
+import "gorm.io/gorm"
+
+type productV3 struct {
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (productV3) TableName() string {
+	return "products"
+}
+
+const productDeletedAtIndex = "idx_products_deleted_at"
+
+// addProductDeletedAt turns product deletion into a move to the trash.
+var addProductDeletedAt = Migration{
+	Version: 9,
+	Name:    "add_product_deleted_at",
+	Up: func(tx *gorm.DB) error {
+		if !tx.Migrator().HasColumn(&productV3{}, "DeletedAt") {
+			if err := tx.Migrator().AddColumn(&productV3{}, "DeletedAt"); err != nil {
+				return err
+			}
+		}
+		if tx.Migrator().HasIndex(&productV3{}, productDeletedAtIndex) {
+			return nil
+		}
+		return tx.Migrator().CreateIndex(&productV3{}, "DeletedAt")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&productV3{}, productDeletedAtIndex); err != nil {
+			return err
+		}
+		return dropColumns(tx, "products", "deleted_at")
+	},
+}
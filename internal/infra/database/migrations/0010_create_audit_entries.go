@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"gorm.io/gorm"
+)
+
+type auditEntryV1 struct {
+	ID         entity.ID
+	Actor      string `gorm:"index"`
+	Action     string
+	EntityType string `gorm:"index:idx_audit_entries_entity"`
+	EntityID   string `gorm:"index:idx_audit_entries_entity"`
+	Before     string `gorm:"type:text"`
+	After      string `gorm:"type:text"`
+	RequestID  string
+	CreatedAt  time.Time
+}
+
+func (auditEntryV1) TableName() string {
+	return "audit_entries"
+}
+
+var createAuditEntries = Migration{
+	Version: 10,
+	Name:    "create_audit_entries",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&auditEntryV1{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&auditEntryV1{})
+	},
+}
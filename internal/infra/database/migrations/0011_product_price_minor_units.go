@@ -0,0 +1,71 @@
+package migrations
+
+import (
+	"math"
+
+	"github.com/antoniofmoliveira/apis/pkg/money"
+	"gorm.io/gorm"
+)
+
+type productV4 struct {
+	PriceMinor int64  `gorm:"not null;default:0"`
+	Currency   string `gorm:"size:3;not null;default:''"`
+}
+
+func (productV4) TableName() string {
+	return "products"
+}
+
+// productPriceMinorUnits replaces the float price with an integer amount
+// in the minor unit of an ISO 4217 currency. Prices stored before
+// currencies existed are taken to be in legacyCurrency.
+func productPriceMinorUnits(legacyCurrency string) Migration {
+	return Migration{
+		Version: 11,
+		Name:    "product_price_minor_units",
+		Up: func(tx *gorm.DB) error {
+			exp, err := money.Exponent(legacyCurrency)
+			if err != nil {
+				return err
+			}
+			for _, field := range []string{"PriceMinor", "Currency"} {
+				if tx.Migrator().HasColumn(&productV4{}, field) {
+					continue
+				}
+				if err := tx.Migrator().AddColumn(&productV4{}, field); err != nil {
+					return err
+				}
+			}
+			if !tx.Migrator().HasColumn(&productV4{}, "price") {
+				return nil
+			}
+			err = tx.Exec("UPDATE products SET price_minor = ROUND(price * ?), currency = ?",
+				math.Pow10(exp), legacyCurrency).Error
+			if err != nil {
+				return err
+			}
+			return dropColumns(tx, "products", "price")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Exec("ALTER TABLE products ADD COLUMN price real").Error; err != nil {
+				return err
+			}
+			var currencies []string
+			if err := tx.Table("products").Distinct().Pluck("currency", &currencies).Error; err != nil {
+				return err
+			}
+			for _, currency := range currencies {
+				exp, err := money.Exponent(currency)
+				if err != nil {
+					return err
+				}
+				err = tx.Exec("UPDATE products SET price = price_minor / ? WHERE currency = ?",
+					math.Pow10(exp), currency).Error
+				if err != nil {
+					return err
+				}
+			}
+			return dropColumns(tx, "products", "currency", "price_minor")
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"gorm.io/gorm"
+)
+
+type productV5 struct {
+	Stock    int64 `gorm:"not null;default:0"`
+	Reserved int64 `gorm:"not null;default:0"`
+}
+
+func (productV5) TableName() string {
+	return "products"
+}
+
+type stockMovementV1 struct {
+	ID            entity.ID
+	ProductID     entity.ID `gorm:"index"`
+	Delta         int64
+	Reason        string
+	Note          string
+	ReservationID string
+	CreatedAt     time.Time
+}
+
+func (stockMovementV1) TableName() string {
+	return "stock_movements"
+}
+
+type reservationV1 struct {
+	ID        entity.ID
+	ProductID entity.ID `gorm:"index"`
+	Quantity  int64
+	Status    string    `gorm:"index:idx_reservations_status_expires_at"`
+	ExpiresAt time.Time `gorm:"index:idx_reservations_status_expires_at"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (reservationV1) TableName() string {
+	return "reservations"
+}
+
+// addProductStock tracks the quantity on hand, its movements and the
+// reservations holding part of it. Existing products start with no stock.
+var addProductStock = Migration{
+	Version: 12,
+	Name:    "add_product_stock",
+	Up: func(tx *gorm.DB) error {
+		for _, field := range []string{"Stock", "Reserved"} {
+			if tx.Migrator().HasColumn(&productV5{}, field) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(&productV5{}, field); err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().CreateTable(&stockMovementV1{}, &reservationV1{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&reservationV1{}, &stockMovementV1{}); err != nil {
+			return err
+		}
+		return dropColumns(tx, "products", "reserved", "stock")
+	},
+}
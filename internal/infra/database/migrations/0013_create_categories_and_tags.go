@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"gorm.io/gorm"
+)
+
+type categoryV1 struct {
+	ID        entity.ID
+	Name      string
+	ParentID  *entity.ID `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (categoryV1) TableName() string {
+	return "categories"
+}
+
+type productCategoryV1 struct {
+	ProductID  entity.ID `gorm:"primaryKey"`
+	CategoryID entity.ID `gorm:"primaryKey;index"`
+}
+
+func (productCategoryV1) TableName() string {
+	return "product_categories"
+}
+
+type productTagV1 struct {
+	ProductID entity.ID `gorm:"primaryKey"`
+	Tag       string    `gorm:"primaryKey;index"`
+}
+
+func (productTagV1) TableName() string {
+	return "product_tags"
+}
+
+var createCategoriesAndTags = Migration{
+	Version: 13,
+	Name:    "create_categories_and_tags",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&categoryV1{}, &productCategoryV1{}, &productTagV1{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&productTagV1{}, &productCategoryV1{}, &categoryV1{})
+	},
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"gorm.io/gorm"
+)
+
+type idempotencyRecordV1 struct {
+	ID          entity.ID
+	Scope       string `gorm:"uniqueIndex:idx_idempotency_records_scope_key"`
+	Key         string `gorm:"uniqueIndex:idx_idempotency_records_scope_key"`
+	RequestHash string
+	Status      int
+	Header      string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+func (idempotencyRecordV1) TableName() string {
+	return "idempotency_records"
+}
+
+var createIdempotencyRecords = Migration{
+	Version: 14,
+	Name:    "create_idempotency_records",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&idempotencyRecordV1{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&idempotencyRecordV1{})
+	},
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type userV3 struct {
+	FailedLogins int `gorm:"not null;default:0"`
+	LockedUntil  *time.Time
+}
+
+func (userV3) TableName() string {
+	return "users"
+}
+
+// addUserLoginLockout tracks consecutive failed logins so accounts under a
+// password guessing attack can be locked.
+var addUserLoginLockout = Migration{
+	Version: 15,
+	Name:    "add_user_login_lockout",
+	Up: func(tx *gorm.DB) error {
+		for _, field := range []string{"FailedLogins", "LockedUntil"} {
+			if tx.Migrator().HasColumn(&userV3{}, field) {
+				continue
+			}
+			if err := tx.Migrator().AddColumn(&userV3{}, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		return dropColumns(tx, "users", "locked_until", "failed_logins")
+	},
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/entity"
+	"gorm.io/gorm"
+)
+
+type passwordResetV1 struct {
+	ID        entity.ID
+	UserID    entity.ID `gorm:"index"`
+	TokenHash string    `gorm:"uniqueIndex"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+	UsedAt    *time.Time
+}
+
+func (passwordResetV1) TableName() string {
+	return "password_resets"
+}
+
+var createPasswordResets = Migration{
+	Version: 16,
+	Name:    "create_password_resets",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&passwordResetV1{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&passwordResetV1{})
+	},
+}
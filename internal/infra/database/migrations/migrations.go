@@ -0,0 +1,26 @@
+package migrations
+
+// All returns the application's migrations. New migrations are appended here
+// with the next version number and never edited once released.
+// legacyCurrency is the currency of prices stored before products had one;
+// the server passes DEFAULT_CURRENCY.
+func All(legacyCurrency string) []Migration {
+	return []Migration{
+		createProducts,
+		createUsers,
+		uniqueUserEmail,
+		createRefreshTokens,
+		addUserRoles,
+		createInvites,
+		indexProductsKeyset,
+		addProductVersion,
+		addProductDeletedAt,
+		createAuditEntries,
+		productPriceMinorUnits(legacyCurrency),
+		addProductStock,
+		createCategoriesAndTags,
+		createIdempotencyRecords,
+		addUserLoginLockout,
+		createPasswordResets,
+	}
+}
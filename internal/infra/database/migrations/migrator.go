@@ -0,0 +1,210 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+	ErrUnknownVersion   = errors.New("unknown migration version")
+	ErrIrreversible     = errors.New("migration has no down step")
+)
+
+// dropColumns removes columns from table with plain ALTER TABLE ... DROP
+// COLUMN statements. GORM's SQLite migrator drops a column by rebuilding
+// the table, which loses the table's indexes; DROP COLUMN keeps them.
+func dropColumns(tx *gorm.DB, table string, columns ...string) error {
+	for _, column := range columns {
+		if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, column)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migration is one ordered schema change. Up and Down run inside a transaction.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration is a row of the schema_migrations table.
+type SchemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status reports whether a known migration has been applied.
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB, migrations []Migration) *Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Migrator{
+		DB:         db,
+		Migrations: sorted,
+	}
+}
+
+func (m *Migrator) init() error {
+	for i := 1; i < len(m.Migrations); i++ {
+		if m.Migrations[i].Version == m.Migrations[i-1].Version {
+			return fmt.Errorf("%w: %d", ErrDuplicateVersion, m.Migrations[i].Version)
+		}
+	}
+	return m.DB.AutoMigrate(&SchemaMigration{})
+}
+
+func (m *Migrator) applied() (map[int64]SchemaMigration, error) {
+	var rows []SchemaMigration
+	if err := m.DB.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, mig := range m.Migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+func (m *Migrator) up(mig Migration) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := mig.Up(tx); err != nil {
+			return fmt.Errorf("migration %d (%s) up: %w", mig.Version, mig.Name, err)
+		}
+		return tx.Create(&SchemaMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error
+	})
+}
+
+func (m *Migrator) down(mig Migration) error {
+	if mig.Down == nil {
+		return fmt.Errorf("%w: %d (%s)", ErrIrreversible, mig.Version, mig.Name)
+	}
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := mig.Down(tx); err != nil {
+			return fmt.Errorf("migration %d (%s) down: %w", mig.Version, mig.Name, err)
+		}
+		return tx.Where("version = ?", mig.Version).Delete(&SchemaMigration{}).Error
+	})
+}
+
+// Up applies every pending migration in version order and returns how many ran.
+func (m *Migrator) Up() (int, error) {
+	if len(m.Migrations) == 0 {
+		return 0, nil
+	}
+	return m.To(m.Migrations[len(m.Migrations)-1].Version)
+}
+
+// Down rolls back the n most recently applied migrations.
+func (m *Migrator) Down(n int) (int, error) {
+	if err := m.init(); err != nil {
+		return 0, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := len(m.Migrations) - 1; i >= 0 && count < n; i-- {
+		mig := m.Migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if err := m.down(mig); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// To migrates up or down until version is the latest applied migration.
+// Version 0 rolls back everything.
+func (m *Migrator) To(version int64) (int, error) {
+	if err := m.init(); err != nil {
+		return 0, err
+	}
+	if _, ok := m.find(version); !ok && version != 0 {
+		return 0, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		mig := m.Migrations[i]
+		if _, ok := applied[mig.Version]; !ok || mig.Version <= version {
+			continue
+		}
+		if err := m.down(mig); err != nil {
+			return count, err
+		}
+		count++
+	}
+	for _, mig := range m.Migrations {
+		if _, ok := applied[mig.Version]; ok || mig.Version > version {
+			continue
+		}
+		if err := m.up(mig); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.Migrations))
+	for _, mig := range m.Migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if row, ok := applied[mig.Version]; ok {
+			appliedAt := row.AppliedAt
+			s.Applied = true
+			s.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,154 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDB() *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	return db
+}
+
+func TestUpAppliesAll(t *testing.T) {
+	db := newTestDB()
+	migrator := NewMigrator(db, All("USD"))
+
+	count, err := migrator.Up()
+	assert.Nil(t, err)
+	assert.Equal(t, len(All("USD")), count)
+
+	count, err = migrator.Up()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	product, _ := entity.NewProduct("Product", 1000, "USD")
+	assert.Nil(t, database.NewProductRepository(db).Create(context.Background(), product))
+	user, _ := entity.NewUser("John Doe", "j@j.com", "123456")
+	assert.Nil(t, database.NewUserRepository(db).Create(context.Background(), user))
+}
+
+func TestDownAndStatus(t *testing.T) {
+	db := newTestDB()
+	migrator := NewMigrator(db, All("USD"))
+	_, err := migrator.Up()
+	assert.Nil(t, err)
+
+	count, err := migrator.Down(len(All("USD")) - 1)
+	assert.Nil(t, err)
+	assert.Equal(t, len(All("USD"))-1, count)
+	assert.False(t, db.Migrator().HasTable("users"))
+	assert.True(t, db.Migrator().HasTable("products"))
+
+	statuses, err := migrator.Status()
+	assert.Nil(t, err)
+	assert.Len(t, statuses, len(All("USD")))
+	assert.True(t, statuses[0].Applied)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.False(t, statuses[1].Applied)
+}
+
+func TestTo(t *testing.T) {
+	db := newTestDB()
+	migrator := NewMigrator(db, All("USD"))
+
+	count, err := migrator.To(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.True(t, db.Migrator().HasTable("products"))
+	assert.False(t, db.Migrator().HasTable("users"))
+
+	_, err = migrator.Up()
+	assert.Nil(t, err)
+	count, err = migrator.To(0)
+	assert.Nil(t, err)
+	assert.Equal(t, len(All("USD")), count)
+	assert.False(t, db.Migrator().HasTable("products"))
+
+	_, err = migrator.To(999)
+	assert.True(t, errors.Is(err, ErrUnknownVersion))
+}
+
+func TestUpAdoptsAutoMigratedSchema(t *testing.T) {
+	db := newTestDB()
+	db.AutoMigrate(&entity.Product{}, &entity.User{})
+
+	count, err := NewMigrator(db, All("USD")).Up()
+	assert.Nil(t, err)
+	assert.Equal(t, len(All("USD")), count)
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	db := newTestDB()
+	broken := Migration{
+		Version: 1,
+		Name:    "broken",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Exec("CREATE TABLE t (id integer)").Error; err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+	}
+	_, err := NewMigrator(db, []Migration{broken}).Up()
+	assert.NotNil(t, err)
+	assert.False(t, db.Migrator().HasTable("t"))
+
+	statuses, err := NewMigrator(db, []Migration{broken}).Status()
+	assert.Nil(t, err)
+	assert.False(t, statuses[0].Applied)
+}
+
+func TestDuplicateVersion(t *testing.T) {
+	db := newTestDB()
+	_, err := NewMigrator(db, []Migration{createProducts, createProducts}).Up()
+	assert.True(t, errors.Is(err, ErrDuplicateVersion))
+}
+
+func TestIrreversible(t *testing.T) {
+	db := newTestDB()
+	oneWay := Migration{Version: 1, Name: "one_way", Up: func(tx *gorm.DB) error { return nil }}
+	migrator := NewMigrator(db, []Migration{oneWay})
+	_, err := migrator.Up()
+	assert.Nil(t, err)
+	_, err = migrator.Down(1)
+	assert.True(t, errors.Is(err, ErrIrreversible))
+}
+
+func TestProductPriceMinorUnits(t *testing.T) {
+	db := newTestDB()
+	migrator := NewMigrator(db, All("EUR"))
+	_, err := migrator.To(productPriceMinorUnits("EUR").Version - 1)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Exec("INSERT INTO products (id, name, price, created_at) VALUES (?, ?, ?, ?)",
+		"9b2c3a4e-5f60-4a7b-8c9d-0e1f2a3b4c5d", "Legacy", 10.29, time.Now()).Error)
+
+	_, err = migrator.Up()
+	assert.Nil(t, err)
+	assert.False(t, db.Migrator().HasColumn("products", "price"))
+	product, err := database.NewProductRepository(db).FindByID(context.Background(), "9b2c3a4e-5f60-4a7b-8c9d-0e1f2a3b4c5d")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1029), product.PriceMinor)
+	assert.Equal(t, "EUR", product.Currency)
+	assert.True(t, db.Migrator().HasIndex("products", productDeletedAtIndex))
+
+	_, err = migrator.To(productPriceMinorUnits("EUR").Version - 1)
+	assert.Nil(t, err)
+	var price float64
+	assert.Nil(t, db.Table("products").Pluck("price", &price).Error)
+	assert.Equal(t, 10.29, price)
+	assert.False(t, db.Migrator().HasColumn("products", "price_minor"))
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"gorm.io/gorm"
+)
+
+type PasswordResetRepository struct {
+	DB *gorm.DB
+}
+
+func NewPasswordResetRepository(db *gorm.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{
+		DB: db,
+	}
+}
+
+func (r *PasswordResetRepository) Create(ctx context.Context, reset *entity.PasswordReset) error {
+	return translateError(r.DB.WithContext(ctx).Create(reset).Error)
+}
+
+func (r *PasswordResetRepository) FindByHash(ctx context.Context, hash string) (*entity.PasswordReset, error) {
+	if hash == "" {
+		return nil, ErrInvalidInput
+	}
+	var reset entity.PasswordReset
+	if err := r.DB.WithContext(ctx).Where("token_hash = ?", hash).First(&reset).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &reset, nil
+}
+
+// MarkUsed spends the reset only if it is unused and unexpired at now, so a
+// token cannot change the password twice, even concurrently.
+func (r *PasswordResetRepository) MarkUsed(ctx context.Context, id string, now time.Time) (int64, error) {
+	s := r.DB.WithContext(ctx).Model(&entity.PasswordReset{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", id, now).
+		Update("used_at", now)
+	return s.RowsAffected, translateError(s.Error)
+}
+
+// InvalidateUser spends every outstanding reset of a user, so links mailed
+// before a password change stop working.
+func (r *PasswordResetRepository) InvalidateUser(ctx context.Context, userID string) (int64, error) {
+	s := r.DB.WithContext(ctx).Model(&entity.PasswordReset{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now())
+	return s.RowsAffected, translateError(s.Error)
+}
+
+// DeleteExpired removes resets that expired before now, used or not.
+func (r *PasswordResetRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	s := r.DB.WithContext(ctx).Where("expires_at <= ?", now).Delete(&entity.PasswordReset{})
+	return s.RowsAffected, translateError(s.Error)
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPasswordResetRepository(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	db.AutoMigrate(&entity.PasswordReset{})
+	ctx := context.Background()
+	repository := NewPasswordResetRepository(db)
+	userID := pkgentity.NewId()
+
+	reset, token, _ := entity.NewPasswordReset(userID, time.Hour)
+	assert.Nil(t, repository.Create(ctx, reset))
+	found, err := repository.FindByHash(ctx, entity.HashPasswordResetToken(token))
+	assert.Nil(t, err)
+	assert.Equal(t, reset.ID, found.ID)
+	_, err = repository.FindByHash(ctx, entity.HashPasswordResetToken("other"))
+	assert.Equal(t, ErrNotFound, err)
+
+	// Expired resets cannot be spent.
+	rows, err := repository.MarkUsed(ctx, reset.ID.String(), time.Now().Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), rows)
+	rows, _ = repository.MarkUsed(ctx, reset.ID.String(), time.Now())
+	assert.Equal(t, int64(1), rows)
+	rows, _ = repository.MarkUsed(ctx, reset.ID.String(), time.Now())
+	assert.Equal(t, int64(0), rows)
+
+	first, _, _ := entity.NewPasswordReset(userID, time.Hour)
+	second, _, _ := entity.NewPasswordReset(userID, time.Hour)
+	other, _, _ := entity.NewPasswordReset(pkgentity.NewId(), time.Hour)
+	repository.Create(ctx, first)
+	repository.Create(ctx, second)
+	repository.Create(ctx, other)
+	rows, err = repository.InvalidateUser(ctx, userID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), rows)
+
+	rows, err = repository.DeleteExpired(ctx, time.Now().Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), rows)
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+)
+
+// ProductCursor is the position of the last product returned by a keyset
+// scan. Products are walked in (created_at, id) order, so rows inserted
+// during a scan never shift the remaining pages.
+type ProductCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+func CursorFor(product entity.Product) ProductCursor {
+	return ProductCursor{CreatedAt: product.CreatedAt, ID: product.ID.String()}
+}
+
+// Encode returns the cursor as an opaque URL-safe token.
+func (c ProductCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeProductCursor parses a token produced by Encode.
+func DecodeProductCursor(s string) (ProductCursor, error) {
+	var c ProductCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidInput)
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" || c.CreatedAt.IsZero() {
+		return c, fmt.Errorf("%w: malformed cursor", ErrInvalidInput)
+	}
+	return c, nil
+}
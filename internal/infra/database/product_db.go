@@ -1,7 +1,11 @@
 package database
 
 import (
+	"context"
+	"time"
+
 	"github.com/antoniofmoliveira/apis/internal/entity"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
 	"gorm.io/gorm"
 )
 
@@ -15,36 +19,168 @@ func NewProductRepository(db *gorm.DB) *ProductRepository {
 	}
 }
 
-func (r *ProductRepository) Create(product *entity.Product) error {
-	return r.DB.Create(product).Error
+func (r *ProductRepository) Create(ctx context.Context, product *entity.Product) error {
+	return translateError(r.DB.WithContext(ctx).Create(product).Error)
 }
 
-func (r *ProductRepository) FindAll(page, limit int, sort string) ([]entity.Product, error) {
+// FindAll lists products ordered by a ParseProductSort expression.
+func (r *ProductRepository) FindAll(ctx context.Context, page, limit int, sort string) ([]entity.Product, error) {
+	fields, err := ParseProductSort(sort)
+	if err != nil {
+		return nil, err
+	}
+	return r.Search(ctx, ProductQuery{Page: page, Limit: limit, Sort: fields})
+}
+
+func (r *ProductRepository) Search(ctx context.Context, query ProductQuery) ([]entity.Product, error) {
+	if err := query.Filter.Validate(); err != nil {
+		return nil, err
+	}
 	var products []entity.Product
-	var err error
-	if sort != "" && sort != "asc" && sort != "desc" {
-		sort = "asc"
+	db := applySort(query.Filter.apply(r.DB.WithContext(ctx)), query.Sort)
+	if query.Page != 0 && query.Limit != 0 {
+		db = db.Limit(query.Limit).Offset((query.Page - 1) * query.Limit)
+	}
+	err := db.Find(&products).Error
+	return products, translateError(err)
+}
+
+// SearchAfter returns up to limit products following after in (created_at,
+// id) order. A nil cursor starts from the beginning.
+func (r *ProductRepository) SearchAfter(ctx context.Context, filter ProductFilter, after *ProductCursor, limit int) ([]entity.Product, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	db := filter.apply(r.DB.WithContext(ctx))
+	if after != nil {
+		db = db.Where("created_at > ? OR (created_at = ? AND id > ?)", after.CreatedAt, after.CreatedAt, after.ID)
 	}
-	if page != 0 && limit != 0 {
-		err = r.DB.Limit(limit).Offset((page - 1) * limit).Order("created_at " + sort).Find(&products).Error
-	} else {
-		err = r.DB.Order("created_at " + sort).Find(&products).Error
+	var products []entity.Product
+	err := db.Order("created_at asc").Order("id asc").Limit(limit).Find(&products).Error
+	return products, translateError(err)
+}
+
+func (r *ProductRepository) Count(ctx context.Context, filter ProductFilter) (int64, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
 	}
-	return products, err
+	var count int64
+	err := filter.apply(r.DB.WithContext(ctx).Model(&entity.Product{})).Count(&count).Error
+	return count, translateError(err)
 }
 
-func (r *ProductRepository) FindByID(id string) (*entity.Product, error) {
+func (r *ProductRepository) FindByID(ctx context.Context, id string) (*entity.Product, error) {
+	if id == "" {
+		return nil, ErrInvalidInput
+	}
 	var product entity.Product
-	err := r.DB.Where("id = ?", id).First(&product).Error
-	return &product, err
+	if err := r.DB.WithContext(ctx).Where("id = ?", id).First(&product).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &product, nil
+}
+
+// Update saves product if its Version still matches the stored row and
+// bumps Version on success. A zero Version updates unconditionally. When the
+// row exists with another version it returns ErrVersionMismatch; a missing
+// row affects no rows.
+func (r *ProductRepository) Update(ctx context.Context, product *entity.Product) (int64, error) {
+	if product == nil || product.ID == (pkgentity.ID{}) {
+		return 0, ErrInvalidInput
+	}
+	db := r.DB.WithContext(ctx).Model(&entity.Product{}).Where("id = ?", product.ID)
+	if product.Version != 0 {
+		db = db.Where("version = ?", product.Version)
+	}
+	s := db.Updates(map[string]any{
+		"name":        product.Name,
+		"price_minor": product.PriceMinor,
+		"currency":    product.Currency,
+		"version":     gorm.Expr("version + 1"),
+	})
+	if s.Error != nil {
+		return 0, translateError(s.Error)
+	}
+	if s.RowsAffected == 0 {
+		return 0, r.versionMismatch(ctx, product.ID.String())
+	}
+	return s.RowsAffected, r.DB.WithContext(ctx).Model(&entity.Product{}).
+		Where("id = ?", product.ID).Pluck("version", &product.Version).Error
+}
+
+// Delete moves the product to the trash if version matches, or
+// unconditionally when version is zero. Errors follow Update.
+func (r *ProductRepository) Delete(ctx context.Context, id string, version int64) (int64, error) {
+	if id == "" {
+		return 0, ErrInvalidInput
+	}
+	db := r.DB.WithContext(ctx).Where("id = ?", id)
+	if version != 0 {
+		db = db.Where("version = ?", version)
+	}
+	s := db.Delete(&entity.Product{})
+	if s.Error != nil {
+		return 0, translateError(s.Error)
+	}
+	if s.RowsAffected == 0 {
+		return 0, r.versionMismatch(ctx, id)
+	}
+	return s.RowsAffected, nil
+}
+
+// Restore takes a product out of the trash and bumps its version. It
+// affects no rows when the product is not in the trash.
+func (r *ProductRepository) Restore(ctx context.Context, id string) (int64, error) {
+	if id == "" {
+		return 0, ErrInvalidInput
+	}
+	s := r.DB.WithContext(ctx).Unscoped().Model(&entity.Product{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]any{"deleted_at": nil, "version": gorm.Expr("version + 1")})
+	return s.RowsAffected, translateError(s.Error)
+}
+
+// Purge permanently deletes a product. Only products already in the trash
+// can be purged.
+func (r *ProductRepository) Purge(ctx context.Context, id string) (int64, error) {
+	if id == "" {
+		return 0, ErrInvalidInput
+	}
+	return r.purge(ctx, "id = ? AND deleted_at IS NOT NULL", id)
 }
 
-func (r *ProductRepository) Update(product *entity.Product) (int64, error) {
-	s := r.DB.Where("id = ?", product.ID).Updates(product)
-	return s.RowsAffected, s.Error
+// PurgeDeletedBefore permanently deletes products trashed before cutoff.
+func (r *ProductRepository) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	return r.purge(ctx, "deleted_at IS NOT NULL AND deleted_at < ?", cutoff)
 }
 
-func (r *ProductRepository) Delete(id string) (int64, error) {
-	s := r.DB.Where("id = ?", id).Delete(&entity.Product{})
-	return s.RowsAffected, s.Error
+// purge permanently deletes the products matching query together with
+// their category and tag assignments.
+func (r *ProductRepository) purge(ctx context.Context, query string, args ...any) (int64, error) {
+	var rows int64
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		purged := tx.Unscoped().Model(&entity.Product{}).Select("id").Where(query, args...)
+		for _, assignment := range []any{&entity.ProductCategory{}, &entity.ProductTag{}} {
+			if err := tx.Where("product_id IN (?)", purged).Delete(assignment).Error; err != nil {
+				return err
+			}
+		}
+		s := tx.Unscoped().Where(query, args...).Delete(&entity.Product{})
+		rows = s.RowsAffected
+		return s.Error
+	})
+	return rows, translateError(err)
+}
+
+// versionMismatch explains a conditional write that affected no rows:
+// ErrVersionMismatch if the row exists, nil if it does not.
+func (r *ProductRepository) versionMismatch(ctx context.Context, id string) error {
+	var count int64
+	if err := r.DB.WithContext(ctx).Model(&entity.Product{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return translateError(err)
+	}
+	if count > 0 {
+		return ErrVersionMismatch
+	}
+	return nil
 }
@@ -1,9 +1,14 @@
 package database
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/antoniofmoliveira/apis/internal/entity"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -19,16 +24,16 @@ func TestCreateProduct(t *testing.T) {
 	db.AutoMigrate(&entity.Product{})
 
 	productRepository := NewProductRepository(db)
-	product, _ := entity.NewProduct("Product", 10.0)
-	err = productRepository.Create(product)
+	product, _ := entity.NewProduct("Product", 1000, "USD")
+	err = productRepository.Create(context.Background(), product)
 	assert.Nil(t, err)
 
-	product, err = productRepository.FindByID(product.ID.String())
+	product, err = productRepository.FindByID(context.Background(), product.ID.String())
 	assert.Nil(t, err)
 	assert.NotNil(t, product)
 	assert.Equal(t, product.ID, product.ID)
 	assert.Equal(t, "Product", product.Name)
-	assert.Equal(t, 10.0, product.Price)
+	assert.Equal(t, int64(1000), product.PriceMinor)
 }
 
 func TestFindAllProducts(t *testing.T) {
@@ -41,14 +46,14 @@ func TestFindAllProducts(t *testing.T) {
 	db.AutoMigrate(&entity.Product{})
 
 	productRepository := NewProductRepository(db)
-	product, _ := entity.NewProduct("Product", 10.0)
-	product2, _ := entity.NewProduct("Product 2", 20.0)
-	err = productRepository.Create(product)
+	product, _ := entity.NewProduct("Product", 1000, "USD")
+	product2, _ := entity.NewProduct("Product 2", 2000, "USD")
+	err = productRepository.Create(context.Background(), product)
 	assert.Nil(t, err)
-	err = productRepository.Create(product2)
+	err = productRepository.Create(context.Background(), product2)
 	assert.Nil(t, err)
 
-	products, err := productRepository.FindAll(1, 2, "asc")
+	products, err := productRepository.FindAll(context.Background(), 1, 2, "asc")
 	assert.Nil(t, err)
 	assert.Len(t, products, 2)
 }
@@ -63,14 +68,14 @@ func TestFindAllProductsNoPagination(t *testing.T) {
 	db.AutoMigrate(&entity.Product{})
 
 	productRepository := NewProductRepository(db)
-	product, _ := entity.NewProduct("Product", 10.0)
-	product2, _ := entity.NewProduct("Product 2", 20.0)
-	err = productRepository.Create(product)
+	product, _ := entity.NewProduct("Product", 1000, "USD")
+	product2, _ := entity.NewProduct("Product 2", 2000, "USD")
+	err = productRepository.Create(context.Background(), product)
 	assert.Nil(t, err)
-	err = productRepository.Create(product2)
+	err = productRepository.Create(context.Background(), product2)
 	assert.Nil(t, err)
 
-	products, err := productRepository.FindAll(0, 0, "asc")
+	products, err := productRepository.FindAll(context.Background(), 0, 0, "asc")
 	assert.Nil(t, err)
 	assert.Len(t, products, 2)
 }
@@ -84,28 +89,29 @@ func TestUpdateProduct(t *testing.T) {
 	db.AutoMigrate(&entity.Product{})
 
 	productRepository := NewProductRepository(db)
-	product, _ := entity.NewProduct("Product", 10.0)
-	err = productRepository.Create(product)
+	product, _ := entity.NewProduct("Product", 1000, "USD")
+	err = productRepository.Create(context.Background(), product)
 	assert.Nil(t, err)
 
-	product, err = productRepository.FindByID(product.ID.String())
+	product, err = productRepository.FindByID(context.Background(), product.ID.String())
 	assert.Nil(t, err)
 	assert.NotNil(t, product)
 	assert.Equal(t, product.ID, product.ID)
 	assert.Equal(t, "Product", product.Name)
-	assert.Equal(t, 10.0, product.Price)
+	assert.Equal(t, int64(1000), product.PriceMinor)
 
 	product.Name = "Product 2"
-	rowsAffected, err := productRepository.Update(product)
+	rowsAffected, err := productRepository.Update(context.Background(), product)
 	assert.Equal(t, int64(1), rowsAffected)
 	assert.Nil(t, err)
+	assert.Equal(t, int64(2), product.Version)
 
-	product, err = productRepository.FindByID(product.ID.String())
+	product, err = productRepository.FindByID(context.Background(), product.ID.String())
 	assert.Nil(t, err)
 	assert.NotNil(t, product)
 	assert.Equal(t, product.ID, product.ID)
 	assert.Equal(t, "Product 2", product.Name)
-	assert.Equal(t, 10.0, product.Price)
+	assert.Equal(t, int64(1000), product.PriceMinor)
 }
 
 func TestDeleteProduct(t *testing.T) {
@@ -118,22 +124,61 @@ func TestDeleteProduct(t *testing.T) {
 	db.AutoMigrate(&entity.Product{})
 
 	productRepository := NewProductRepository(db)
-	product, _ := entity.NewProduct("Product", 10.0)
-	err = productRepository.Create(product)
+	product, _ := entity.NewProduct("Product", 1000, "USD")
+	err = productRepository.Create(context.Background(), product)
 	assert.Nil(t, err)
 
-	product, err = productRepository.FindByID(product.ID.String())
+	product, err = productRepository.FindByID(context.Background(), product.ID.String())
 	assert.Nil(t, err)
 	assert.NotNil(t, product)
 	assert.Equal(t, product.ID, product.ID)
 	assert.Equal(t, "Product", product.Name)
-	assert.Equal(t, 10.0, product.Price)
+	assert.Equal(t, int64(1000), product.PriceMinor)
 
-	rowsAffected, err := productRepository.Delete(product.ID.String())
+	rowsAffected, err := productRepository.Delete(context.Background(), product.ID.String(), product.Version)
 	assert.Equal(t, int64(1), rowsAffected)
 	assert.Nil(t, err)
 }
 
+func TestStaleVersion(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.Product{})
+
+	productRepository := NewProductRepository(db)
+	product, _ := entity.NewProduct("Product", 1000, "USD")
+	assert.Nil(t, productRepository.Create(context.Background(), product))
+
+	first, second := *product, *product
+	first.Name = "First"
+	rowsAffected, err := productRepository.Update(context.Background(), &first)
+	assert.Equal(t, int64(1), rowsAffected)
+	assert.Nil(t, err)
+
+	second.Name = "Second"
+	rowsAffected, err = productRepository.Update(context.Background(), &second)
+	assert.Equal(t, int64(0), rowsAffected)
+	assert.Equal(t, ErrVersionMismatch, err)
+
+	rowsAffected, err = productRepository.Delete(context.Background(), product.ID.String(), product.Version)
+	assert.Equal(t, int64(0), rowsAffected)
+	assert.Equal(t, ErrVersionMismatch, err)
+
+	stored, err := productRepository.FindByID(context.Background(), product.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, "First", stored.Name)
+
+	second.Version = 0
+	rowsAffected, err = productRepository.Update(context.Background(), &second)
+	assert.Equal(t, int64(1), rowsAffected)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), second.Version)
+}
+
 func TestProductsNotFound(t *testing.T) {
 	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
 
@@ -145,7 +190,7 @@ func TestProductsNotFound(t *testing.T) {
 
 	productRepository := NewProductRepository(db)
 
-	products, err := productRepository.FindAll(1, 2, "id")
+	products, err := productRepository.FindAll(context.Background(), 1, 2, "id")
 	assert.Nil(t, err)
 	assert.Len(t, products, 0)
 }
@@ -161,7 +206,251 @@ func TestDeleteError(t *testing.T) {
 
 	productRepository := NewProductRepository(db)
 
-	rowsAffected, err := productRepository.Delete("id")
+	rowsAffected, err := productRepository.Delete(context.Background(), "id", 1)
 	assert.Equal(t, int64(0), rowsAffected)
 	assert.Nil(t, err)
 }
+
+func TestFindByIDNotFound(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.Product{})
+
+	productRepository := NewProductRepository(db)
+
+	product, err := productRepository.FindByID(context.Background(), pkgentity.NewId().String())
+	assert.Nil(t, product)
+	assert.Equal(t, ErrNotFound, err)
+
+	product, err = productRepository.FindByID(context.Background(), "")
+	assert.Nil(t, product)
+	assert.Equal(t, ErrInvalidInput, err)
+}
+
+func TestParseProductSort(t *testing.T) {
+	fields, err := ParseProductSort("price,-name")
+	assert.Nil(t, err)
+	assert.Equal(t, []SortField{{Field: "price"}, {Field: "name", Desc: true}}, fields)
+
+	fields, err = ParseProductSort("desc")
+	assert.Nil(t, err)
+	assert.Equal(t, []SortField{{Field: "created_at", Desc: true}}, fields)
+
+	_, err = ParseProductSort("password")
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+	_, err = ParseProductSort("price,-price")
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+}
+
+func TestSearchProducts(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.Product{})
+
+	productRepository := NewProductRepository(db)
+	for _, p := range []struct {
+		name  string
+		price int64
+	}{{"Blue Shirt", 3000}, {"Red Shirt", 2000}, {"Blue Pants", 5000}, {"100%_Cotton", 1000}} {
+		product, _ := entity.NewProduct(p.name, p.price, "USD")
+		assert.Nil(t, productRepository.Create(context.Background(), product))
+	}
+
+	min, max := int64(1500), int64(4000)
+	products, err := productRepository.Search(context.Background(), ProductQuery{
+		Filter: ProductFilter{Name: "shirt", Currency: "USD", MinPrice: &min, MaxPrice: &max},
+		Sort:   []SortField{{Field: "price", Desc: true}},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, products, 2)
+	assert.Equal(t, "Blue Shirt", products[0].Name)
+	assert.Equal(t, "Red Shirt", products[1].Name)
+
+	products, err = productRepository.Search(context.Background(), ProductQuery{Filter: ProductFilter{Name: "%_"}})
+	assert.Nil(t, err)
+	assert.Len(t, products, 1)
+	assert.Equal(t, "100%_Cotton", products[0].Name)
+
+	products, err = productRepository.Search(context.Background(), ProductQuery{Sort: []SortField{{Field: "name"}}, Page: 2, Limit: 2})
+	assert.Nil(t, err)
+	assert.Len(t, products, 2)
+	assert.Equal(t, "Blue Shirt", products[0].Name)
+
+	count, err := productRepository.Count(context.Background(), ProductFilter{Name: "shirt"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	future := time.Now().Add(time.Hour)
+	products, err = productRepository.Search(context.Background(), ProductQuery{Filter: ProductFilter{CreatedFrom: &future}})
+	assert.Nil(t, err)
+	assert.Len(t, products, 0)
+
+	_, err = productRepository.Search(context.Background(), ProductQuery{Filter: ProductFilter{MinPrice: &max, MaxPrice: &min}})
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+
+	yen, _ := entity.NewProduct("Yen Shirt", 3000, "JPY")
+	assert.Nil(t, productRepository.Create(context.Background(), yen))
+	products, err = productRepository.Search(context.Background(), ProductQuery{Filter: ProductFilter{Currency: "JPY", MinPrice: &min}})
+	assert.Nil(t, err)
+	assert.Len(t, products, 1)
+	assert.Equal(t, "Yen Shirt", products[0].Name)
+}
+
+func TestSearchAfter(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.Product{})
+
+	productRepository := NewProductRepository(db)
+	createdAt := time.Now().Add(-time.Hour)
+	want := map[string]bool{}
+	for i := 0; i < 7; i++ {
+		product, _ := entity.NewProduct(fmt.Sprintf("Product %d", i), 1000, "USD")
+		// Several products share a timestamp so the id tie-breaker matters.
+		product.CreatedAt = createdAt.Add(time.Duration(i/3) * time.Second)
+		assert.Nil(t, productRepository.Create(context.Background(), product))
+		want[product.ID.String()] = true
+	}
+
+	seen := map[string]bool{}
+	var after *ProductCursor
+	for {
+		products, err := productRepository.SearchAfter(context.Background(), ProductFilter{}, after, 3)
+		assert.Nil(t, err)
+		if len(products) == 0 {
+			break
+		}
+		for _, p := range products {
+			assert.False(t, seen[p.ID.String()], "duplicate %s", p.Name)
+			seen[p.ID.String()] = true
+		}
+		// Inserting mid-scan must neither skip nor repeat existing rows.
+		product, _ := entity.NewProduct("Inserted", 1000, "USD")
+		product.CreatedAt = createdAt
+		assert.Nil(t, productRepository.Create(context.Background(), product))
+
+		cursor, err := DecodeProductCursor(CursorFor(products[len(products)-1]).Encode())
+		assert.Nil(t, err)
+		after = &cursor
+	}
+	for id := range want {
+		assert.True(t, seen[id], id)
+	}
+
+	_, err = DecodeProductCursor("not a cursor")
+	assert.True(t, errors.Is(err, ErrInvalidInput))
+}
+
+func TestCancelledContext(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.Product{})
+
+	productRepository := NewProductRepository(db)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	product, _ := entity.NewProduct("Product", 1000, "USD")
+	err = productRepository.Create(ctx, product)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	_, err = productRepository.Search(ctx, ProductQuery{})
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestTrash(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.Product{}, &entity.ProductCategory{}, &entity.ProductTag{})
+
+	ctx := context.Background()
+	productRepository := NewProductRepository(db)
+	kept, _ := entity.NewProduct("Kept", 1000, "USD")
+	trashed, _ := entity.NewProduct("Trashed", 1000, "USD")
+	assert.Nil(t, productRepository.Create(ctx, kept))
+	assert.Nil(t, productRepository.Create(ctx, trashed))
+
+	rowsAffected, err := productRepository.Delete(ctx, trashed.ID.String(), trashed.Version)
+	assert.Equal(t, int64(1), rowsAffected)
+	assert.Nil(t, err)
+
+	_, err = productRepository.FindByID(ctx, trashed.ID.String())
+	assert.Equal(t, ErrNotFound, err)
+	products, err := productRepository.FindAll(ctx, 0, 0, "")
+	assert.Nil(t, err)
+	assert.Len(t, products, 1)
+
+	products, err = productRepository.Search(ctx, ProductQuery{Filter: ProductFilter{Deleted: true}})
+	assert.Nil(t, err)
+	assert.Len(t, products, 1)
+	assert.Equal(t, "Trashed", products[0].Name)
+	assert.True(t, products[0].DeletedAt.Valid)
+
+	rowsAffected, err = productRepository.Purge(ctx, kept.ID.String())
+	assert.Equal(t, int64(0), rowsAffected, "live products cannot be purged")
+	assert.Nil(t, err)
+
+	rowsAffected, err = productRepository.Restore(ctx, trashed.ID.String())
+	assert.Equal(t, int64(1), rowsAffected)
+	assert.Nil(t, err)
+	restored, err := productRepository.FindByID(ctx, trashed.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), restored.Version)
+
+	rowsAffected, err = productRepository.Restore(ctx, trashed.ID.String())
+	assert.Equal(t, int64(0), rowsAffected)
+	assert.Nil(t, err)
+}
+
+func TestPurgeDeletedBefore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.Product{}, &entity.ProductCategory{}, &entity.ProductTag{})
+
+	ctx := context.Background()
+	productRepository := NewProductRepository(db)
+	old, _ := entity.NewProduct("Old", 1000, "USD")
+	recent, _ := entity.NewProduct("Recent", 1000, "USD")
+	for _, p := range []*entity.Product{old, recent} {
+		assert.Nil(t, productRepository.Create(ctx, p))
+		_, err := productRepository.Delete(ctx, p.ID.String(), p.Version)
+		assert.Nil(t, err)
+	}
+	db.Unscoped().Model(old).Update("deleted_at", time.Now().AddDate(0, 0, -40))
+
+	purged, err := productRepository.PurgeDeletedBefore(ctx, time.Now().AddDate(0, 0, -30))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	count, err := productRepository.Count(ctx, ProductFilter{Deleted: true})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+	_, err = productRepository.Restore(ctx, old.ID.String())
+	assert.Nil(t, err)
+	_, err = productRepository.FindByID(ctx, old.ID.String())
+	assert.Equal(t, ErrNotFound, err)
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// productSortColumns whitelists the fields GET /products can order by.
+var productSortColumns = map[string]string{
+	"id":         "id",
+	"name":       "name",
+	"price":      "price_minor",
+	"created_at": "created_at",
+	"deleted_at": "deleted_at",
+}
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ProductFilter narrows a product search. Zero values do not filter.
+type ProductFilter struct {
+	Name     string
+	Currency string
+	// MinPrice and MaxPrice are in minor units and only make sense together
+	// with Currency.
+	MinPrice    *int64
+	MaxPrice    *int64
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	// CategoryID selects products assigned to the category, or to any
+	// category below it when IncludeSubcategories is set.
+	CategoryID           string
+	IncludeSubcategories bool
+	// Tags selects products carrying all of the tags.
+	Tags []string
+	// Deleted selects products in the trash instead of live ones.
+	Deleted bool
+}
+
+type ProductQuery struct {
+	Page   int
+	Limit  int
+	Sort   []SortField
+	Filter ProductFilter
+}
+
+// ParseProductSort parses "price,-name" style orderings against the
+// whitelist. The legacy values "asc" and "desc" order by created_at.
+func ParseProductSort(s string) ([]SortField, error) {
+	switch s {
+	case "":
+		return nil, nil
+	case "asc":
+		return []SortField{{Field: "created_at"}}, nil
+	case "desc":
+		return []SortField{{Field: "created_at", Desc: true}}, nil
+	}
+	var fields []SortField
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		desc := strings.HasPrefix(part, "-")
+		field := strings.TrimPrefix(strings.TrimPrefix(part, "-"), "+")
+		if _, ok := productSortColumns[field]; !ok {
+			return nil, fmt.Errorf("%w: unknown sort field %q", ErrInvalidInput, field)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("%w: duplicate sort field %q", ErrInvalidInput, field)
+		}
+		seen[field] = true
+		fields = append(fields, SortField{Field: field, Desc: desc})
+	}
+	return fields, nil
+}
+
+// Validate rejects contradictory ranges and subcategories without a category.
+func (f ProductFilter) Validate() error {
+	if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+		return fmt.Errorf("%w: min_price is greater than max_price", ErrInvalidInput)
+	}
+	if f.IncludeSubcategories && f.CategoryID == "" {
+		return fmt.Errorf("%w: include_subcategories requires category", ErrInvalidInput)
+	}
+	if f.CreatedFrom != nil && f.CreatedTo != nil && f.CreatedFrom.After(*f.CreatedTo) {
+		return fmt.Errorf("%w: created_from is after created_to", ErrInvalidInput)
+	}
+	return nil
+}
+
+// likeEscaper escapes LIKE wildcards with '!', which needs no quoting in
+// any supported dialect.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func (f ProductFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.Deleted {
+		db = db.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if f.Name != "" {
+		db = db.Where("LOWER(name) LIKE ? ESCAPE '!'", "%"+likeEscaper.Replace(strings.ToLower(f.Name))+"%")
+	}
+	if f.Currency != "" {
+		db = db.Where("currency = ?", f.Currency)
+	}
+	if f.MinPrice != nil {
+		db = db.Where("price_minor >= ?", *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		db = db.Where("price_minor <= ?", *f.MaxPrice)
+	}
+	if f.CreatedFrom != nil {
+		db = db.Where("created_at >= ?", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		db = db.Where("created_at <= ?", *f.CreatedTo)
+	}
+	if f.CategoryID != "" {
+		if f.IncludeSubcategories {
+			db = db.Where("id IN (SELECT product_id FROM product_categories WHERE category_id IN ("+categorySubtree+"))", f.CategoryID)
+		} else {
+			db = db.Where("id IN (SELECT product_id FROM product_categories WHERE category_id = ?)", f.CategoryID)
+		}
+	}
+	for _, tag := range f.Tags {
+		db = db.Where("id IN (SELECT product_id FROM product_tags WHERE tag = ?)", tag)
+	}
+	return db
+}
+
+// applySort orders by the requested fields, defaulting to created_at, with id
+// as the final tie-breaker so pages are stable.
+func applySort(db *gorm.DB, fields []SortField) *gorm.DB {
+	if len(fields) == 0 {
+		fields = []SortField{{Field: "created_at"}}
+	}
+	hasID := false
+	for _, f := range fields {
+		direction := " asc"
+		if f.Desc {
+			direction = " desc"
+		}
+		db = db.Order(productSortColumns[f.Field] + direction)
+		hasID = hasID || f.Field == "id"
+	}
+	if !hasID {
+		db = db.Order("id asc")
+	}
+	return db
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"gorm.io/gorm"
+)
+
+type RefreshTokenRepository struct {
+	DB *gorm.DB
+}
+
+func NewRefreshTokenRepository(db *gorm.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		DB: db,
+	}
+}
+
+func (r *RefreshTokenRepository) Create(ctx context.Context, token *entity.RefreshToken) error {
+	return translateError(r.DB.WithContext(ctx).Create(token).Error)
+}
+
+func (r *RefreshTokenRepository) FindByHash(ctx context.Context, hash string) (*entity.RefreshToken, error) {
+	if hash == "" {
+		return nil, ErrInvalidInput
+	}
+	var token entity.RefreshToken
+	if err := r.DB.WithContext(ctx).Where("token_hash = ?", hash).First(&token).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+// MarkUsed spends the token only if it is still unused and unrevoked, so two
+// concurrent refreshes with the same token cannot both succeed.
+func (r *RefreshTokenRepository) MarkUsed(ctx context.Context, id string) (int64, error) {
+	s := r.DB.WithContext(ctx).Model(&entity.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+		Update("used_at", time.Now())
+	return s.RowsAffected, translateError(s.Error)
+}
+
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) (int64, error) {
+	s := r.DB.WithContext(ctx).Model(&entity.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now())
+	return s.RowsAffected, translateError(s.Error)
+}
+
+// RevokeUser revokes every refresh token of a user, signing out all of
+// their sessions.
+func (r *RefreshTokenRepository) RevokeUser(ctx context.Context, userID string) (int64, error) {
+	s := r.DB.WithContext(ctx).Model(&entity.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+	return s.RowsAffected, translateError(s.Error)
+}
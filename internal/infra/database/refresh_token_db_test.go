@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCreateRefreshToken(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.RefreshToken{})
+
+	refreshTokenRepository := NewRefreshTokenRepository(db)
+	token, plain, _ := entity.NewRefreshToken(pkgentity.NewId(), pkgentity.NewId(), time.Hour)
+	err = refreshTokenRepository.Create(context.Background(), token)
+	assert.Nil(t, err)
+
+	found, err := refreshTokenRepository.FindByHash(context.Background(), entity.HashRefreshToken(plain))
+	assert.Nil(t, err)
+	assert.Equal(t, token.ID, found.ID)
+	assert.Equal(t, token.FamilyID, found.FamilyID)
+	assert.False(t, found.IsSpent())
+
+	_, err = refreshTokenRepository.FindByHash(context.Background(), entity.HashRefreshToken("unknown"))
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestMarkRefreshTokenUsed(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.RefreshToken{})
+
+	refreshTokenRepository := NewRefreshTokenRepository(db)
+	token, plain, _ := entity.NewRefreshToken(pkgentity.NewId(), pkgentity.NewId(), time.Hour)
+	assert.Nil(t, refreshTokenRepository.Create(context.Background(), token))
+
+	rows, err := refreshTokenRepository.MarkUsed(context.Background(), token.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rows)
+
+	rows, err = refreshTokenRepository.MarkUsed(context.Background(), token.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), rows)
+
+	found, _ := refreshTokenRepository.FindByHash(context.Background(), entity.HashRefreshToken(plain))
+	assert.True(t, found.IsSpent())
+}
+
+func TestRevokeRefreshTokenFamily(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.RefreshToken{})
+
+	refreshTokenRepository := NewRefreshTokenRepository(db)
+	userID, familyID := pkgentity.NewId(), pkgentity.NewId()
+	first, _, _ := entity.NewRefreshToken(userID, familyID, time.Hour)
+	second, plain, _ := entity.NewRefreshToken(userID, familyID, time.Hour)
+	other, otherPlain, _ := entity.NewRefreshToken(userID, pkgentity.NewId(), time.Hour)
+	assert.Nil(t, refreshTokenRepository.Create(context.Background(), first))
+	assert.Nil(t, refreshTokenRepository.Create(context.Background(), second))
+	assert.Nil(t, refreshTokenRepository.Create(context.Background(), other))
+
+	rows, err := refreshTokenRepository.RevokeFamily(context.Background(), familyID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), rows)
+
+	found, _ := refreshTokenRepository.FindByHash(context.Background(), entity.HashRefreshToken(plain))
+	assert.NotNil(t, found.RevokedAt)
+	found, _ = refreshTokenRepository.FindByHash(context.Background(), entity.HashRefreshToken(otherPlain))
+	assert.Nil(t, found.RevokedAt)
+}
+
+func TestRevokeRefreshTokensOfUser(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.RefreshToken{})
+
+	refreshTokenRepository := NewRefreshTokenRepository(db)
+	userID := pkgentity.NewId()
+	first, plain, _ := entity.NewRefreshToken(userID, pkgentity.NewId(), time.Hour)
+	second, _, _ := entity.NewRefreshToken(userID, pkgentity.NewId(), time.Hour)
+	other, otherPlain, _ := entity.NewRefreshToken(pkgentity.NewId(), pkgentity.NewId(), time.Hour)
+	assert.Nil(t, refreshTokenRepository.Create(context.Background(), first))
+	assert.Nil(t, refreshTokenRepository.Create(context.Background(), second))
+	assert.Nil(t, refreshTokenRepository.Create(context.Background(), other))
+
+	rows, err := refreshTokenRepository.RevokeUser(context.Background(), userID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), rows)
+
+	found, _ := refreshTokenRepository.FindByHash(context.Background(), entity.HashRefreshToken(plain))
+	assert.NotNil(t, found.RevokedAt)
+	found, _ = refreshTokenRepository.FindByHash(context.Background(), entity.HashRefreshToken(otherPlain))
+	assert.Nil(t, found.RevokedAt)
+}
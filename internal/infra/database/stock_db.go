@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+	"gorm.io/gorm"
+)
+
+// StockRepository changes product stock. Every change is a single
+// conditional UPDATE inside a transaction, so concurrent callers cannot take
+// the quantity on hand below what is reserved.
+type StockRepository struct {
+	DB *gorm.DB
+}
+
+func NewStockRepository(db *gorm.DB) *StockRepository {
+	return &StockRepository{
+		DB: db,
+	}
+}
+
+// Adjust applies movement to the product's stock and records it. It returns
+// ErrInsufficientStock if the stock would drop below the reserved quantity.
+func (r *StockRepository) Adjust(ctx context.Context, movement *entity.StockMovement) error {
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		s := tx.Model(&entity.Product{}).
+			Where("id = ? AND stock + ? >= reserved", movement.ProductID, movement.Delta).
+			Updates(map[string]any{
+				"stock":   gorm.Expr("stock + ?", movement.Delta),
+				"version": gorm.Expr("version + 1"),
+			})
+		if s.Error != nil {
+			return s.Error
+		}
+		if s.RowsAffected == 0 {
+			return stockShortfall(tx, movement.ProductID)
+		}
+		return tx.Create(movement).Error
+	})
+	return translateError(err)
+}
+
+// Reserve holds reservation.Quantity units of the product, first releasing
+// its lapsed reservations. It returns ErrInsufficientStock if not enough
+// stock is available.
+func (r *StockRepository) Reserve(ctx context.Context, reservation *entity.Reservation) error {
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := expireReservations(tx.Where("product_id = ?", reservation.ProductID), time.Now()); err != nil {
+			return err
+		}
+		s := tx.Model(&entity.Product{}).
+			Where("id = ? AND stock - reserved >= ?", reservation.ProductID, reservation.Quantity).
+			Updates(map[string]any{
+				"reserved": gorm.Expr("reserved + ?", reservation.Quantity),
+				"version":  gorm.Expr("version + 1"),
+			})
+		if s.Error != nil {
+			return s.Error
+		}
+		if s.RowsAffected == 0 {
+			return stockShortfall(tx, reservation.ProductID)
+		}
+		return tx.Create(reservation).Error
+	})
+	return translateError(err)
+}
+
+func (r *StockRepository) FindReservation(ctx context.Context, id string) (*entity.Reservation, error) {
+	var reservation entity.Reservation
+	err := r.DB.WithContext(ctx).First(&reservation, "id = ?", id).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &reservation, nil
+}
+
+// Commit turns a pending reservation into a sale: the reserved units leave
+// the stock and a StockSold movement is recorded.
+func (r *StockRepository) Commit(ctx context.Context, id string) (*entity.Reservation, error) {
+	var reservation entity.Reservation
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&reservation, "id = ?", id).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		if reservation.Status != entity.ReservationPending {
+			return ErrReservationClosed
+		}
+		if !reservation.Open(now) {
+			return ErrReservationExpired
+		}
+		if err := closeReservation(tx, &reservation, entity.ReservationCommitted, now); err != nil {
+			return err
+		}
+		return tx.Create(&entity.StockMovement{
+			ID:            pkgentity.NewId(),
+			ProductID:     reservation.ProductID,
+			Delta:         -reservation.Quantity,
+			Reason:        entity.StockSold,
+			ReservationID: reservation.ID.String(),
+			CreatedAt:     now,
+		}).Error
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &reservation, nil
+}
+
+// Release returns the units of a pending reservation to the available stock.
+func (r *StockRepository) Release(ctx context.Context, id string) (*entity.Reservation, error) {
+	var reservation entity.Reservation
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&reservation, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if reservation.Status != entity.ReservationPending {
+			return ErrReservationClosed
+		}
+		return closeReservation(tx, &reservation, entity.ReservationReleased, time.Now())
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &reservation, nil
+}
+
+// ReleaseExpired marks pending reservations that lapsed before now as
+// expired and frees their stock.
+func (r *StockRepository) ReleaseExpired(ctx context.Context, now time.Time) (int64, error) {
+	var n int64
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		n, err = expireReservations(tx, now)
+		return err
+	})
+	return n, translateError(err)
+}
+
+// expireReservations expires the pending reservations selected by db that
+// lapsed before now.
+func expireReservations(db *gorm.DB, now time.Time) (int64, error) {
+	var lapsed []entity.Reservation
+	err := db.Where("status = ? AND expires_at <= ?", entity.ReservationPending, now).
+		Find(&lapsed).Error
+	if err != nil {
+		return 0, err
+	}
+	tx := db.Session(&gorm.Session{NewDB: true})
+	for i := range lapsed {
+		if err := closeReservation(tx, &lapsed[i], entity.ReservationExpired, now); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(lapsed)), nil
+}
+
+// closeReservation moves a pending reservation to status and gives back its
+// hold on the product. Committing also takes the units out of stock. The
+// status change is conditional, so a reservation closes only once.
+func closeReservation(tx *gorm.DB, reservation *entity.Reservation, status string, now time.Time) error {
+	s := tx.Model(&entity.Reservation{}).
+		Where("id = ? AND status = ?", reservation.ID, entity.ReservationPending).
+		Updates(map[string]any{"status": status, "updated_at": now})
+	if s.Error != nil {
+		return s.Error
+	}
+	if s.RowsAffected == 0 {
+		return ErrReservationClosed
+	}
+	updates := map[string]any{
+		"reserved": gorm.Expr("reserved - ?", reservation.Quantity),
+		"version":  gorm.Expr("version + 1"),
+	}
+	if status == entity.ReservationCommitted {
+		updates["stock"] = gorm.Expr("stock - ?", reservation.Quantity)
+	}
+	// a trashed product still owes its reservations
+	err := tx.Unscoped().Model(&entity.Product{}).Where("id = ?", reservation.ProductID).Updates(updates).Error
+	if err != nil {
+		return err
+	}
+	reservation.Status, reservation.UpdatedAt = status, now
+	return nil
+}
+
+// stockShortfall explains a conditional stock update that affected no rows.
+func stockShortfall(tx *gorm.DB, productID pkgentity.ID) error {
+	var count int64
+	if err := tx.Model(&entity.Product{}).Where("id = ?", productID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrInsufficientStock
+}
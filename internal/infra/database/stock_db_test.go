@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// stockFixture creates a product with stock units on hand.
+func stockFixture(t *testing.T, db *gorm.DB, stock int64) (*StockRepository, *entity.Product) {
+	db.AutoMigrate(&entity.Product{}, &entity.StockMovement{}, &entity.Reservation{})
+	product, _ := entity.NewProduct("Product", 1000, "USD")
+	assert.Nil(t, NewProductRepository(db).Create(context.Background(), product))
+	stockRepository := NewStockRepository(db)
+	movement, err := entity.NewStockAdjustment(product.ID, stock, entity.StockReceived, "")
+	assert.Nil(t, err)
+	assert.Nil(t, stockRepository.Adjust(context.Background(), movement))
+	return stockRepository, product
+}
+
+func TestAdjustStock(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	stockRepository, product := stockFixture(t, db, 10)
+	stored, err := NewProductRepository(db).FindByID(context.Background(), product.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), stored.Stock)
+	assert.Equal(t, int64(2), stored.Version)
+
+	movement, _ := entity.NewStockAdjustment(product.ID, -11, entity.StockLost, "")
+	assert.Equal(t, ErrInsufficientStock, stockRepository.Adjust(context.Background(), movement))
+
+	reservation, _ := entity.NewReservation(product.ID, 4, time.Minute)
+	assert.Nil(t, stockRepository.Reserve(context.Background(), reservation))
+	// reserved units cannot be written off
+	movement, _ = entity.NewStockAdjustment(product.ID, -7, entity.StockDamaged, "")
+	assert.Equal(t, ErrInsufficientStock, stockRepository.Adjust(context.Background(), movement))
+	movement, _ = entity.NewStockAdjustment(product.ID, -6, entity.StockDamaged, "")
+	assert.Nil(t, stockRepository.Adjust(context.Background(), movement))
+
+	var movements []entity.StockMovement
+	assert.Nil(t, db.Where("product_id = ?", product.ID).Order("created_at").Find(&movements).Error)
+	assert.Len(t, movements, 2)
+
+	movement, _ = entity.NewStockAdjustment(pkgentity.NewId(), 1, entity.StockReceived, "")
+	assert.Equal(t, ErrNotFound, stockRepository.Adjust(context.Background(), movement))
+}
+
+func TestReserveCommitRelease(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	stockRepository, product := stockFixture(t, db, 5)
+	productRepository := NewProductRepository(db)
+
+	sold, _ := entity.NewReservation(product.ID, 3, time.Minute)
+	assert.Nil(t, stockRepository.Reserve(context.Background(), sold))
+	held, _ := entity.NewReservation(product.ID, 3, time.Minute)
+	assert.Equal(t, ErrInsufficientStock, stockRepository.Reserve(context.Background(), held))
+	held.Quantity = 2
+	assert.Nil(t, stockRepository.Reserve(context.Background(), held))
+
+	committed, err := stockRepository.Commit(context.Background(), sold.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ReservationCommitted, committed.Status)
+	_, err = stockRepository.Commit(context.Background(), sold.ID.String())
+	assert.Equal(t, ErrReservationClosed, err)
+
+	released, err := stockRepository.Release(context.Background(), held.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ReservationReleased, released.Status)
+	_, err = stockRepository.Release(context.Background(), held.ID.String())
+	assert.Equal(t, ErrReservationClosed, err)
+
+	stored, err := productRepository.FindByID(context.Background(), product.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), stored.Stock)
+	assert.Equal(t, int64(0), stored.Reserved)
+
+	var movement entity.StockMovement
+	assert.Nil(t, db.Where("reservation_id = ?", sold.ID.String()).First(&movement).Error)
+	assert.Equal(t, int64(-3), movement.Delta)
+	assert.Equal(t, entity.StockSold, movement.Reason)
+
+	_, err = stockRepository.FindReservation(context.Background(), pkgentity.NewId().String())
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestReservationExpiry(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	stockRepository, product := stockFixture(t, db, 5)
+	lapsed, _ := entity.NewReservation(product.ID, 5, time.Minute)
+	assert.Nil(t, stockRepository.Reserve(context.Background(), lapsed))
+	assert.Nil(t, db.Model(lapsed).Update("expires_at", time.Now().Add(-time.Second)).Error)
+
+	_, err = stockRepository.Commit(context.Background(), lapsed.ID.String())
+	assert.Equal(t, ErrReservationExpired, err)
+
+	// a new reservation reclaims the lapsed hold
+	next, _ := entity.NewReservation(product.ID, 5, time.Minute)
+	assert.Nil(t, stockRepository.Reserve(context.Background(), next))
+	stored, err := stockRepository.FindReservation(context.Background(), lapsed.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, entity.ReservationExpired, stored.Status)
+
+	n, err := stockRepository.ReleaseExpired(context.Background(), time.Now().Add(2*time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	p, err := NewProductRepository(db).FindByID(context.Background(), product.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), p.Reserved)
+	assert.Equal(t, int64(5), p.Stock)
+}
+
+func TestReserveConcurrently(t *testing.T) {
+	// a file database, so each goroutine can hold its own connection
+	dsn := filepath.Join(t.TempDir(), "stock.db") + "?_busy_timeout=10000&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	stockRepository, product := stockFixture(t, db, 10)
+	var wg sync.WaitGroup
+	var reserved, short atomic.Int64
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reservation, _ := entity.NewReservation(product.ID, 1, time.Minute)
+			err := stockRepository.Reserve(context.Background(), reservation)
+			switch {
+			case err == nil:
+				reserved.Add(1)
+			case errors.Is(err, ErrInsufficientStock):
+				short.Add(1)
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(10), reserved.Load())
+	assert.Equal(t, int64(30), short.Load())
+	stored, err := NewProductRepository(db).FindByID(context.Background(), product.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), stored.Reserved)
+	var count int64
+	assert.Nil(t, db.Model(&entity.Reservation{}).Where("status = ?", entity.ReservationPending).Count(&count).Error)
+	assert.Equal(t, int64(10), count)
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+	"gorm.io/gorm"
+)
+
+type TagRepository struct {
+	DB *gorm.DB
+}
+
+func NewTagRepository(db *gorm.DB) *TagRepository {
+	return &TagRepository{
+		DB: db,
+	}
+}
+
+// SetProductTags replaces the tags of a product. Tags are stored as given;
+// callers normalize them with entity.NormalizeTags.
+func (r *TagRepository) SetProductTags(ctx context.Context, productID string, tags []string) error {
+	id, err := pkgentity.ParseId(productID)
+	if err != nil {
+		return ErrInvalidInput
+	}
+	rows := make([]entity.ProductTag, 0, len(tags))
+	for _, tag := range tags {
+		rows = append(rows, entity.ProductTag{ProductID: id, Tag: tag})
+	}
+	err = r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id = ?", id).Delete(&entity.ProductTag{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+	return translateError(err)
+}
+
+// FindProductTags lists the tags of a product alphabetically.
+func (r *TagRepository) FindProductTags(ctx context.Context, productID string) ([]string, error) {
+	tags := []string{}
+	err := r.DB.WithContext(ctx).Model(&entity.ProductTag{}).
+		Where("product_id = ?", productID).Order("tag asc").Pluck("tag", &tags).Error
+	return tags, translateError(err)
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Repositories groups the repositories a unit of work can use. Built on a
+// transaction, they all read and write through it.
+type Repositories struct {
+	Products       ProductRepositoryInterface
+	Stock          StockRepositoryInterface
+	Categories     CategoryRepositoryInterface
+	Tags           TagRepositoryInterface
+	Audit          AuditRepositoryInterface
+	Users          UserRepositoryInterface
+	PasswordResets PasswordResetRepositoryInterface
+	RefreshTokens  RefreshTokenRepositoryInterface
+}
+
+// NewRepositories builds every repository on db, which may be a
+// transaction.
+func NewRepositories(db *gorm.DB) Repositories {
+	return Repositories{
+		Products:       NewProductRepository(db),
+		Stock:          NewStockRepository(db),
+		Categories:     NewCategoryRepository(db),
+		Tags:           NewTagRepository(db),
+		Audit:          NewAuditRepository(db),
+		Users:          NewUserRepository(db),
+		PasswordResets: NewPasswordResetRepository(db),
+		RefreshTokens:  NewRefreshTokenRepository(db),
+	}
+}
+
+type UnitOfWork struct {
+	DB *gorm.DB
+}
+
+func NewUnitOfWork(db *gorm.DB) *UnitOfWork {
+	return &UnitOfWork{
+		DB: db,
+	}
+}
+
+// Do runs fn with repositories scoped to a single transaction. The
+// transaction commits when fn returns nil and rolls back otherwise, and
+// fn's error is returned unchanged. Repository methods that open their own
+// transaction nest inside it as savepoints.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(repos Repositories) error) error {
+	return u.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(NewRepositories(tx))
+	})
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestUnitOfWork(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	db.AutoMigrate(&entity.Product{}, &entity.ProductCategory{}, &entity.ProductTag{}, &entity.AuditEntry{})
+	ctx := context.Background()
+	products := NewProductRepository(db)
+	uow := NewUnitOfWork(db)
+
+	kept, _ := entity.NewProduct("Kept", 100, "USD")
+	err = uow.Do(ctx, func(repos Repositories) error {
+		if err := repos.Products.Create(ctx, kept); err != nil {
+			return err
+		}
+		entry, _ := entity.NewAuditEntry("", entity.AuditCreate, "product", kept.ID.String(), nil, kept, "")
+		return repos.Audit.Create(ctx, entry)
+	})
+	assert.Nil(t, err)
+	_, err = products.FindByID(ctx, kept.ID.String())
+	assert.Nil(t, err)
+
+	failed := errors.New("failed")
+	dropped, _ := entity.NewProduct("Dropped", 100, "USD")
+	err = uow.Do(ctx, func(repos Repositories) error {
+		if err := repos.Products.Create(ctx, dropped); err != nil {
+			return err
+		}
+		kept.Name = "Renamed"
+		if _, err := repos.Products.Update(ctx, kept); err != nil {
+			return err
+		}
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	_, err = products.FindByID(ctx, dropped.ID.String())
+	assert.ErrorIs(t, err, ErrNotFound)
+	found, err := products.FindByID(ctx, kept.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, "Kept", found.Name)
+	assert.Equal(t, int64(1), found.Version)
+
+	var entries int64
+	db.Model(&entity.AuditEntry{}).Count(&entries)
+	assert.Equal(t, int64(1), entries)
+}
@@ -1,8 +1,12 @@
 package database
 
 import (
+	"context"
+	"time"
+
 	"github.com/antoniofmoliveira/apis/internal/entity"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository struct {
@@ -15,15 +19,106 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 	}
 }
 
-func (r *UserRepository) FindByEmail(email string) (*entity.User, error) {
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*entity.User, error) {
+	if email == "" {
+		return nil, ErrInvalidInput
+	}
 	var user entity.User
-	if err := r.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, err
+	if err := r.DB.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, translateError(err)
 	}
 
 	return &user, nil
 }
 
-func (r *UserRepository) Create(user *entity.User) error {
-	return r.DB.Create(user).Error
+func (r *UserRepository) FindByID(ctx context.Context, id string) (*entity.User, error) {
+	if id == "" {
+		return nil, ErrInvalidInput
+	}
+	var user entity.User
+	if err := r.DB.WithContext(ctx).Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	return &user, nil
+}
+
+// CountByRole counts users holding role in their comma separated roles column.
+// Inside a transaction their rows stay locked until it ends, so concurrent
+// transactions cannot each count the other's user and both remove theirs.
+func (r *UserRepository) CountByRole(ctx context.Context, role string) (int64, error) {
+	var ids []string
+	err := r.DB.WithContext(ctx).Model(&entity.User{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("roles = ? OR roles LIKE ? OR roles LIKE ? OR roles LIKE ?",
+			role, role+",%", "%,"+role, "%,"+role+",%").
+		Pluck("id", &ids).Error
+	return int64(len(ids)), translateError(err)
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *entity.User) error {
+	return translateError(r.DB.WithContext(ctx).Create(user).Error)
+}
+
+// Update saves the name, email and roles of user. The password and login
+// counters are left alone.
+func (r *UserRepository) Update(ctx context.Context, user *entity.User) (int64, error) {
+	s := r.DB.WithContext(ctx).Model(user).Select("name", "email", "roles").Updates(user)
+	return s.RowsAffected, translateError(s.Error)
+}
+
+// UpdatePassword replaces the stored bcrypt hash of the user's password.
+func (r *UserRepository) UpdatePassword(ctx context.Context, id, hash string) (int64, error) {
+	if id == "" || hash == "" {
+		return 0, ErrInvalidInput
+	}
+	s := r.DB.WithContext(ctx).Model(&entity.User{}).Where("id = ?", id).Update("password", hash)
+	return s.RowsAffected, translateError(s.Error)
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id string) (int64, error) {
+	if id == "" {
+		return 0, ErrInvalidInput
+	}
+	s := r.DB.WithContext(ctx).Where("id = ?", id).Delete(&entity.User{})
+	return s.RowsAffected, translateError(s.Error)
+}
+
+// RecordFailedLogin counts a failed login and locks the account for as long
+// as policy says, returning the lock expiry or nil. The count is bumped in
+// SQL so concurrent failures are all counted.
+func (r *UserRepository) RecordFailedLogin(ctx context.Context, id string, policy entity.LockoutPolicy, now time.Time) (*time.Time, error) {
+	if id == "" {
+		return nil, ErrInvalidInput
+	}
+	var lockedUntil *time.Time
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.User{}).Where("id = ?", id).Update("failed_logins", gorm.Expr("failed_logins + 1")).Error; err != nil {
+			return err
+		}
+		var failures int
+		if err := tx.Model(&entity.User{}).Where("id = ?", id).Select("failed_logins").Scan(&failures).Error; err != nil {
+			return err
+		}
+		d := policy.LockDuration(failures)
+		if d == 0 {
+			return nil
+		}
+		until := now.Add(d)
+		lockedUntil = &until
+		return tx.Model(&entity.User{}).Where("id = ?", id).Update("locked_until", until).Error
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return lockedUntil, nil
+}
+
+// ResetFailedLogins clears the failure count and any lock after a
+// successful login. Users without failures are not written.
+func (r *UserRepository) ResetFailedLogins(ctx context.Context, id string) error {
+	err := r.DB.WithContext(ctx).Model(&entity.User{}).
+		Where("id = ? AND (failed_logins > 0 OR locked_until IS NOT NULL)", id).
+		Updates(map[string]any{"failed_logins": 0, "locked_until": nil}).Error
+	return translateError(err)
 }
@@ -1,9 +1,12 @@
 package database
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/antoniofmoliveira/apis/internal/entity"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -20,10 +23,10 @@ func TestCreateUser(t *testing.T) {
 
 	userRepository := NewUserRepository(db)
 	user, _ := entity.NewUser("John Doe", "j@j.com", "123456")
-	err = userRepository.Create(user)
+	err = userRepository.Create(context.Background(), user)
 	assert.Nil(t, err)
 
-	user, err = userRepository.FindByEmail("j@j.com")
+	user, err = userRepository.FindByEmail(context.Background(), "j@j.com")
 	assert.Nil(t, err)
 	assert.NotNil(t, user)
 	assert.Equal(t, user.Email, "j@j.com")
@@ -42,10 +45,10 @@ func TestFindByEmail(t *testing.T) {
 
 	userRepository := NewUserRepository(db)
 	user, _ := entity.NewUser("John Doe", "j@j.com", "123456")
-	err = userRepository.Create(user)
+	err = userRepository.Create(context.Background(), user)
 	assert.Nil(t, err)
 
-	user, err = userRepository.FindByEmail("j@j.com")
+	user, err = userRepository.FindByEmail(context.Background(), "j@j.com")
 	assert.Nil(t, err)
 	assert.NotNil(t, user)
 	assert.Equal(t, user.Email, "j@j.com")
@@ -63,6 +66,202 @@ func TestFindByEmailNotFound(t *testing.T) {
 	db.AutoMigrate(&entity.User{})
 
 	userRepository := NewUserRepository(db)
-	_, err = userRepository.FindByEmail("j@j.com")
-	assert.NotNil(t, err)
+	_, err = userRepository.FindByEmail(context.Background(), "j@j.com")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestCreateUserConflict(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{TranslateError: true})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.User{})
+
+	userRepository := NewUserRepository(db)
+	user, _ := entity.NewUser("John Doe", "j@j.com", "123456")
+	err = userRepository.Create(context.Background(), user)
+	assert.Nil(t, err)
+
+	user, _ = entity.NewUser("Jane Doe", "j@j.com", "654321")
+	err = userRepository.Create(context.Background(), user)
+	assert.Equal(t, ErrConflict, err)
+}
+
+func TestFindUserByID(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.User{})
+
+	userRepository := NewUserRepository(db)
+	user, _ := entity.NewUser("John Doe", "j@j.com", "123456")
+	user.SetRoles(entity.RoleAdmin, entity.RoleViewer)
+	err = userRepository.Create(context.Background(), user)
+	assert.Nil(t, err)
+
+	found, err := userRepository.FindByID(context.Background(), user.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, user.Email, found.Email)
+	assert.Equal(t, entity.Roles{entity.RoleAdmin, entity.RoleViewer}, found.Roles)
+
+	_, err = userRepository.FindByID(context.Background(), pkgentity.NewId().String())
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestCountUsersByRole(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.User{})
+
+	userRepository := NewUserRepository(db)
+	viewer, _ := entity.NewUser("John Doe", "j@j.com", "123456")
+	admin, _ := entity.NewUser("Jane Doe", "jane@j.com", "123456")
+	admin.SetRoles(entity.RoleViewer, entity.RoleAdmin)
+	assert.Nil(t, userRepository.Create(context.Background(), viewer))
+
+	count, err := userRepository.CountByRole(context.Background(), entity.RoleAdmin)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	assert.Nil(t, userRepository.Create(context.Background(), admin))
+	count, err = userRepository.CountByRole(context.Background(), entity.RoleAdmin)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+	count, err = userRepository.CountByRole(context.Background(), entity.RoleViewer)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestRecordFailedLogin(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.User{})
+
+	userRepository := NewUserRepository(db)
+	ctx := context.Background()
+	user, _ := entity.NewUser("John Doe", "j@j.com", "123456")
+	userRepository.Create(ctx, user)
+	id := user.ID.String()
+	policy := entity.LockoutPolicy{Threshold: 2, Duration: time.Minute, MaxDuration: time.Hour}
+	now := time.Now()
+
+	lockedUntil, err := userRepository.RecordFailedLogin(ctx, id, policy, now)
+	assert.Nil(t, err)
+	assert.Nil(t, lockedUntil)
+	lockedUntil, err = userRepository.RecordFailedLogin(ctx, id, policy, now)
+	assert.Nil(t, err)
+	assert.WithinDuration(t, now.Add(time.Minute), *lockedUntil, time.Millisecond)
+	lockedUntil, _ = userRepository.RecordFailedLogin(ctx, id, policy, now)
+	assert.WithinDuration(t, now.Add(2*time.Minute), *lockedUntil, time.Millisecond)
+
+	found, _ := userRepository.FindByID(ctx, id)
+	assert.Equal(t, 3, found.FailedLogins)
+	assert.True(t, found.IsLocked(now))
+
+	assert.Nil(t, userRepository.ResetFailedLogins(ctx, id))
+	found, _ = userRepository.FindByID(ctx, id)
+	assert.Equal(t, 0, found.FailedLogins)
+	assert.Nil(t, found.LockedUntil)
+}
+
+func TestUpdateUser(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{TranslateError: true})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.User{})
+
+	userRepository := NewUserRepository(db)
+	ctx := context.Background()
+	user, _ := entity.NewUser("John Doe", "j@j.com", "123456")
+	other, _ := entity.NewUser("Jane Doe", "jane@j.com", "123456")
+	userRepository.Create(ctx, user)
+	userRepository.Create(ctx, other)
+
+	changed := *user
+	changed.Name, changed.Email, changed.Password = "Johnny Doe", "johnny@j.com", ""
+	changed.SetRoles(entity.RoleAdmin)
+	rows, err := userRepository.Update(ctx, &changed)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rows)
+
+	found, _ := userRepository.FindByID(ctx, user.ID.String())
+	assert.Equal(t, "Johnny Doe", found.Name)
+	assert.Equal(t, "johnny@j.com", found.Email)
+	assert.Equal(t, entity.Roles{entity.RoleAdmin}, found.Roles)
+	assert.True(t, found.ValidatePassword("123456"))
+
+	changed.Email = "jane@j.com"
+	_, err = userRepository.Update(ctx, &changed)
+	assert.Equal(t, ErrConflict, err)
+
+	missing, _ := entity.NewUser("Nobody", "n@j.com", "123456")
+	rows, err = userRepository.Update(ctx, missing)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), rows)
+}
+
+func TestUpdateUserPassword(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.User{})
+
+	userRepository := NewUserRepository(db)
+	ctx := context.Background()
+	user, _ := entity.NewUser("John Doe", "j@j.com", "123456")
+	userRepository.Create(ctx, user)
+
+	user.SetPassword("654321")
+	rows, err := userRepository.UpdatePassword(ctx, user.ID.String(), user.Password)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rows)
+	found, _ := userRepository.FindByID(ctx, user.ID.String())
+	assert.True(t, found.ValidatePassword("654321"))
+
+	_, err = userRepository.UpdatePassword(ctx, user.ID.String(), "")
+	assert.Equal(t, ErrInvalidInput, err)
+}
+
+func TestDeleteUser(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	db.AutoMigrate(&entity.User{})
+
+	userRepository := NewUserRepository(db)
+	ctx := context.Background()
+	user, _ := entity.NewUser("John Doe", "j@j.com", "123456")
+	userRepository.Create(ctx, user)
+
+	rows, err := userRepository.Delete(ctx, user.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), rows)
+	_, err = userRepository.FindByID(ctx, user.ID.String())
+	assert.Equal(t, ErrNotFound, err)
+
+	rows, err = userRepository.Delete(ctx, user.ID.String())
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), rows)
 }
@@ -0,0 +1,248 @@
+package jwtkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+var (
+	ErrNoKeys            = errors.New("no signing keys configured")
+	ErrInvalidKeySpec    = errors.New("invalid key spec, expected kid=path")
+	ErrDuplicateKeyID    = errors.New("duplicate key id")
+	ErrUnsupportedKey    = errors.New("unsupported key type")
+	ErrSigningKeyMissing = errors.New("signing key not found or has no private part")
+	ErrUnknownKeyID      = errors.New("unknown key id")
+	ErrAlgorithmMismatch = errors.New("token algorithm does not match key")
+)
+
+// Key is one verification key, optionally with the private part used to sign.
+type Key struct {
+	ID        string
+	Algorithm jwa.SignatureAlgorithm
+	Private   interface{}
+	Public    interface{}
+}
+
+// KeyRing signs with a single key and verifies with any key it holds, which
+// lets keys rotate without invalidating tokens signed by the previous one.
+type KeyRing struct {
+	signing *Key
+	keys    map[string]*Key
+	order   []string
+}
+
+// NewHMAC returns a ring holding only the shared HS256 secret. Tokens carry
+// no kid, matching those issued before asymmetric keys were supported.
+func NewHMAC(secret []byte) *KeyRing {
+	key := &Key{Algorithm: jwa.HS256, Private: secret, Public: secret}
+	return &KeyRing{
+		signing: key,
+		keys:    map[string]*Key{"": key},
+		order:   []string{""},
+	}
+}
+
+// New builds a ring from keys, signing with the key whose ID is signingKID.
+// An empty signingKID selects the first key that has a private part.
+func New(keys []*Key, signingKID string) (*KeyRing, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	ring := &KeyRing{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if _, ok := ring.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateKeyID, key.ID)
+		}
+		ring.keys[key.ID] = key
+		ring.order = append(ring.order, key.ID)
+		if ring.signing == nil && key.Private != nil && (signingKID == "" || signingKID == key.ID) {
+			ring.signing = key
+		}
+	}
+	if ring.signing == nil {
+		return nil, fmt.Errorf("%w: %q", ErrSigningKeyMissing, signingKID)
+	}
+	return ring, nil
+}
+
+// Load reads keys from a comma separated list of kid=path pairs pointing to
+// PEM encoded private or public keys.
+func Load(spec, signingKID string) (*KeyRing, error) {
+	var keys []*Key
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kid, path, ok := strings.Cut(pair, "=")
+		if !ok || kid == "" || path == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidKeySpec, pair)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParsePEM(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", kid, err)
+		}
+		keys = append(keys, key)
+	}
+	return New(keys, signingKID)
+}
+
+// ParsePEM decodes a PKCS#1, PKCS#8, SEC 1 or PKIX key and picks the
+// algorithm from its type: RS256 for RSA, ES256 for P-256, EdDSA for Ed25519.
+func ParsePEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var raw interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		raw, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		raw, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		raw, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		raw, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		raw, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: PEM type %q", ErrUnsupportedKey, block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newKey(kid, raw)
+}
+
+func newKey(kid string, raw interface{}) (*Key, error) {
+	key := &Key{ID: kid}
+	switch k := raw.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm, key.Private, key.Public = jwa.RS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Algorithm, key.Public = jwa.RS256, k
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Curve.Params().Name)
+		}
+		key.Algorithm, key.Private, key.Public = jwa.ES256, k, &k.PublicKey
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedKey, k.Curve.Params().Name)
+		}
+		key.Algorithm, key.Public = jwa.ES256, k
+	case ed25519.PrivateKey:
+		key.Algorithm, key.Private, key.Public = jwa.EdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Algorithm, key.Public = jwa.EdDSA, k
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, raw)
+	}
+	return key, nil
+}
+
+// TokenAuth returns the jwtauth signer for the signing key. Asymmetric keys
+// are wrapped in a JWK so their kid is written to the token header.
+func (k *KeyRing) TokenAuth() (*jwtauth.JWTAuth, error) {
+	if k.signing.ID == "" {
+		return jwtauth.New(k.signing.Algorithm.String(), k.signing.Private, nil), nil
+	}
+	signKey, err := jwk.New(k.signing.Private)
+	if err != nil {
+		return nil, err
+	}
+	if err := signKey.Set(jwk.KeyIDKey, k.signing.ID); err != nil {
+		return nil, err
+	}
+	return jwtauth.New(k.signing.Algorithm.String(), signKey, nil), nil
+}
+
+// Verify checks the token signature with the key named by its kid header and
+// validates its claims.
+func (k *KeyRing) Verify(tokenString string) (jwt.Token, error) {
+	msg, err := jws.ParseString(tokenString)
+	if err != nil || len(msg.Signatures()) != 1 {
+		return nil, jwtauth.ErrUnauthorized
+	}
+	headers := msg.Signatures()[0].ProtectedHeaders()
+	key, ok := k.keys[headers.KeyID()]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyID, headers.KeyID())
+	}
+	if headers.Algorithm() != key.Algorithm {
+		return nil, ErrAlgorithmMismatch
+	}
+	token, err := jwt.ParseString(tokenString, jwt.WithVerify(key.Algorithm, key.Public))
+	if err != nil {
+		return nil, jwtauth.ErrorReason(err)
+	}
+	if err := jwt.Validate(token); err != nil {
+		return token, jwtauth.ErrorReason(err)
+	}
+	return token, nil
+}
+
+// Verifier is the KeyRing counterpart of jwtauth.Verifier. It stores the
+// token and error in the request context for jwtauth.Authenticator.
+func (k *KeyRing) Verifier() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var token jwt.Token
+			err := jwtauth.ErrNoTokenFound
+			if tokenString := jwtauth.TokenFromHeader(r); tokenString != "" {
+				token, err = k.Verify(tokenString)
+			} else if tokenString := jwtauth.TokenFromCookie(r); tokenString != "" {
+				token, err = k.Verify(tokenString)
+			}
+			next.ServeHTTP(w, r.WithContext(jwtauth.NewContext(r.Context(), token, err)))
+		})
+	}
+}
+
+// PublicSet returns the public keys as a JWK set. Shared HMAC secrets are
+// never published.
+func (k *KeyRing) PublicSet() (jwk.Set, error) {
+	set := jwk.NewSet()
+	for _, kid := range k.order {
+		key := k.keys[kid]
+		if key.Algorithm == jwa.HS256 {
+			continue
+		}
+		pub, err := jwk.New(key.Public)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range map[string]interface{}{
+			jwk.KeyIDKey:     key.ID,
+			jwk.AlgorithmKey: key.Algorithm.String(),
+			jwk.KeyUsageKey:  string(jwk.ForSignature),
+		} {
+			if err := pub.Set(name, value); err != nil {
+				return nil, err
+			}
+		}
+		set.Add(pub)
+	}
+	return set, nil
+}
@@ -0,0 +1,164 @@
+package jwtkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/jwtauth"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(t *testing.T, ring *KeyRing) string {
+	auth, err := ring.TokenAuth()
+	assert.Nil(t, err)
+	_, token, err := auth.Encode(map[string]interface{}{"sub": "1", "exp": time.Now().Add(time.Minute).Unix()})
+	assert.Nil(t, err)
+	return token
+}
+
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	path := filepath.Join(dir, name)
+	assert.Nil(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600))
+	return path
+}
+
+func TestSignAndVerifyAlgorithms(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	cases := []struct {
+		raw interface{}
+		alg jwa.SignatureAlgorithm
+	}{
+		{rsaKey, jwa.RS256},
+		{ecKey, jwa.ES256},
+		{edKey, jwa.EdDSA},
+	}
+	for _, c := range cases {
+		key, err := newKey("k1", c.raw)
+		assert.Nil(t, err)
+		assert.Equal(t, c.alg, key.Algorithm)
+
+		ring, err := New([]*Key{key}, "")
+		assert.Nil(t, err)
+		token, err := ring.Verify(sign(t, ring))
+		assert.Nil(t, err, c.alg)
+		assert.Equal(t, "1", token.Subject())
+	}
+}
+
+func TestRotation(t *testing.T) {
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey1, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	oldPrivate, _ := newKey("old", oldKey)
+	oldRing, _ := New([]*Key{oldPrivate}, "old")
+	oldToken := sign(t, oldRing)
+
+	// the old private key is retired, only its public part remains
+	oldPublic, _ := newKey("old", &oldKey.PublicKey)
+	current, _ := newKey("new", newKey1)
+	ring, err := New([]*Key{oldPublic, current}, "new")
+	assert.Nil(t, err)
+
+	_, err = ring.Verify(oldToken)
+	assert.Nil(t, err)
+	_, err = ring.Verify(sign(t, ring))
+	assert.Nil(t, err)
+
+	unknown, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := newKey("other", unknown)
+	otherRing, _ := New([]*Key{other}, "")
+	_, err = ring.Verify(sign(t, otherRing))
+	assert.True(t, errors.Is(err, ErrUnknownKeyID))
+}
+
+func TestNewRequiresPrivateSigningKey(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	public, _ := newKey("pub", &ecKey.PublicKey)
+	_, err := New([]*Key{public}, "")
+	assert.True(t, errors.Is(err, ErrSigningKeyMissing))
+	_, err = New(nil, "")
+	assert.Equal(t, ErrNoKeys, err)
+}
+
+func TestHMACCompatibility(t *testing.T) {
+	ring := NewHMAC([]byte("secret"))
+	_, legacy, _ := jwtauth.New("HS256", []byte("secret"), nil).Encode(map[string]interface{}{"sub": "1"})
+	_, err := ring.Verify(legacy)
+	assert.Nil(t, err)
+
+	set, err := ring.PublicSet()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, set.Len())
+}
+
+func TestAlgorithmMismatch(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, _ := newKey("k1", ecKey)
+	ring, _ := New([]*Key{key}, "")
+
+	forged := jwtauth.New("HS256", []byte("secret"), nil)
+	_, token, _ := forged.Encode(map[string]interface{}{"sub": "1"})
+	_, err := ring.Verify(token)
+	assert.NotNil(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	edPubDER, _ := x509.MarshalPKIXPublicKey(edKey.Public())
+
+	rsaPath := writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	edPath := writePEM(t, dir, "ed.pem", "PRIVATE KEY", edDER)
+	edPubPath := writePEM(t, dir, "ed.pub.pem", "PUBLIC KEY", edPubDER)
+
+	ring, err := Load("a="+rsaPath+", b="+edPath+",c="+edPubPath, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", ring.signing.ID)
+	assert.Equal(t, jwa.EdDSA, ring.signing.Algorithm)
+
+	set, err := ring.PublicSet()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, set.Len())
+	buf, _ := json.Marshal(set)
+	assert.NotContains(t, string(buf), `"d"`)
+
+	_, err = Load("a", "")
+	assert.True(t, errors.Is(err, ErrInvalidKeySpec))
+}
+
+func TestVerifier(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, _ := newKey("k1", ecKey)
+	ring, _ := New([]*Key{key}, "")
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	h := ring.Verifier()(jwtauth.Authenticator(ok))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+sign(t, ring))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,32 @@
+package mail
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// LogMailer writes messages to W instead of sending them, for local
+// development and tests. W is typically os.Stdout or an open file.
+type LogMailer struct {
+	From string
+	W    io.Writer
+	mu   sync.Mutex
+}
+
+func NewLogMailer(from string, w io.Writer) *LogMailer {
+	return &LogMailer{From: from, W: w}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	b, err := format(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// a blank line keeps consecutive messages apart
+	_, err = m.W.Write(append(b, '\r', '\n'))
+	return err
+}
@@ -0,0 +1,100 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	b, err := format("api@example.com", Message{To: "j@j.com", Subject: "Olá", Body: "line 1\nline 2"}, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "From: api@example.com\r\n"+
+		"To: j@j.com\r\n"+
+		"Subject: =?utf-8?q?Ol=C3=A1?=\r\n"+
+		"Date: Tue, 02 Jan 2024 03:04:05 +0000\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n"+
+		"Content-Transfer-Encoding: 8bit\r\n\r\n"+
+		"line 1\r\nline 2\r\n", string(b))
+
+	_, err = format("api@example.com", Message{To: "j@j.com\r\nBcc: x@j.com", Subject: "Hi"}, now)
+	assert.Equal(t, ErrInvalidHeader, err)
+}
+
+func TestLogMailer(t *testing.T) {
+	var out strings.Builder
+	m := NewLogMailer("api@example.com", &out)
+	assert.Nil(t, m.Send(context.Background(), Message{To: "j@j.com", Subject: "Hi", Body: "token"}))
+	assert.Nil(t, m.Send(context.Background(), Message{To: "k@j.com", Subject: "Hi", Body: "token"}))
+	assert.Contains(t, out.String(), "To: j@j.com\r\n")
+	assert.Contains(t, out.String(), "token\r\n\r\nFrom: api@example.com")
+}
+
+// serveSMTP accepts one SMTP session on l and returns the commands and
+// message data it received.
+func serveSMTP(l net.Listener) <-chan []string {
+	received := make(chan []string, 1)
+	go func() {
+		var lines []string
+		defer func() { received <- lines }()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			lines = append(lines, line)
+			switch verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); verb {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250 localhost")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, _ := tp.ReadDotLines()
+				lines = append(lines, data...)
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+	}()
+	return received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	received := serveSMTP(l)
+	port := l.Addr().(*net.TCPAddr).Port
+
+	m := NewSMTPMailer("127.0.0.1", port, "", "", "api@example.com")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, m.Send(ctx, Message{To: "j@j.com", Subject: "Hi", Body: "token"}))
+
+	lines := <-received
+	assert.Contains(t, lines, "MAIL FROM:<api@example.com>")
+	assert.Contains(t, lines, "RCPT TO:<j@j.com>")
+	assert.Contains(t, lines, "To: j@j.com")
+	assert.Contains(t, lines, "token")
+	assert.Equal(t, "QUIT", lines[len(lines)-1])
+
+	l.Close()
+	assert.NotNil(t, m.Send(ctx, Message{To: "j@j.com", Subject: "Hi", Body: "token"}))
+}
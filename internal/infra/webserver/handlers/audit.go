@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/go-chi/chi/middleware"
+	"golang.org/x/exp/slog"
+)
+
+// Entity types recorded in the audit log.
+const (
+	AuditEntityProduct     = "product"
+	AuditEntityUser        = "user"
+	AuditEntityInvite      = "invite"
+	AuditEntitySession     = "session"
+	AuditEntityReservation = "reservation"
+	AuditEntityCategory    = "category"
+)
+
+// Auditor records writes made through the handlers. A nil Auditor records
+// nothing.
+type Auditor struct {
+	DB database.AuditRepositoryInterface
+}
+
+func NewAuditor(db database.AuditRepositoryInterface) *Auditor {
+	return &Auditor{DB: db}
+}
+
+// With returns an Auditor that writes to db, such as the audit repository
+// of a unit of work, so entries commit or roll back with the writes they
+// describe. A nil Auditor stays nil.
+func (a *Auditor) With(db database.AuditRepositoryInterface) *Auditor {
+	if a == nil {
+		return nil
+	}
+	return &Auditor{DB: db}
+}
+
+// Record logs a write by the verified caller of r.
+func (a *Auditor) Record(r *http.Request, action, entityType, entityID string, before, after any) {
+	a.RecordAs(r, callerSubject(r), action, entityType, entityID, before, after)
+}
+
+// RecordAs logs a write on behalf of actor, for endpoints such as login that
+// identify the user without an access token. The write has already happened
+// when this runs, so failures are logged instead of failing the request.
+func (a *Auditor) RecordAs(r *http.Request, actor, action, entityType, entityID string, before, after any) {
+	if a == nil {
+		return
+	}
+	requestID := middleware.GetReqID(r.Context())
+	entry, err := entity.NewAuditEntry(actor, action, entityType, entityID, before, after, requestID)
+	if err == nil {
+		err = a.DB.Create(context.WithoutCancel(r.Context()), entry)
+	}
+	if err != nil {
+		slog.Error("recording audit entry", "error", err, "action", action, "entity", entityType, "id", entityID, "request_id", requestID)
+	}
+}
+
+// callerSubject returns the sub claim of a verified token, or "".
+func callerSubject(r *http.Request) string {
+	sub, _ := callerClaims(r)["sub"].(string)
+	return sub
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+)
+
+type AuditHandler struct {
+	AuditDB    database.AuditRepositoryInterface
+	Pagination Pagination
+}
+
+func NewAuditHandler(db database.AuditRepositoryInterface, pagination Pagination) *AuditHandler {
+	return &AuditHandler{AuditDB: db, Pagination: pagination}
+}
+
+// @Summary      Audit log
+// @Description  List recorded writes, newest first. X-Total-Count and Link headers are always set; the body is a dto.AuditPage when the server is configured for envelopes or the client accepts application/vnd.page+json.
+// @Tags         audit
+// @Produce      json
+// @Produce      application/vnd.page+json
+// @Param        entity  query     string  false  "Entity type: product, user, invite, session, reservation or category"
+// @Param        id  query     string  false  "Entity ID"
+// @Param        actor  query     string  false  "User ID that made the change"
+// @Param        page  query     int  false  "Page number, starting at 1"
+// @Param        limit  query     int  false  "Number of entries per page, up to the server maximum"
+// @Success      200  {array}   entity.AuditEntry
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /audit [get]
+// @Security     ApiKeyAuth
+func (h *AuditHandler) FindAudit(w http.ResponseWriter, r *http.Request) {
+	query, err := parseAuditQuery(r.URL.Query(), h.Pagination)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	total, err := h.AuditDB.Count(r.Context(), query.Filter)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	entries, err := h.AuditDB.Search(r.Context(), query)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	writePageHeaders(w, r, query.Page, query.Limit, total)
+	if h.Pagination.wantsEnvelope(r) {
+		w.Header().Set("Content-Type", PageMediaType)
+		json.NewEncoder(w).Encode(dto.AuditPage{
+			Items:      entries,
+			Page:       query.Page,
+			Limit:      query.Limit,
+			Total:      total,
+			TotalPages: totalPages(total, query.Limit),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// auditQueryParams lists the query parameters accepted by FindAudit.
+var auditQueryParams = map[string]bool{
+	"entity": true,
+	"id":     true,
+	"actor":  true,
+	"page":   true,
+	"limit":  true,
+}
+
+func parseAuditQuery(values url.Values, pagination Pagination) (database.AuditQuery, error) {
+	var query database.AuditQuery
+	for key := range values {
+		if !auditQueryParams[key] {
+			return query, &InvalidFieldError{Field: key, Err: ErrUnknownParameter}
+		}
+	}
+	var err error
+	if query.Page, query.Limit, err = pagination.parsePage(values); err != nil {
+		return query, err
+	}
+	query.Filter = database.AuditFilter{
+		EntityType: values.Get("entity"),
+		EntityID:   values.Get("id"),
+		Actor:      values.Get("actor"),
+	}
+	return query, nil
+}
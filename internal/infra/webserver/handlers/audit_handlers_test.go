@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/go-chi/chi/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func findAudit(h *AuditHandler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.FindAudit(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestAuditProductWrites(t *testing.T) {
+	h := newProductHandler()
+	audit := NewAuditHandler(h.Audit.DB, DefaultPagination())
+
+	r := asCaller(httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(`{"name":"Product","price":10}`)), entity.RoleAdmin)
+	r = r.WithContext(context.WithValue(r.Context(), middleware.RequestIDKey, "req-1"))
+	w := httptest.NewRecorder()
+	h.CreateProduct(w, r)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	products, err := h.ProductDB.FindAll(context.Background(), 0, 0, "")
+	assert.Nil(t, err)
+	id := products[0].ID.String()
+
+	w = httptest.NewRecorder()
+	h.UpdateProduct(w, asCaller(productRequest(http.MethodPut, id, `{"name":"Renamed","price":12}`, `"1"`), entity.RoleAdmin))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	h.DeleteProduct(w, asCaller(productRequest(http.MethodDelete, id, "", `"2"`), entity.RoleAdmin))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = findAudit(audit, "/audit?entity=product&id="+id)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get("X-Total-Count"))
+	var entries []entity.AuditEntry
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&entries))
+	assert.Len(t, entries, 3)
+	actions := map[string]entity.AuditEntry{}
+	for _, e := range entries {
+		assert.Equal(t, "00000000-0000-0000-0000-000000000001", e.Actor)
+		actions[e.Action] = e
+	}
+	assert.Equal(t, "req-1", actions[entity.AuditCreate].RequestID)
+	assert.Nil(t, actions[entity.AuditCreate].Before)
+	assert.Contains(t, string(actions[entity.AuditUpdate].Before), `"name":"Product"`)
+	assert.Contains(t, string(actions[entity.AuditUpdate].After), `"name":"Renamed"`)
+	assert.Contains(t, string(actions[entity.AuditDelete].Before), `"version":2`)
+	assert.Nil(t, actions[entity.AuditDelete].After)
+
+	w = findAudit(audit, "/audit?entity=product&id="+id+"&limit=1")
+	assert.Contains(t, w.Header().Get("Link"), `rel="next"`)
+}
+
+func TestFindAuditInvalidQuery(t *testing.T) {
+	h := newProductHandler()
+	audit := NewAuditHandler(h.Audit.DB, DefaultPagination())
+	for target, field := range map[string]string{
+		"/audit?entity_type=product": "entity_type",
+		"/audit?page=x":              "page",
+	} {
+		w := findAudit(audit, target)
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+		var p Error
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&p))
+		assert.Equal(t, field, p.Errors[0].Field, target)
+	}
+}
+
+func TestAuditSessionAndUserWrites(t *testing.T) {
+	h := newUserHandler()
+	tokens := login(t, h)
+	w := httptest.NewRecorder()
+	h.Logout(w, newTokenRequest("/users/logout", map[string]string{"refresh_token": tokens.RefreshToken}))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	body := `{"name":"Jane","email":"jane@j.com","password":"123456","roles":["viewer"]}`
+	assert.Equal(t, http.StatusCreated, createUser(h, asCaller(httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body)), entity.RoleAdmin)))
+
+	audit := NewAuditHandler(h.Audit.DB, DefaultPagination())
+	var entries []entity.AuditEntry
+	assert.Nil(t, json.NewDecoder(findAudit(audit, "/audit?entity=session").Body).Decode(&entries))
+	assert.Len(t, entries, 2)
+
+	entries = nil
+	assert.Nil(t, json.NewDecoder(findAudit(audit, "/audit?entity=user").Body).Decode(&entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000001", entries[0].Actor)
+	assert.NotContains(t, string(entries[0].After), "password")
+}
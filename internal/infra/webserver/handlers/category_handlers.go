@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+)
+
+type CategoryHandler struct {
+	CategoryDB database.CategoryRepositoryInterface
+	TagDB      database.TagRepositoryInterface
+	ProductDB  database.ProductRepositoryInterface
+	Audit      *Auditor
+}
+
+func NewCategoryHandler(categories database.CategoryRepositoryInterface, tags database.TagRepositoryInterface, products database.ProductRepositoryInterface, audit *Auditor) *CategoryHandler {
+	return &CategoryHandler{CategoryDB: categories, TagDB: tags, ProductDB: products, Audit: audit}
+}
+
+// @Summary      List categories
+// @Description  List categories by name. Without parent every category is returned and clients build the tree from parent_id; with parent only its direct subcategories are, and an empty parent lists the roots.
+// @Tags         categories
+// @Produce      json
+// @Param        parent  query     string  false  "Parent category ID, empty for root categories"
+// @Success      200  {array}   entity.Category
+// @Failure      400  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /categories [get]
+// @Security     ApiKeyAuth
+func (h *CategoryHandler) FindCategories(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	for key := range values {
+		if key != "parent" {
+			WriteError(w, r, &InvalidFieldError{Field: key, Err: ErrUnknownParameter})
+			return
+		}
+	}
+	var categories []entity.Category
+	var err error
+	if values.Has("parent") {
+		categories, err = h.CategoryDB.FindChildren(r.Context(), values.Get("parent"))
+	} else {
+		categories, err = h.CategoryDB.FindAll(r.Context())
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if categories == nil {
+		categories = []entity.Category{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+// @Summary      Get category by ID
+// @Description  Get category by ID
+// @Tags         categories
+// @Produce      json
+// @Param        id  path      string  true  "Category ID"
+// @Success      200  {object}  entity.Category
+// @Failure      404  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /categories/{id} [get]
+// @Security     ApiKeyAuth
+func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
+	category, err := h.CategoryDB.FindByID(r.Context(), r.PathValue("id"))
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Category not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
+// @Summary      Create a category
+// @Description  Create a root category, or a subcategory when parent_id is set.
+// @Tags         categories
+// @Accept       json
+// @Produce      json
+// @Param        input  body      dto.CategoryInput  true  "category"
+// @Param        Idempotency-Key  header    string  false  "Unique key; retries with it replay the first response"
+// @Success      201  {object}  entity.Category
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      422  {object}  Error  "Idempotency-Key reused with a different request"
+// @Failure      500  {object}  Error
+// @Router       /categories [post]
+// @Security     ApiKeyAuth
+func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var input dto.CategoryInput
+	if err := decodeJSON(r, &input); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	parentID, err := parseParentID(input.ParentID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	category, err := entity.NewCategory(input.Name, parentID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	err = h.CategoryDB.Create(r.Context(), category)
+	if errors.Is(err, database.ErrInvalidInput) {
+		WriteError(w, r, &InvalidFieldError{Field: "parent_id", Err: err})
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.Audit.Record(r, entity.AuditCreate, AuditEntityCategory, category.ID.String(), nil, category)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// @Summary      Replace category by ID
+// @Description  Rename a category or move it to another parent. A category cannot move below itself.
+// @Tags         categories
+// @Accept       json
+// @Produce      json
+// @Param        id  path      string  true  "Category ID"
+// @Param        input  body      dto.CategoryInput  true  "category"
+// @Success      200  {object}  entity.Category
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /categories/{id} [put]
+// @Security     ApiKeyAuth
+func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	var input dto.CategoryInput
+	if err := decodeJSON(r, &input); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	parentID, err := parseParentID(input.ParentID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	before, err := h.CategoryDB.FindByID(r.Context(), r.PathValue("id"))
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Category not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	category := *before
+	category.Name, category.ParentID = input.Name, parentID
+	if err := category.Validate(); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	rows, err := h.CategoryDB.Update(r.Context(), &category)
+	if errors.Is(err, database.ErrInvalidInput) {
+		WriteError(w, r, &InvalidFieldError{Field: "parent_id", Err: err})
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if rows == 0 {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Category not found"))
+		return
+	}
+	h.Audit.Record(r, entity.AuditUpdate, AuditEntityCategory, category.ID.String(), before, &category)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
+// @Summary      Delete category by ID
+// @Description  Delete a category that has no subcategories. Its products lose the assignment but are kept.
+// @Tags         categories
+// @Param        id  path      string  true  "Category ID"
+// @Success      204
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      409  {object}  Error  "Category has subcategories"
+// @Failure      500  {object}  Error
+// @Router       /categories/{id} [delete]
+// @Security     ApiKeyAuth
+func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	before, err := h.CategoryDB.FindByID(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Category not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	rows, err := h.CategoryDB.Delete(r.Context(), id)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if rows == 0 {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Category not found"))
+		return
+	}
+	h.Audit.Record(r, entity.AuditDelete, AuditEntityCategory, id, before, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      List product categories
+// @Description  List the categories a product is assigned to.
+// @Tags         categories
+// @Produce      json
+// @Param        id  path      string  true  "Product ID"
+// @Success      200  {array}   entity.Category
+// @Failure      404  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /products/{id}/categories [get]
+// @Security     ApiKeyAuth
+func (h *CategoryHandler) FindProductCategories(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.findProduct(w, r)
+	if !ok {
+		return
+	}
+	categories, err := h.CategoryDB.FindProductCategories(r.Context(), id)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if categories == nil {
+		categories = []entity.Category{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+// @Summary      Assign product categories
+// @Description  Replace the categories a product is assigned to. An empty list removes them all.
+// @Tags         categories
+// @Accept       json
+// @Produce      json
+// @Param        id  path      string  true  "Product ID"
+// @Param        input  body      dto.ProductCategoriesInput  true  "category ids"
+// @Success      200  {array}   entity.Category
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /products/{id}/categories [put]
+// @Security     ApiKeyAuth
+func (h *CategoryHandler) SetProductCategories(w http.ResponseWriter, r *http.Request) {
+	var input dto.ProductCategoriesInput
+	if err := decodeJSON(r, &input); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	id, ok := h.findProduct(w, r)
+	if !ok {
+		return
+	}
+	before, err := h.CategoryDB.FindProductCategories(r.Context(), id)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	err = h.CategoryDB.SetProductCategories(r.Context(), id, input.CategoryIDs)
+	if errors.Is(err, database.ErrInvalidInput) {
+		WriteError(w, r, &InvalidFieldError{Field: "category_ids", Err: err})
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	after, err := h.CategoryDB.FindProductCategories(r.Context(), id)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if after == nil {
+		after = []entity.Category{}
+	}
+	h.Audit.Record(r, entity.AuditUpdate, AuditEntityProduct, id,
+		dto.ProductCategoriesInput{CategoryIDs: categoryIDs(before)},
+		dto.ProductCategoriesInput{CategoryIDs: categoryIDs(after)})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(after)
+}
+
+// @Summary      List product tags
+// @Description  List the tags of a product alphabetically.
+// @Tags         categories
+// @Produce      json
+// @Param        id  path      string  true  "Product ID"
+// @Success      200  {object}  dto.ProductTagsInput
+// @Failure      404  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /products/{id}/tags [get]
+// @Security     ApiKeyAuth
+func (h *CategoryHandler) FindProductTags(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.findProduct(w, r)
+	if !ok {
+		return
+	}
+	tags, err := h.TagDB.FindProductTags(r.Context(), id)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dto.ProductTagsInput{Tags: tags})
+}
+
+// @Summary      Tag a product
+// @Description  Replace the tags of a product. Tags are trimmed, lowercased and deduplicated; each may be up to 50 characters.
+// @Tags         categories
+// @Accept       json
+// @Produce      json
+// @Param        id  path      string  true  "Product ID"
+// @Param        input  body      dto.ProductTagsInput  true  "tags"
+// @Success      200  {object}  dto.ProductTagsInput
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /products/{id}/tags [put]
+// @Security     ApiKeyAuth
+func (h *CategoryHandler) SetProductTags(w http.ResponseWriter, r *http.Request) {
+	var input dto.ProductTagsInput
+	if err := decodeJSON(r, &input); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	tags, err := entity.NormalizeTags(input.Tags)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	id, ok := h.findProduct(w, r)
+	if !ok {
+		return
+	}
+	before, err := h.TagDB.FindProductTags(r.Context(), id)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if err := h.TagDB.SetProductTags(r.Context(), id, tags); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.Audit.Record(r, entity.AuditUpdate, AuditEntityProduct, id, dto.ProductTagsInput{Tags: before}, dto.ProductTagsInput{Tags: tags})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dto.ProductTagsInput{Tags: tags})
+}
+
+// findProduct checks that the product in the path exists, writing the
+// error response when it does not.
+func (h *CategoryHandler) findProduct(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if id == "" {
+		WriteError(w, r, entity.ErrIDIsRequired)
+		return "", false
+	}
+	_, err := h.ProductDB.FindByID(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found"))
+		return "", false
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return "", false
+	}
+	return id, true
+}
+
+func parseParentID(s *string) (*pkgentity.ID, error) {
+	if s == nil {
+		return nil, nil
+	}
+	id, err := pkgentity.ParseId(*s)
+	if err != nil {
+		return nil, &InvalidFieldError{Field: "parent_id", Err: entity.ErrInvalidParent}
+	}
+	return &id, nil
+}
+
+func categoryIDs(categories []entity.Category) []string {
+	ids := make([]string, 0, len(categories))
+	for _, c := range categories {
+		ids = append(ids, c.ID.String())
+	}
+	return ids
+}
+
+// parseCategoryFilter reads the category, include_subcategories and tag
+// parameters of a product search.
+func parseCategoryFilter(values url.Values, filter *database.ProductFilter) error {
+	if s := values.Get("category"); s != "" {
+		if _, err := pkgentity.ParseId(s); err != nil {
+			return &InvalidFieldError{Field: "category", Err: entity.ErrInvalidID}
+		}
+		filter.CategoryID = s
+	}
+	if s := values.Get("include_subcategories"); s != "" {
+		include, err := strconv.ParseBool(s)
+		if err != nil {
+			return &InvalidFieldError{Field: "include_subcategories", Err: errors.New("must be true or false")}
+		}
+		filter.IncludeSubcategories = include
+	}
+	if tags := values["tag"]; len(tags) > 0 {
+		normalized, err := entity.NormalizeTags(tags)
+		if err != nil {
+			return &InvalidFieldError{Field: "tag", Err: err}
+		}
+		filter.Tags = normalized
+	}
+	return nil
+}
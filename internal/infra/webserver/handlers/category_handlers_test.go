@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newCategoryHandler() (*CategoryHandler, *entity.Product) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	db.AutoMigrate(&entity.Product{}, &entity.Category{}, &entity.ProductCategory{}, &entity.ProductTag{}, &entity.AuditEntry{})
+	products := database.NewProductRepository(db)
+	p, _ := entity.NewProduct("Product", 1000, "USD")
+	products.Create(context.Background(), p)
+	return NewCategoryHandler(database.NewCategoryRepository(db), database.NewTagRepository(db), products, NewAuditor(database.NewAuditRepository(db))), p
+}
+
+func createCategory(t *testing.T, h *CategoryHandler, body string) entity.Category {
+	w := httptest.NewRecorder()
+	h.CreateCategory(w, stockRequest(http.MethodPost, "", body))
+	assert.Equal(t, http.StatusCreated, w.Code, body)
+	var category entity.Category
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&category))
+	return category
+}
+
+func TestCategoryHandlers(t *testing.T) {
+	h, _ := newCategoryHandler()
+	root := createCategory(t, h, `{"name":"Electronics"}`)
+	child := createCategory(t, h, `{"name":"Phones","parent_id":"`+root.ID.String()+`"}`)
+	assert.Equal(t, root.ID, *child.ParentID)
+
+	for body, field := range map[string]string{
+		`{"name":" "}`:                 "name",
+		`{"name":"A","parent_id":"x"}`: "parent_id",
+		`{"name":"A","parent_id":"00000000-0000-0000-0000-000000000009"}`: "parent_id",
+	} {
+		w := httptest.NewRecorder()
+		h.CreateCategory(w, stockRequest(http.MethodPost, "", body))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		var problem Error
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, field, problem.Errors[0].Field, body)
+	}
+
+	w := httptest.NewRecorder()
+	h.FindCategories(w, httptest.NewRequest(http.MethodGet, "/categories?parent=", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var categories []entity.Category
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&categories))
+	assert.Len(t, categories, 1)
+	assert.Equal(t, root.ID, categories[0].ID)
+
+	w = httptest.NewRecorder()
+	h.FindCategories(w, httptest.NewRequest(http.MethodGet, "/categories?parent_id=", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Moving a category below its own child would create a cycle.
+	w = httptest.NewRecorder()
+	h.UpdateCategory(w, stockRequest(http.MethodPut, root.ID.String(), `{"name":"Electronics","parent_id":"`+child.ID.String()+`"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.UpdateCategory(w, stockRequest(http.MethodPut, child.ID.String(), `{"name":"Mobile phones"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var updated entity.Category
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&updated))
+	assert.Equal(t, "Mobile phones", updated.Name)
+	assert.Nil(t, updated.ParentID)
+
+	w = httptest.NewRecorder()
+	h.UpdateCategory(w, stockRequest(http.MethodPut, child.ID.String(), `{"name":"Phones","parent_id":"`+root.ID.String()+`"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	h.DeleteCategory(w, stockRequest(http.MethodDelete, root.ID.String(), ""))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	h.DeleteCategory(w, stockRequest(http.MethodDelete, child.ID.String(), ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	h.GetCategory(w, stockRequest(http.MethodGet, child.ID.String(), ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestProductCategoriesAndTags(t *testing.T) {
+	h, p := newCategoryHandler()
+	id := p.ID.String()
+	category := createCategory(t, h, `{"name":"Books"}`)
+
+	w := httptest.NewRecorder()
+	h.SetProductCategories(w, stockRequest(http.MethodPut, id, `{"category_ids":["`+category.ID.String()+`"]}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var categories []entity.Category
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&categories))
+	assert.Len(t, categories, 1)
+
+	w = httptest.NewRecorder()
+	h.SetProductCategories(w, stockRequest(http.MethodPut, id, `{"category_ids":["00000000-0000-0000-0000-000000000009"]}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.SetProductTags(w, stockRequest(http.MethodPut, id, `{"tags":[" Sale","sale","new"]}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tags dto.ProductTagsInput
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&tags))
+	assert.Equal(t, []string{"new", "sale"}, tags.Tags)
+
+	w = httptest.NewRecorder()
+	h.SetProductTags(w, stockRequest(http.MethodPut, id, `{"tags":[""]}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.FindProductTags(w, stockRequest(http.MethodGet, "00000000-0000-0000-0000-000000000009", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestParseCategoryFilter(t *testing.T) {
+	values := url.Values{
+		"category":              {"00000000-0000-0000-0000-000000000001"},
+		"include_subcategories": {"true"},
+		"tag":                   {"Sale", "new"},
+	}
+	query, err := parseProductQuery(values, DefaultPagination(), "USD")
+	assert.Nil(t, err)
+	assert.True(t, query.Filter.IncludeSubcategories)
+	assert.Equal(t, []string{"new", "sale"}, query.Filter.Tags)
+
+	for _, raw := range []string{"category=x", "include_subcategories=true", "include_subcategories=maybe", "tag="} {
+		values, _ := url.ParseQuery(raw)
+		_, err := parseProductQuery(values, DefaultPagination(), "USD")
+		assert.NotNil(t, err, raw)
+	}
+}
@@ -1,5 +1,260 @@
 package handlers
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/antoniofmoliveira/apis/pkg/patch"
+	"github.com/go-chi/chi/middleware"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	ProblemContentType    = "application/problem+json"
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+	CSVContentType        = "text/csv"
+	NDJSONContentType     = "application/x-ndjson"
+
+	ProblemTypeDefault    = "about:blank"
+	ProblemTypeValidation = "/problems/validation-error"
+
+	// serverErrorDetail replaces the detail of 5xx problems, whose errors
+	// may carry SQL, table or constraint names.
+	serverErrorDetail = "the server could not complete the request"
+
+	// MaxBodyBytes caps the JSON bodies handlers read into memory. Imports
+	// stream their bodies and are not limited.
+	MaxBodyBytes = 1 << 20
+)
+
+var (
+	ErrInvalidBody         = errors.New("invalid request body")
+	ErrBodyTooLarge        = errors.New("request body is too large")
+	ErrUnknownParameter    = errors.New("unknown query parameter")
+	ErrEmailIsRequired     = errors.New("email is required")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrTooManyRequests     = errors.New("too many requests")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrInvalidInvite       = errors.New("invalid or expired invite code")
+	ErrInvalidResetToken   = errors.New("invalid or expired password reset token")
+	ErrIDMismatch          = errors.New("id does not match the URL")
+	ErrReadOnlyField       = errors.New("field is read-only")
+
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+	ErrRegistrationClosed      = errors.New("registration is closed")
+	ErrRoleAssignmentForbidden = errors.New("only admins can assign roles")
+	ErrLastAdmin               = errors.New("the last admin cannot be demoted or deleted")
+	ErrIncorrectPassword       = errors.New("current password is incorrect")
+)
+
+// Error is an RFC 7807 problem details object. Message is kept as an
+// extension member for clients written against the previous error body.
 type Error struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Message  string       `json:"message,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes a validation failure on a single input field.
+type FieldError struct {
+	Field   string `json:"field"`
 	Message string `json:"message"`
-}
\ No newline at end of file
+}
+
+// InvalidFieldError reports a bad value in a named request field, such as
+// a query parameter.
+type InvalidFieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *InvalidFieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *InvalidFieldError) Unwrap() error {
+	return e.Err
+}
+
+// fieldErrors maps entity validation errors to the input field they concern.
+var fieldErrors = map[error]string{
+	entity.ErrIDIsRequired:       "id",
+	entity.ErrInvalidID:          "id",
+	entity.ErrNameIsRequired:     "name",
+	entity.ErrPriceIsRequired:    "price",
+	entity.ErrInvalidPrice:       "price",
+	entity.ErrInvalidCurrency:    "currency",
+	entity.ErrInvalidDelta:       "delta",
+	entity.ErrInvalidStockReason: "reason",
+	entity.ErrInvalidQuantity:    "quantity",
+	entity.ErrInvalidParent:      "parent_id",
+	database.ErrCategoryCycle:    "parent_id",
+	entity.ErrInvalidTag:         "tags",
+	entity.ErrInvalidName:        "name",
+	entity.ErrInvalidEmail:       "email",
+	entity.ErrInvalidPassword:    "password",
+	entity.ErrInvalidRole:        "roles",
+	ErrEmailIsRequired:           "email",
+	bcrypt.ErrPasswordTooLong:    "password",
+	ErrInvalidInvite:             "invite_code",
+	ErrIncorrectPassword:         "current_password",
+	ErrInvalidResetToken:         "token",
+}
+
+// errorStatus maps domain and repository errors to HTTP status codes.
+func errorStatus(err error) int {
+	var fieldErr *InvalidFieldError
+	if errors.As(err, &fieldErr) {
+		return http.StatusBadRequest
+	}
+	for target := range fieldErrors {
+		if errors.Is(err, target) {
+			return http.StatusBadRequest
+		}
+	}
+	switch {
+	case errors.Is(err, ErrInvalidBody), errors.Is(err, database.ErrInvalidInput), errors.Is(err, patch.ErrInvalidPatch):
+		return http.StatusBadRequest
+	case errors.Is(err, patch.ErrTestFailed):
+		return http.StatusConflict
+	case errors.Is(err, patch.ErrPathNotFound):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrInvalidCredentials), errors.Is(err, ErrInvalidRefreshToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrRegistrationClosed), errors.Is(err, ErrRoleAssignmentForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, database.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrConflict), errors.Is(err, database.ErrInsufficientStock),
+		errors.Is(err, database.ErrReservationClosed), errors.Is(err, database.ErrReservationExpired),
+		errors.Is(err, database.ErrCategoryHasChildren), errors.Is(err, ErrLastAdmin):
+		return http.StatusConflict
+	case errors.Is(err, ErrPreconditionFailed), errors.Is(err, database.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrPreconditionRequired):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// NewProblem builds a problem with the standard title for status.
+func NewProblem(status int, detail string) Error {
+	return Error{
+		Type:    ProblemTypeDefault,
+		Title:   http.StatusText(status),
+		Status:  status,
+		Detail:  detail,
+		Message: detail,
+	}
+}
+
+// problemFor converts err into a problem, attaching field errors for
+// validation failures. Server errors get a generic detail; log them with
+// logServerError.
+func problemFor(err error) Error {
+	status := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		return NewProblem(status, serverErrorDetail)
+	}
+	p := NewProblem(status, err.Error())
+	var fieldErr *InvalidFieldError
+	if errors.As(err, &fieldErr) {
+		p.Type = ProblemTypeValidation
+		p.Title = "Validation failed"
+		p.Errors = []FieldError{{Field: fieldErr.Field, Message: fieldErr.Err.Error()}}
+		return p
+	}
+	for target, field := range fieldErrors {
+		if errors.Is(err, target) {
+			p.Type = ProblemTypeValidation
+			p.Title = "Validation failed"
+			p.Errors = append(p.Errors, FieldError{Field: field, Message: target.Error()})
+			break
+		}
+	}
+	return p
+}
+
+// WriteProblem renders p as application/problem+json.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p Error) {
+	if p.Instance == "" && r != nil {
+		p.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// WriteError renders err as a problem using the status from errorStatus.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	p := problemFor(err)
+	if p.Status >= http.StatusInternalServerError {
+		logServerError(r, err)
+	}
+	WriteProblem(w, r, p)
+}
+
+// logServerError logs the error behind a 5xx answer, which the client only
+// sees as serverErrorDetail, under the request id.
+func logServerError(r *http.Request, err error) {
+	slog.Error("request failed", "error", err, "method", r.Method, "path", r.URL.Path, "request_id", middleware.GetReqID(r.Context()))
+}
+
+// WriteTooManyRequests answers 429 with err as detail, telling the client in
+// Retry-After how many seconds to wait, rounded up.
+func WriteTooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, err error) {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	WriteProblem(w, r, NewProblem(http.StatusTooManyRequests, err.Error()))
+}
+
+// decodeJSON decodes the request body into v, wrapping failures in ErrInvalidBody.
+func decodeJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, MaxBodyBytes)).Decode(v); err != nil {
+		return bodyError(err)
+	}
+	return nil
+}
+
+// ReadBody reads the whole request body, failing with ErrBodyTooLarge past
+// MaxBodyBytes.
+func ReadBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	if err != nil {
+		return nil, bodyError(err)
+	}
+	return body, nil
+}
+
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return fmt.Errorf("%w: the limit is %d bytes", ErrBodyTooLarge, tooLarge.Limit)
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidBody, err)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusBadRequest, errorStatus(entity.ErrInvalidPrice))
+	assert.Equal(t, http.StatusBadRequest, errorStatus(fmt.Errorf("%w: eof", ErrInvalidBody)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, errorStatus(fmt.Errorf("%w: the limit is 1 bytes", ErrBodyTooLarge)))
+	assert.Equal(t, http.StatusUnauthorized, errorStatus(ErrInvalidCredentials))
+	assert.Equal(t, http.StatusBadRequest, errorStatus(database.ErrInvalidInput))
+	assert.Equal(t, http.StatusNotFound, errorStatus(database.ErrNotFound))
+	assert.Equal(t, http.StatusConflict, errorStatus(database.ErrConflict))
+	assert.Equal(t, http.StatusInternalServerError, errorStatus(errors.New("database down")))
+}
+
+func TestWriteErrorValidation(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/products", nil)
+	WriteError(w, r, entity.ErrInvalidPrice)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	var p Error
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&p))
+	assert.Equal(t, ProblemTypeValidation, p.Type)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, "/products", p.Instance)
+	assert.Equal(t, []FieldError{{Field: "price", Message: entity.ErrInvalidPrice.Error()}}, p.Errors)
+}
+
+func TestWriteProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/products/1", nil)
+	WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found"))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	var p Error
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&p))
+	assert.Equal(t, ProblemTypeDefault, p.Type)
+	assert.Equal(t, "Not Found", p.Title)
+	assert.Equal(t, "Product not found", p.Detail)
+	assert.Empty(t, p.Errors)
+}
+
+func TestWriteErrorHidesServerErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/products", nil)
+	WriteError(w, r, errors.New(`no such table: products`))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "no such table")
+	var p Error
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&p))
+	assert.Equal(t, serverErrorDetail, p.Detail)
+	assert.Equal(t, serverErrorDetail, p.Message)
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrPreconditionRequired = errors.New("If-Match header is required")
+	ErrPreconditionFailed   = errors.New("If-Match does not match the current version")
+)
+
+// versionETag formats a resource version as a strong entity tag.
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion reads the If-Match header for a conditional write. It
+// returns zero for "*", which matches any existing version. Lists and weak
+// tags are not supported and never match.
+func ifMatchVersion(r *http.Request) (int64, error) {
+	return parseIfMatch(r.Header.Get("If-Match"))
+}
+
+// parseIfMatch parses an If-Match value as ifMatchVersion does.
+func parseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, ErrPreconditionRequired
+	}
+	if header == "*" {
+		return 0, nil
+	}
+	tag, ok := strings.CutPrefix(header, `"`)
+	if tag, ok = strings.CutSuffix(tag, `"`); !ok {
+		return 0, ErrPreconditionFailed
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version < 1 {
+		return 0, ErrPreconditionFailed
+	}
+	return version, nil
+}
+
+// noneMatch reports whether an If-None-Match header matches etag using the
+// weak comparison RFC 9110 prescribes for GET.
+func noneMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
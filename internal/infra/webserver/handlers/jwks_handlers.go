@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+type PublicKeySet interface {
+	PublicSet() (jwk.Set, error)
+}
+
+type JWKSHandler struct {
+	Keys PublicKeySet
+}
+
+func NewJWKSHandler(keys PublicKeySet) *JWKSHandler {
+	return &JWKSHandler{Keys: keys}
+}
+
+// @Summary      JSON Web Key Set
+// @Description  Public keys that verify access tokens, selected by the token's kid header. Empty when tokens are signed with a shared HS256 secret.
+// @Tags         users
+// @Produce      json
+// @Success      200
+// @Failure      500  {object}  Error
+// @Router       /.well-known/jwks.json [get]
+func (h *JWKSHandler) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	set, err := h.Keys.PublicSet()
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(set)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/antoniofmoliveira/apis/internal/infra/jwtkeys"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetJWKS(t *testing.T) {
+	private, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ring, err := jwtkeys.New([]*jwtkeys.Key{{ID: "k1", Algorithm: jwa.ES256, Private: private, Public: &private.PublicKey}}, "")
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	NewJWKSHandler(ring).GetJWKS(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&body))
+	assert.Len(t, body.Keys, 1)
+	assert.Equal(t, "k1", body.Keys[0]["kid"])
+	assert.Equal(t, "ES256", body.Keys[0]["alg"])
+	assert.Nil(t, body.Keys[0]["d"])
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var ErrCursorConflict = errors.New("cannot be combined with cursor")
+
+// PageMediaType asks list endpoints for the paginated envelope instead of a
+// bare array.
+const PageMediaType = "application/vnd.page+json"
+
+// Pagination configures list endpoints. MaxLimit is enforced on every
+// request so a single call cannot dump a whole table.
+type Pagination struct {
+	DefaultLimit int
+	MaxLimit     int
+	Envelope     bool
+}
+
+func DefaultPagination() Pagination {
+	return Pagination{DefaultLimit: 20, MaxLimit: 100}
+}
+
+// parsePage reads page and limit, applying defaults and rejecting values
+// outside 1..MaxLimit.
+func (p Pagination) parsePage(values url.Values) (page, limit int, err error) {
+	page, limit = 1, min(p.DefaultLimit, p.MaxLimit)
+	if s := values.Get("page"); s != "" {
+		if page, err = strconv.Atoi(s); err != nil || page < 1 {
+			return 0, 0, &InvalidFieldError{Field: "page", Err: errors.New("must be a positive integer")}
+		}
+	}
+	if s := values.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > p.MaxLimit {
+			return 0, 0, &InvalidFieldError{Field: "limit", Err: fmt.Errorf("must be an integer between 1 and %d", p.MaxLimit)}
+		}
+	}
+	return page, limit, nil
+}
+
+// wantsEnvelope reports whether the response body should be the envelope,
+// either by configuration or because the client asked for PageMediaType.
+func (p Pagination) wantsEnvelope(r *http.Request) bool {
+	return p.Envelope || strings.Contains(r.Header.Get("Accept"), PageMediaType)
+}
+
+func totalPages(total int64, limit int) int {
+	return int((total + int64(limit) - 1) / int64(limit))
+}
+
+// writePageHeaders sets X-Total-Count and an RFC 8288 Link header with
+// first, prev, next and last relations.
+func writePageHeaders(w http.ResponseWriter, r *http.Request, page, limit int, total int64) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	last := totalPages(total, limit)
+	if last < 1 {
+		last = 1
+	}
+	link := func(rel string, n int) string {
+		q := r.URL.Query()
+		q.Set("page", strconv.Itoa(n))
+		q.Set("limit", strconv.Itoa(limit))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, q.Encode(), rel)
+	}
+	links := []string{link("first", 1)}
+	if page > 1 {
+		links = append(links, link("prev", min(page-1, last)))
+	}
+	if page < last {
+		links = append(links, link("next", page+1))
+	}
+	links = append(links, link("last", last))
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
+
+// writeCursorLink sets an RFC 8288 Link header pointing at the next cursor
+// page.
+func writeCursorLink(w http.ResponseWriter, r *http.Request, next string) {
+	q := r.URL.Query()
+	q.Set("cursor", next)
+	w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, q.Encode()))
+}
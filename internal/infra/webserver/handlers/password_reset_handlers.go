@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/antoniofmoliveira/apis/internal/infra/mail"
+	"golang.org/x/exp/slog"
+)
+
+// resetMailTimeout bounds the work ForgotPassword does after responding.
+const resetMailTimeout = time.Minute
+
+type PasswordResetHandler struct {
+	UserDB  database.UserRepositoryInterface
+	ResetDB database.PasswordResetRepositoryInterface
+	// UnitOfWork applies a reset, so the token is only spent if the new
+	// password and the sign-out are saved with it.
+	UnitOfWork database.UnitOfWorkInterface
+	Mailer     mail.Mailer
+	// ExpiresIn is how long a mailed token works. ResetURL, when set, is
+	// followed by the token to form the link in the email.
+	ExpiresIn time.Duration
+	ResetURL  string
+	Audit     *Auditor
+
+	pending sync.WaitGroup
+}
+
+func NewPasswordResetHandler(userDB database.UserRepositoryInterface, resetDB database.PasswordResetRepositoryInterface, uow database.UnitOfWorkInterface, mailer mail.Mailer, expiresIn time.Duration, resetURL string, audit *Auditor) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		UserDB:     userDB,
+		ResetDB:    resetDB,
+		UnitOfWork: uow,
+		Mailer:     mailer,
+		ExpiresIn:  expiresIn,
+		ResetURL:   resetURL,
+		Audit:      audit,
+	}
+}
+
+// @Summary      Request a password reset
+// @Description  Email a single-use password reset token to the address if it belongs to a user. The response is 202 whether or not it does, and is sent before any lookup, so it reveals nothing about which emails are registered.
+// @Tags         users
+// @Accept       json
+// @Param        input  body      dto.ForgotPasswordInput  true  "email"
+// @Success      202
+// @Failure      400  {object}  Error
+// @Failure      429  {object}  Error
+// @Router       /users/password/forgot [post]
+func (h *PasswordResetHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input dto.ForgotPasswordInput
+	if err := decodeJSON(r, &input); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if input.Email == "" {
+		WriteError(w, r, ErrEmailIsRequired)
+		return
+	}
+	h.pending.Add(1)
+	go func() {
+		defer h.pending.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), resetMailTimeout)
+		defer cancel()
+		h.mailReset(ctx, input.Email)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Wait blocks until the reset emails requested so far have been handled.
+func (h *PasswordResetHandler) Wait() {
+	h.pending.Wait()
+}
+
+// mailReset stores a reset for the user with email and mails them its
+// token. Unknown emails are ignored and failures only logged, since the
+// client has already been answered.
+func (h *PasswordResetHandler) mailReset(ctx context.Context, email string) {
+	user, err := h.UserDB.FindByEmail(ctx, email)
+	if errors.Is(err, database.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		slog.Error("finding user for password reset", "error", err)
+		return
+	}
+	reset, token, err := entity.NewPasswordReset(user.ID, h.ExpiresIn)
+	if err == nil {
+		err = h.ResetDB.Create(ctx, reset)
+	}
+	if err != nil {
+		slog.Error("creating password reset", "error", err, "user", user.ID.String())
+		return
+	}
+	msg := mail.Message{To: user.Email, Subject: "Reset your password", Body: h.resetMailBody(token)}
+	if err := h.Mailer.Send(ctx, msg); err != nil {
+		slog.Error("mailing password reset", "error", err, "user", user.ID.String())
+	}
+}
+
+func (h *PasswordResetHandler) resetMailBody(token string) string {
+	instructions := "use this token to choose a new one"
+	secret := token
+	if h.ResetURL != "" {
+		instructions = "open this link to choose a new one"
+		secret = h.ResetURL + token
+	}
+	n, unit := int(h.ExpiresIn.Minutes()), "minute"
+	if h.ExpiresIn >= time.Hour && h.ExpiresIn%time.Hour == 0 {
+		n, unit = int(h.ExpiresIn.Hours()), "hour"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("We received a request to reset your password. Within %d %s, %s:\n\n%s\n\n"+
+		"If you did not ask for this, ignore this email and your password will stay the same.\n",
+		n, unit, instructions, secret)
+}
+
+// @Summary      Reset a password
+// @Description  Set a new password with the token from a reset email. The token works once; using it also unlocks the account and signs out every session of the user.
+// @Tags         users
+// @Accept       json
+// @Param        input  body      dto.ResetPasswordInput  true  "token and new password"
+// @Success      204
+// @Failure      400  {object}  Error
+// @Failure      429  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /users/password/reset [post]
+func (h *PasswordResetHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input dto.ResetPasswordInput
+	if err := decodeJSON(r, &input); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	now := time.Now()
+	reset, err := h.ResetDB.FindByHash(r.Context(), entity.HashPasswordResetToken(input.Token))
+	if errors.Is(err, database.ErrNotFound) || errors.Is(err, database.ErrInvalidInput) {
+		WriteError(w, r, ErrInvalidResetToken)
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if !reset.IsUsable(now) {
+		WriteError(w, r, ErrInvalidResetToken)
+		return
+	}
+	user, err := h.UserDB.FindByID(r.Context(), reset.UserID.String())
+	if errors.Is(err, database.ErrNotFound) {
+		WriteError(w, r, ErrInvalidResetToken)
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if err := user.SetPassword(input.Password); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	id := user.ID.String()
+	err = h.UnitOfWork.Do(r.Context(), func(repos database.Repositories) error {
+		rows, err := repos.PasswordResets.MarkUsed(r.Context(), reset.ID.String(), now)
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			// spent concurrently by another request
+			return ErrInvalidResetToken
+		}
+		if _, err := repos.Users.UpdatePassword(r.Context(), id, user.Password); err != nil {
+			return err
+		}
+		if err := repos.Users.ResetFailedLogins(r.Context(), id); err != nil {
+			return err
+		}
+		if _, err := repos.PasswordResets.InvalidateUser(r.Context(), id); err != nil {
+			return err
+		}
+		if _, err := repos.RefreshTokens.RevokeUser(r.Context(), id); err != nil {
+			return err
+		}
+		h.Audit.With(repos.Audit).RecordAs(r, id, entity.AuditResetPassword, AuditEntityUser, id, nil, nil)
+		return nil
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/antoniofmoliveira/apis/internal/infra/mail"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var resetLink = regexp.MustCompile(`https://app\.example\.com/reset\?token=([A-Za-z0-9_-]+)`)
+
+// revokeFails is a unit of work whose refresh tokens cannot be revoked.
+type revokeFails struct {
+	database.UnitOfWorkInterface
+}
+
+type failingRevoke struct {
+	database.RefreshTokenRepositoryInterface
+}
+
+func (failingRevoke) RevokeUser(context.Context, string) (int64, error) {
+	return 0, errors.New("revoke failed")
+}
+
+func (u revokeFails) Do(ctx context.Context, fn func(repos database.Repositories) error) error {
+	return u.UnitOfWorkInterface.Do(ctx, func(repos database.Repositories) error {
+		repos.RefreshTokens = failingRevoke{repos.RefreshTokens}
+		return fn(repos)
+	})
+}
+
+func newPasswordResetHandler() (*PasswordResetHandler, *bytes.Buffer) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&entity.User{}, &entity.PasswordReset{}, &entity.RefreshToken{}, &entity.AuditEntry{})
+	user, _ := entity.NewUser("John Doe", "j@j.com", "123456")
+	db.Create(user)
+	var outbox bytes.Buffer
+	h := NewPasswordResetHandler(database.NewUserRepository(db), database.NewPasswordResetRepository(db), database.NewUnitOfWork(db),
+		mail.NewLogMailer("api@example.com", &outbox), time.Hour, "https://app.example.com/reset?token=", NewAuditor(database.NewAuditRepository(db)))
+	return h, &outbox
+}
+
+func forgotPassword(h *PasswordResetHandler, email string) int {
+	b, _ := json.Marshal(dto.ForgotPasswordInput{Email: email})
+	w := httptest.NewRecorder()
+	h.ForgotPassword(w, httptest.NewRequest(http.MethodPost, "/users/password/forgot", bytes.NewReader(b)))
+	h.Wait()
+	return w.Code
+}
+
+func resetPassword(h *PasswordResetHandler, token, password string) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(dto.ResetPasswordInput{Token: token, Password: password})
+	w := httptest.NewRecorder()
+	h.ResetPassword(w, httptest.NewRequest(http.MethodPost, "/users/password/reset", bytes.NewReader(b)))
+	return w
+}
+
+func TestForgotPasswordHidesUnknownEmails(t *testing.T) {
+	h, outbox := newPasswordResetHandler()
+	assert.Equal(t, http.StatusAccepted, forgotPassword(h, "nobody@j.com"))
+	assert.Empty(t, outbox.String())
+
+	assert.Equal(t, http.StatusAccepted, forgotPassword(h, "j@j.com"))
+	assert.Contains(t, outbox.String(), "To: j@j.com\r\n")
+	assert.Contains(t, outbox.String(), "Within 1 hour,")
+	assert.Regexp(t, resetLink, outbox.String())
+
+	assert.Equal(t, http.StatusBadRequest, forgotPassword(h, ""))
+}
+
+func TestResetPassword(t *testing.T) {
+	h, outbox := newPasswordResetHandler()
+	ctx := context.Background()
+	user, _ := h.UserDB.FindByEmail(ctx, "j@j.com")
+	h.UserDB.RecordFailedLogin(ctx, user.ID.String(), entity.LockoutPolicy{Threshold: 1, Duration: time.Hour}, time.Now())
+
+	forgotPassword(h, "j@j.com")
+	first := resetLink.FindStringSubmatch(outbox.String())[1]
+	outbox.Reset()
+	forgotPassword(h, "j@j.com")
+	token := resetLink.FindStringSubmatch(outbox.String())[1]
+
+	w := resetPassword(h, token, "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var problem Error
+	json.NewDecoder(w.Body).Decode(&problem)
+	assert.Equal(t, "password", problem.Errors[0].Field)
+
+	assert.Equal(t, http.StatusNoContent, resetPassword(h, token, "abcdef").Code)
+	found, _ := h.UserDB.FindByID(ctx, user.ID.String())
+	assert.True(t, found.ValidatePassword("abcdef"))
+	assert.False(t, found.IsLocked(time.Now()))
+
+	// Tokens work once, and a reset spends the user's other tokens.
+	for _, spent := range []string{token, first, "unknown", ""} {
+		w = resetPassword(h, spent, "ghijkl")
+		assert.Equal(t, http.StatusBadRequest, w.Code, spent)
+		json.NewDecoder(w.Body).Decode(&problem)
+		assert.Equal(t, "token", problem.Errors[0].Field)
+	}
+}
+
+func TestResetPasswordIsAtomic(t *testing.T) {
+	h, outbox := newPasswordResetHandler()
+	forgotPassword(h, "j@j.com")
+	token := resetLink.FindStringSubmatch(outbox.String())[1]
+
+	uow := h.UnitOfWork
+	h.UnitOfWork = revokeFails{uow}
+	assert.Equal(t, http.StatusInternalServerError, resetPassword(h, token, "abcdef").Code)
+	found, _ := h.UserDB.FindByEmail(context.Background(), "j@j.com")
+	assert.True(t, found.ValidatePassword("123456"))
+
+	// Nothing was saved, so the token still works.
+	h.UnitOfWork = uow
+	assert.Equal(t, http.StatusNoContent, resetPassword(h, token, "abcdef").Code)
+}
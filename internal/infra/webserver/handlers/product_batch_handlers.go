@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+)
+
+// Batch modes accepted by POST /products/batch.
+const (
+	BatchModeAtomic     = "atomic"
+	BatchModeBestEffort = "best_effort"
+)
+
+// Batch operations.
+const (
+	BatchOpCreate = "create"
+	BatchOpUpdate = "update"
+	BatchOpDelete = "delete"
+)
+
+// MaxBatchOperations bounds the operations in one batch request.
+const MaxBatchOperations = 1000
+
+var (
+	ErrInvalidBatchMode = errors.New("mode must be atomic or best_effort")
+	ErrInvalidBatchOp   = errors.New("op must be create, update or delete")
+	ErrInvalidBatchSize = fmt.Errorf("operations must list between 1 and %d operations", MaxBatchOperations)
+)
+
+type BatchHandler struct {
+	UnitOfWork database.UnitOfWorkInterface
+	Currency   string
+	Audit      *Auditor
+}
+
+func NewBatchHandler(uow database.UnitOfWorkInterface, currency string, audit *Auditor) *BatchHandler {
+	return &BatchHandler{UnitOfWork: uow, Currency: currency, Audit: audit}
+}
+
+// @Summary      Batch create, update and delete products
+// @Description  Apply up to 1000 product writes in order. In atomic mode (the default) they run in one transaction: if any fails nothing is written, the response has the failing operation's status, and the other operations report 424. In best_effort mode each runs in its own transaction and the response is 200 with the outcome of each.
+// @Description  Each result carries the status the operation would get from its own endpoint: 201 for create, 200 for update and 204 for delete. update and delete need if_match, which takes an ETag from GET or * like the If-Match header; update keeps the currency when it is empty.
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Param        input  body      dto.BatchInput  true  "operations"
+// @Param        Idempotency-Key  header    string  false  "Unique key; retries with it replay the first response"
+// @Success      200  {object}  dto.BatchResult
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      422  {object}  Error  "Idempotency-Key reused with a different request"
+// @Failure      500  {object}  Error
+// @Router       /products/batch [post]
+// @Security     ApiKeyAuth
+func (h *BatchHandler) BatchProducts(w http.ResponseWriter, r *http.Request) {
+	var input dto.BatchInput
+	if err := decodeJSON(r, &input); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if input.Mode == "" {
+		input.Mode = BatchModeAtomic
+	}
+	if input.Mode != BatchModeAtomic && input.Mode != BatchModeBestEffort {
+		WriteError(w, r, &InvalidFieldError{Field: "mode", Err: ErrInvalidBatchMode})
+		return
+	}
+	if len(input.Operations) == 0 || len(input.Operations) > MaxBatchOperations {
+		WriteError(w, r, &InvalidFieldError{Field: "operations", Err: ErrInvalidBatchSize})
+		return
+	}
+
+	result := dto.BatchResult{Mode: input.Mode, Results: make([]dto.BatchItemResult, len(input.Operations))}
+	status := http.StatusOK
+	if input.Mode == BatchModeAtomic {
+		failed := -1
+		err := h.UnitOfWork.Do(r.Context(), func(repos database.Repositories) error {
+			for i, op := range input.Operations {
+				item, err := h.apply(r, repos, op)
+				if err != nil {
+					failed = i
+					result.Results[i] = batchError(r, i, op, err)
+					return err
+				}
+				item.Index = i
+				result.Results[i] = item
+			}
+			return nil
+		})
+		if err != nil && failed < 0 {
+			WriteError(w, r, err)
+			return
+		}
+		if err != nil {
+			status = result.Results[failed].Status
+			if status >= http.StatusInternalServerError {
+				// batchError has logged err already
+				WriteProblem(w, r, problemFor(err))
+				return
+			}
+			for i, op := range input.Operations {
+				if i != failed {
+					result.Results[i] = dto.BatchItemResult{
+						Index:  i,
+						Op:     op.Op,
+						ID:     op.ID,
+						Status: http.StatusFailedDependency,
+						Error:  fmt.Sprintf("not applied because operation %d failed", failed),
+					}
+				}
+			}
+			result.Failed = 1
+		} else {
+			result.Applied = len(input.Operations)
+		}
+	} else {
+		for i, op := range input.Operations {
+			var item dto.BatchItemResult
+			err := h.UnitOfWork.Do(r.Context(), func(repos database.Repositories) error {
+				var err error
+				item, err = h.apply(r, repos, op)
+				return err
+			})
+			if err != nil {
+				item = batchError(r, i, op, err)
+				result.Failed++
+			} else {
+				item.Index = i
+				result.Applied++
+			}
+			result.Results[i] = item
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// apply runs one operation with repos, recording it in the same unit of
+// work's audit log.
+func (h *BatchHandler) apply(r *http.Request, repos database.Repositories, op dto.BatchOperation) (dto.BatchItemResult, error) {
+	audit := h.Audit.With(repos.Audit)
+	ctx := r.Context()
+	item := dto.BatchItemResult{Op: op.Op, ID: op.ID}
+	switch op.Op {
+	case BatchOpCreate:
+		if op.Currency == "" {
+			op.Currency = h.Currency
+		}
+		price, err := entity.ParsePrice(op.Price, op.Currency)
+		if err != nil {
+			return item, err
+		}
+		p, err := entity.NewProduct(op.Name, price, op.Currency)
+		if err != nil {
+			return item, err
+		}
+		if err := repos.Products.Create(ctx, p); err != nil {
+			return item, err
+		}
+		audit.Record(r, entity.AuditCreate, AuditEntityProduct, p.ID.String(), nil, p)
+		item.ID, item.Status, item.Product = p.ID.String(), http.StatusCreated, p
+	case BatchOpUpdate, BatchOpDelete:
+		id, err := pkgentity.ParseId(op.ID)
+		if err != nil {
+			return item, entity.ErrInvalidID
+		}
+		version, err := parseIfMatch(op.IfMatch)
+		if err != nil {
+			return item, err
+		}
+		before, err := repos.Products.FindByID(ctx, op.ID)
+		if err != nil {
+			return item, err
+		}
+		if op.Op == BatchOpDelete {
+			rows, err := repos.Products.Delete(ctx, op.ID, version)
+			if err != nil {
+				return item, err
+			}
+			if rows == 0 {
+				return item, database.ErrNotFound
+			}
+			audit.Record(r, entity.AuditDelete, AuditEntityProduct, op.ID, before, nil)
+			item.Status = http.StatusNoContent
+			return item, nil
+		}
+		if op.Currency == "" {
+			op.Currency = before.Currency
+		}
+		price, err := entity.ParsePrice(op.Price, op.Currency)
+		if err != nil {
+			return item, err
+		}
+		p := entity.Product{ID: id, Name: op.Name, PriceMinor: price, Currency: op.Currency, Version: version}
+		if err := p.Validate(); err != nil {
+			return item, err
+		}
+		rows, err := repos.Products.Update(ctx, &p)
+		if err != nil {
+			return item, err
+		}
+		if rows == 0 {
+			return item, database.ErrNotFound
+		}
+		after := *before
+		after.Name, after.PriceMinor, after.Currency, after.Version = p.Name, p.PriceMinor, p.Currency, p.Version
+		audit.Record(r, entity.AuditUpdate, AuditEntityProduct, op.ID, before, &after)
+		item.Status, item.Product = http.StatusOK, &after
+	default:
+		return item, &InvalidFieldError{Field: "op", Err: ErrInvalidBatchOp}
+	}
+	return item, nil
+}
+
+// batchError reports a failed operation with the status, message and field
+// its own endpoint would have used.
+func batchError(r *http.Request, index int, op dto.BatchOperation, err error) dto.BatchItemResult {
+	p := problemFor(err)
+	if p.Status >= http.StatusInternalServerError {
+		logServerError(r, err)
+	}
+	item := dto.BatchItemResult{Index: index, Op: op.Op, ID: op.ID, Status: p.Status, Error: p.Detail}
+	if len(p.Errors) > 0 {
+		item.Field = p.Errors[0].Field
+	}
+	return item
+}
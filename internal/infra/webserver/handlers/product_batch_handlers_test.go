@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newBatchHandler() (*BatchHandler, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	db.AutoMigrate(&entity.Product{}, &entity.ProductCategory{}, &entity.ProductTag{}, &entity.AuditEntry{})
+	return NewBatchHandler(database.NewUnitOfWork(db), "USD", NewAuditor(database.NewAuditRepository(db))), db
+}
+
+func batch(h *BatchHandler, body string) (*httptest.ResponseRecorder, dto.BatchResult) {
+	w := httptest.NewRecorder()
+	h.BatchProducts(w, httptest.NewRequest(http.MethodPost, "/products/batch", strings.NewReader(body)))
+	var result dto.BatchResult
+	json.NewDecoder(w.Body).Decode(&result)
+	return w, result
+}
+
+func TestBatchProductsAtomic(t *testing.T) {
+	h, db := newBatchHandler()
+	ctx := context.Background()
+	products := database.NewProductRepository(db)
+	existing, _ := entity.NewProduct("Existing", 100, "EUR")
+	products.Create(ctx, existing)
+	id := existing.ID.String()
+
+	w, result := batch(h, `{"operations":[
+		{"op":"create","name":"New","price":"2.50"},
+		{"op":"update","id":"`+id+`","if_match":"\"2\"","name":"Renamed","price":"1.10"}
+	]}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, http.StatusFailedDependency, result.Results[0].Status)
+	assert.Equal(t, http.StatusPreconditionFailed, result.Results[1].Status)
+	total, _ := products.Count(ctx, database.ProductFilter{})
+	assert.Equal(t, int64(1), total)
+	var entries int64
+	db.Model(&entity.AuditEntry{}).Count(&entries)
+	assert.Equal(t, int64(0), entries)
+
+	w, result = batch(h, `{"mode":"atomic","operations":[
+		{"op":"create","name":"New","price":"2.50"},
+		{"op":"update","id":"`+id+`","if_match":"\"1\"","name":"Renamed","price":"1.10"}
+	]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, result.Applied)
+	assert.Equal(t, http.StatusCreated, result.Results[0].Status)
+	assert.Equal(t, "USD", result.Results[0].Product.Currency)
+	assert.Equal(t, 1, result.Results[1].Index)
+	assert.Equal(t, "EUR", result.Results[1].Product.Currency)
+	assert.Equal(t, int64(2), result.Results[1].Product.Version)
+	db.Model(&entity.AuditEntry{}).Count(&entries)
+	assert.Equal(t, int64(2), entries)
+
+	w, result = batch(h, `{"operations":[{"op":"delete","id":"`+id+`","if_match":"*"}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusNoContent, result.Results[0].Status)
+	_, err := products.FindByID(ctx, id)
+	assert.ErrorIs(t, err, database.ErrNotFound)
+}
+
+func TestBatchProductsBestEffort(t *testing.T) {
+	h, db := newBatchHandler()
+	products := database.NewProductRepository(db)
+
+	w, result := batch(h, `{"mode":"best_effort","operations":[
+		{"op":"create","name":"Kept","price":"1.00"},
+		{"op":"create","name":"","price":"1.00"},
+		{"op":"update","id":"00000000-0000-0000-0000-000000000009","if_match":"*","name":"X","price":"1"},
+		{"op":"delete","id":"00000000-0000-0000-0000-000000000009"},
+		{"op":"upsert"}
+	]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, result.Applied)
+	assert.Equal(t, 4, result.Failed)
+	statuses := []int{}
+	for i, item := range result.Results {
+		assert.Equal(t, i, item.Index)
+		statuses = append(statuses, item.Status)
+	}
+	assert.Equal(t, []int{http.StatusCreated, http.StatusBadRequest, http.StatusNotFound, http.StatusPreconditionRequired, http.StatusBadRequest}, statuses)
+	assert.Equal(t, "name", result.Results[1].Field)
+	assert.Equal(t, "op", result.Results[4].Field)
+	total, _ := products.Count(context.Background(), database.ProductFilter{})
+	assert.Equal(t, int64(1), total)
+}
+
+func TestBatchProductsInvalidRequest(t *testing.T) {
+	h, _ := newBatchHandler()
+	for _, body := range []string{
+		`{"operations":[]}`,
+		`{"mode":"eventually","operations":[{"op":"create","name":"A","price":"1"}]}`,
+		`[`,
+	} {
+		w, _ := batch(h, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestBatchErrorHidesServerErrors(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/products/batch", nil)
+	op := dto.BatchOperation{Op: "delete", ID: "1"}
+	item := batchError(r, 0, op, errors.New("UNIQUE constraint failed: products.id"))
+	assert.Equal(t, http.StatusInternalServerError, item.Status)
+	assert.Equal(t, serverErrorDetail, item.Error)
+
+	item = batchError(r, 0, op, database.ErrNotFound)
+	assert.Equal(t, http.StatusNotFound, item.Status)
+	assert.Equal(t, database.ErrNotFound.Error(), item.Error)
+}
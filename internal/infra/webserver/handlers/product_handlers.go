@@ -2,54 +2,73 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
-	"strconv"
+	"net/url"
+	"time"
 
 	"github.com/antoniofmoliveira/apis/internal/dto"
 	"github.com/antoniofmoliveira/apis/internal/entity"
 	"github.com/antoniofmoliveira/apis/internal/infra/database"
 	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+	"github.com/antoniofmoliveira/apis/pkg/money"
+	"github.com/antoniofmoliveira/apis/pkg/patch"
 )
 
 type ProductHandler struct {
-	ProductDB database.ProductRepositoryInterface
+	ProductDB  database.ProductRepositoryInterface
+	Pagination Pagination
+	// Currency is the ISO 4217 code assumed when a request omits one.
+	Currency string
+	Audit    *Auditor
 }
 
-func NewProductHandler(db database.ProductRepositoryInterface) *ProductHandler {
-	return &ProductHandler{ProductDB: db}
+func NewProductHandler(db database.ProductRepositoryInterface, pagination Pagination, currency string, audit *Auditor) *ProductHandler {
+	return &ProductHandler{ProductDB: db, Pagination: pagination, Currency: currency, Audit: audit}
 }
 
 // @Summary      Create a new product
-// @Description  Create a new product
+// @Description  Create a new product. price is a decimal string with at most as many decimal places as the currency allows; currency defaults to the server's.
 // @Tags         products
 // @Accept       json
 // @Produce      json
 // @Param        input  body      dto.CreateProductInput  true  "product request"
+// @Param        Idempotency-Key  header    string  false  "Unique key; retries with it replay the first response"
 // @Success      201
 // @Failure      400     {object}  Error
+// @Failure      403     {object}  Error
+// @Failure      422  {object}  Error  "Idempotency-Key reused with a different request"
 // @Failure      500     {object}  Error
 // @Router       /products [post]
 // @Security     ApiKeyAuth
 func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	var product dto.CreateProductInput
-	err := json.NewDecoder(r.Body).Decode(&product)
+	err := decodeJSON(r, &product)
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
-	p, err := entity.NewProduct(product.Name, product.Price)
+	if product.Currency == "" {
+		product.Currency = h.Currency
+	}
+	price, err := entity.ParsePrice(product.Price, product.Currency)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	p, err := entity.NewProduct(product.Name, price, product.Currency)
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
-	err = h.ProductDB.Create(p)
+	err = h.ProductDB.Create(r.Context(), p)
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
+	h.Audit.Record(r, entity.AuditCreate, AuditEntityProduct, p.ID.String(), nil, p)
 	w.WriteHeader(http.StatusCreated)
 }
 
@@ -59,7 +78,10 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 // @Accept       json
 // @Produce      json
 // @Param        id  path      string  true  "Product ID"
+// @Param        If-None-Match  header    string  false  "ETag from a previous response"
 // @Success      200  {object}  entity.Product
+// @Header       200  {string}  ETag  "Current product version"
+// @Success      304  "Not modified"
 // @Failure      400  {object}  Error
 // @Failure      404  {object}  Error
 // @Failure      500  {object}  Error
@@ -68,134 +90,608 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
-		json.NewEncoder(w).Encode(Error{Message: "Product ID is required"})
-		http.Error(w, "Product ID is required", http.StatusBadRequest)
+		WriteError(w, r, entity.ErrIDIsRequired)
+		return
+	}
+	product, err := h.ProductDB.FindByID(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found"))
+		return
 	}
-	product, err := h.ProductDB.FindByID(id)
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
+		return
+	}
+	etag := versionETag(product.Version)
+	w.Header().Set("ETag", etag)
+	if noneMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(product)
 }
 
-// @Summary      Update product by ID
-// @Description  Update product by ID
+// @Summary      Replace product by ID
+// @Description  Replace the name and price of a product. Both are required and validated; id may be omitted but must match the path when sent. currency defaults to the product's current one.
 // @Tags         products
 // @Accept       json
 // @Produce      json
 // @Param        id  path      string  true  "Product ID"
+// @Param        If-Match  header    string  true  "ETag from GET, or * for any version"
 // @Param        input  body      dto.UpdateProductInput  true  "product request"
 // @Success      200
+// @Header       200  {string}  ETag  "New product version"
 // @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
 // @Failure      404  {object}  Error
+// @Failure      412  {object}  Error
+// @Failure      428  {object}  Error
 // @Failure      500  {object}  Error
 // @Router       /products/{id} [put]
 // @Security     ApiKeyAuth
 func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
-		json.NewEncoder(w).Encode(Error{Message: "Product ID is required"})
-		http.Error(w, "Product ID is required", http.StatusBadRequest)
+		WriteError(w, r, entity.ErrIDIsRequired)
+		return
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
 	}
 	var product dto.UpdateProductInput
-	err := json.NewDecoder(r.Body).Decode(&product)
+	err = decodeJSON(r, &product)
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
 	ID, err := pkgentity.ParseId(id)
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, entity.ErrInvalidID)
+		return
+	}
+	if product.ID != "" && product.ID != id {
+		WriteError(w, r, &InvalidFieldError{Field: "id", Err: ErrIDMismatch})
+		return
+	}
+	before, err := h.ProductDB.FindByID(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if product.Currency == "" {
+		product.Currency = before.Currency
+	}
+	price, err := entity.ParsePrice(product.Price, product.Currency)
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
 	p := entity.Product{
-		ID:    ID,
-		Name:  product.Name,
-		Price: product.Price,
+		ID:         ID,
+		Name:       product.Name,
+		PriceMinor: price,
+		Currency:   product.Currency,
+		Version:    version,
 	}
-	rows, err := h.ProductDB.Update(&p)
+	if err := p.Validate(); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	rows, err := h.ProductDB.Update(r.Context(), &p)
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 	if rows == 0 {
-		json.NewEncoder(w).Encode(Error{Message: "Product not found"})
-		http.Error(w, "Product not found", http.StatusNotFound)
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found"))
 		return
 	}
+	after := *before
+	after.Name, after.PriceMinor, after.Currency, after.Version = p.Name, p.PriceMinor, p.Currency, p.Version
+	h.Audit.Record(r, entity.AuditUpdate, AuditEntityProduct, id, before, &after)
+	w.Header().Set("ETag", versionETag(p.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 }
 
+// @Summary      Patch product by ID
+// @Description  Apply an RFC 7396 merge patch (application/merge-patch+json) or an RFC 6902 JSON Patch (application/json-patch+json) to the product representation returned by GET. id, created_at, version, deleted_at, stock and reserved are read-only. The patched product is validated before it is saved.
+// @Tags         products
+// @Accept       application/merge-patch+json
+// @Accept       application/json-patch+json
+// @Produce      json
+// @Param        id  path      string  true  "Product ID"
+// @Param        If-Match  header    string  true  "ETag from GET, or * for any version"
+// @Param        input  body      object  true  "merge patch object or JSON Patch operations"
+// @Success      200  {object}  entity.Product
+// @Header       200  {string}  ETag  "New product version"
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      409  {object}  Error  "A JSON Patch test operation failed"
+// @Failure      412  {object}  Error
+// @Failure      415  {object}  Error
+// @Failure      422  {object}  Error  "A JSON Patch path does not exist"
+// @Failure      428  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /products/{id} [patch]
+// @Security     ApiKeyAuth
+func (h *ProductHandler) PatchProduct(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		WriteError(w, r, entity.ErrIDIsRequired)
+		return
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	apply, err := patchFunc(r)
+	if err != nil {
+		w.Header().Set("Accept-Patch", MergePatchContentType+", "+JSONPatchContentType)
+		WriteError(w, r, err)
+		return
+	}
+	body, err := ReadBody(w, r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	product, err := h.ProductDB.FindByID(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if version != 0 && version != product.Version {
+		WriteError(w, r, ErrPreconditionFailed)
+		return
+	}
+	patched, err := patchProduct(product, body, apply)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	rows, err := h.ProductDB.Update(r.Context(), patched)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if rows == 0 {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found"))
+		return
+	}
+	h.Audit.Record(r, entity.AuditUpdate, AuditEntityProduct, id, product, patched)
+	w.Header().Set("ETag", versionETag(patched.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(patched)
+}
+
+// patchFunc selects the patch format from the request Content-Type.
+func patchFunc(r *http.Request) (func(doc, patch []byte) ([]byte, error), error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case MergePatchContentType:
+		return patch.MergePatch, nil
+	case JSONPatchContentType:
+		return patch.JSONPatch, nil
+	default:
+		return nil, ErrUnsupportedMediaType
+	}
+}
+
+// patchProduct applies body to the JSON representation of product and
+// returns the validated result. Read-only fields must come out unchanged.
+func patchProduct(product *entity.Product, body []byte, apply func(doc, patch []byte) ([]byte, error)) (*entity.Product, error) {
+	original, err := json.Marshal(product)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := apply(original, body)
+	if err != nil {
+		return nil, err
+	}
+	if err := knownFields(original, doc); err != nil {
+		return nil, err
+	}
+	var patched entity.Product
+	if err := json.Unmarshal(doc, &patched); err != nil {
+		// price and currency errors keep their field
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBody, err)
+	}
+	switch {
+	case patched.ID != product.ID:
+		return nil, &InvalidFieldError{Field: "id", Err: ErrReadOnlyField}
+	case !patched.CreatedAt.Equal(product.CreatedAt):
+		return nil, &InvalidFieldError{Field: "created_at", Err: ErrReadOnlyField}
+	case patched.Version != product.Version:
+		return nil, &InvalidFieldError{Field: "version", Err: ErrReadOnlyField}
+	case patched.DeletedAt != product.DeletedAt:
+		return nil, &InvalidFieldError{Field: "deleted_at", Err: ErrReadOnlyField}
+	case patched.Stock != product.Stock:
+		return nil, &InvalidFieldError{Field: "stock", Err: ErrReadOnlyField}
+	case patched.Reserved != product.Reserved:
+		return nil, &InvalidFieldError{Field: "reserved", Err: ErrReadOnlyField}
+	}
+	if err := patched.Validate(); err != nil {
+		return nil, err
+	}
+	return &patched, nil
+}
+
+// knownFields rejects members of the patched document that the original
+// representation does not have. Product decodes itself, so a decoder's
+// DisallowUnknownFields would not reach its fields.
+func knownFields(original, patched []byte) error {
+	var before, after map[string]json.RawMessage
+	if err := json.Unmarshal(original, &before); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBody, err)
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidBody, key)
+		}
+	}
+	return nil
+}
+
 // @Summary      Delete product by ID
-// @Description  Delete product by ID
+// @Description  Move a product to the trash. It can be restored until it is purged.
 // @Tags         products
 // @Accept       json
 // @Produce      json
 // @Param        id  path      string  true  "Product ID"
+// @Param        If-Match  header    string  true  "ETag from GET, or * for any version"
 // @Success      200
 // @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
 // @Failure      404  {object}  Error
+// @Failure      412  {object}  Error
+// @Failure      428  {object}  Error
 // @Failure      500  {object}  Error
 // @Router       /products/{id} [delete]
 // @Security     ApiKeyAuth
 func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if id == "" {
-		json.NewEncoder(w).Encode(Error{Message: "Product ID is required"})
-		http.Error(w, "Product ID is required", http.StatusBadRequest)
+		WriteError(w, r, entity.ErrIDIsRequired)
+		return
 	}
-	rows, err := h.ProductDB.Delete(id)
+	version, err := ifMatchVersion(r)
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
+		return
+	}
+	before, err := h.ProductDB.FindByID(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	rows, err := h.ProductDB.Delete(r.Context(), id, version)
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
 	if rows == 0 {
-		json.NewEncoder(w).Encode(Error{Message: "Product not found"})
-		http.Error(w, "Product not found", http.StatusNotFound)
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found"))
 		return
 	}
+	h.Audit.Record(r, entity.AuditDelete, AuditEntityProduct, id, before, nil)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 }
 
-// @Summary      Find all products
-// @Description  Find all products
+// @Summary      Restore product from the trash
+// @Description  Restore a deleted product. The product gets a new version.
 // @Tags         products
-// @Accept       json
 // @Produce      json
-// @Param        page  query     int  false  "Page number"
-// @Param        limit  query     int  false  "Number of products per page"
-// @Param        sort  query     string  false  "Sort order (asc or desc)"
+// @Param        id  path      string  true  "Product ID"
 // @Success      200  {object}  entity.Product
+// @Header       200  {string}  ETag  "New product version"
 // @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
 // @Failure      404  {object}  Error
 // @Failure      500  {object}  Error
+// @Router       /products/{id}/restore [post]
+// @Security     ApiKeyAuth
+func (h *ProductHandler) RestoreProduct(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		WriteError(w, r, entity.ErrIDIsRequired)
+		return
+	}
+	rows, err := h.ProductDB.Restore(r.Context(), id)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if rows == 0 {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found in trash"))
+		return
+	}
+	product, err := h.ProductDB.FindByID(r.Context(), id)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.Audit.Record(r, entity.AuditRestore, AuditEntityProduct, id, nil, product)
+	w.Header().Set("ETag", versionETag(product.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
+
+// @Summary      Purge product from the trash
+// @Description  Permanently delete a product that is already in the trash. This cannot be undone.
+// @Tags         products
+// @Param        id  path      string  true  "Product ID"
+// @Success      204
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /products/trash/{id} [delete]
+// @Security     ApiKeyAuth
+func (h *ProductHandler) PurgeProduct(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		WriteError(w, r, entity.ErrIDIsRequired)
+		return
+	}
+	rows, err := h.ProductDB.Purge(r.Context(), id)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if rows == 0 {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found in trash"))
+		return
+	}
+	h.Audit.Record(r, entity.AuditPurge, AuditEntityProduct, id, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      Find all products
+// @Description  Find products one page at a time, optionally filtered and sorted. Unknown parameters and invalid values are rejected. Deleted products are excluded.
+// @Description  Passing cursor (empty for the first page) switches to keyset pagination in (created_at, id) order: the body is a dto.ProductCursorPage and next_cursor is omitted on the last page. Cursor mode cannot be combined with page or sort.
+// @Description  In page mode X-Total-Count and Link headers are always set. The body is a bare array unless the server is configured for envelopes or the client accepts application/vnd.page+json, in which case it is a dto.ProductPage.
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Produce      application/vnd.page+json
+// @Param        page  query     int  false  "Page number, starting at 1"
+// @Param        limit  query     int  false  "Number of products per page, up to the server maximum"
+// @Param        cursor  query     string  false  "Opaque cursor from next_cursor; empty starts a scan"
+// @Param        sort  query     string  false  "Comma separated fields (id, name, price, created_at), prefix with - for descending, e.g. price,-name. asc or desc order by created_at"
+// @Param        name  query     string  false  "Name contains (case insensitive)"
+// @Param        currency  query     string  false  "Only products priced in this ISO 4217 currency"
+// @Param        min_price  query     string  false  "Minimum decimal price in currency, or the server's default currency"
+// @Param        max_price  query     string  false  "Maximum decimal price in currency, or the server's default currency"
+// @Param        created_from  query     string  false  "Created at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param        created_to  query     string  false  "Created at or before (RFC 3339 or YYYY-MM-DD, inclusive)"
+// @Param        category  query     string  false  "Only products assigned to this category ID"
+// @Param        include_subcategories  query     bool  false  "Also match products in any category below category"
+// @Param        tag  query     []string  false  "Only products carrying this tag; repeat to require several"  collectionFormat(multi)
+// @Success      200  {array}   entity.Product
+// @Header       200  {integer}  X-Total-Count  "Number of products matching the filter"
+// @Header       200  {string}   Link  "first, prev, next and last page links"
+// @Failure      400  {object}  Error
+// @Failure      500  {object}  Error
 // @Router       /products [get]
 // @Security     ApiKeyAuth
 func (h *ProductHandler) FindAllProducts(w http.ResponseWriter, r *http.Request) {
-	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	h.listProducts(w, r, false)
+}
+
+// @Summary      List products in the trash
+// @Description  List deleted products, most recently deleted first unless sort is given. Accepts the same parameters and pagination modes as GET /products.
+// @Tags         products
+// @Accept       json
+// @Produce      json
+// @Param        page  query     int  false  "Page number, starting at 1"
+// @Param        limit  query     int  false  "Number of products per page, up to the server maximum"
+// @Param        cursor  query     string  false  "Opaque cursor from next_cursor; empty starts a scan"
+// @Param        sort  query     string  false  "Comma separated fields (id, name, price, created_at, deleted_at), prefix with - for descending"
+// @Success      200  {array}   entity.Product
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /products/trash [get]
+// @Security     ApiKeyAuth
+func (h *ProductHandler) FindTrash(w http.ResponseWriter, r *http.Request) {
+	h.listProducts(w, r, true)
+}
+
+// listProducts serves live products or, when deleted is set, the trash.
+func (h *ProductHandler) listProducts(w http.ResponseWriter, r *http.Request, deleted bool) {
+	query, err := parseProductQuery(r.URL.Query(), h.Pagination, h.Currency)
 	if err != nil {
-		page = 0
+		WriteError(w, r, err)
+		return
+	}
+	query.Filter.Deleted = deleted
+	if deleted && query.Sort == nil {
+		query.Sort = []database.SortField{{Field: "deleted_at", Desc: true}}
+	}
+	if r.URL.Query().Has("cursor") {
+		h.scanProducts(w, r, query)
+		return
 	}
-	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	total, err := h.ProductDB.Count(r.Context(), query.Filter)
 	if err != nil {
-		limit = 0
+		WriteError(w, r, err)
+		return
 	}
-	sort := r.URL.Query().Get("sort")
-	products, err := h.ProductDB.FindAll(page, limit, sort)
+	products, err := h.ProductDB.Search(r.Context(), query)
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
+		return
+	}
+	writePageHeaders(w, r, query.Page, query.Limit, total)
+	if h.Pagination.wantsEnvelope(r) {
+		w.Header().Set("Content-Type", PageMediaType)
+		json.NewEncoder(w).Encode(dto.ProductPage{
+			Items:      products,
+			Page:       query.Page,
+			Limit:      query.Limit,
+			Total:      total,
+			TotalPages: totalPages(total, query.Limit),
+		})
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(products)
 }
+
+// scanProducts serves the cursor mode of FindAllProducts. One extra row is
+// fetched to tell whether another page follows.
+func (h *ProductHandler) scanProducts(w http.ResponseWriter, r *http.Request, query database.ProductQuery) {
+	values := r.URL.Query()
+	for _, key := range []string{"page", "sort"} {
+		if values.Has(key) {
+			WriteError(w, r, &InvalidFieldError{Field: key, Err: ErrCursorConflict})
+			return
+		}
+	}
+	var after *database.ProductCursor
+	if s := values.Get("cursor"); s != "" {
+		cursor, err := database.DecodeProductCursor(s)
+		if err != nil {
+			WriteError(w, r, &InvalidFieldError{Field: "cursor", Err: err})
+			return
+		}
+		after = &cursor
+	}
+	products, err := h.ProductDB.SearchAfter(r.Context(), query.Filter, after, query.Limit+1)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	page := dto.ProductCursorPage{Items: products, Limit: query.Limit}
+	if page.Items == nil {
+		page.Items = []entity.Product{}
+	}
+	if len(products) > query.Limit {
+		page.Items = products[:query.Limit]
+		page.NextCursor = database.CursorFor(page.Items[query.Limit-1]).Encode()
+		writeCursorLink(w, r, page.NextCursor)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// productQueryParams lists the query parameters accepted by FindAllProducts.
+var productQueryParams = map[string]bool{
+	"page":                  true,
+	"limit":                 true,
+	"cursor":                true,
+	"sort":                  true,
+	"name":                  true,
+	"currency":              true,
+	"min_price":             true,
+	"max_price":             true,
+	"created_from":          true,
+	"created_to":            true,
+	"category":              true,
+	"include_subcategories": true,
+	"tag":                   true,
+}
+
+// parseProductQuery reads price bounds in the currency parameter, falling
+// back to currency, and then only matches products in that currency.
+func parseProductQuery(values url.Values, pagination Pagination, currency string) (database.ProductQuery, error) {
+	var query database.ProductQuery
+	for key := range values {
+		if !productQueryParams[key] {
+			return query, &InvalidFieldError{Field: key, Err: ErrUnknownParameter}
+		}
+	}
+	var err error
+	if query.Page, query.Limit, err = pagination.parsePage(values); err != nil {
+		return query, err
+	}
+
+	if query.Sort, err = database.ParseProductSort(values.Get("sort")); err != nil {
+		return query, &InvalidFieldError{Field: "sort", Err: err}
+	}
+	query.Filter.Name = values.Get("name")
+	query.Filter.Currency = values.Get("currency")
+	if query.Filter.Currency != "" {
+		if _, err := money.Exponent(query.Filter.Currency); err != nil {
+			return query, &InvalidFieldError{Field: "currency", Err: err}
+		}
+		currency = query.Filter.Currency
+	}
+	if query.Filter.MinPrice, err = parsePriceParam(values, "min_price", currency); err != nil {
+		return query, err
+	}
+	if query.Filter.MaxPrice, err = parsePriceParam(values, "max_price", currency); err != nil {
+		return query, err
+	}
+	if query.Filter.MinPrice != nil || query.Filter.MaxPrice != nil {
+		query.Filter.Currency = currency
+	}
+	if query.Filter.CreatedFrom, err = parseTimeParam(values, "created_from", false); err != nil {
+		return query, err
+	}
+	if query.Filter.CreatedTo, err = parseTimeParam(values, "created_to", true); err != nil {
+		return query, err
+	}
+	if err = parseCategoryFilter(values, &query.Filter); err != nil {
+		return query, err
+	}
+	if err = query.Filter.Validate(); err != nil {
+		return query, &InvalidFieldError{Field: "filter", Err: err}
+	}
+	return query, nil
+}
+
+// parsePriceParam parses a decimal price in currency into minor units.
+func parsePriceParam(values url.Values, key, currency string) (*int64, error) {
+	s := values.Get(key)
+	if s == "" {
+		return nil, nil
+	}
+	amount, err := money.Parse(s, currency)
+	if err != nil {
+		return nil, &InvalidFieldError{Field: key, Err: err}
+	}
+	return &amount, nil
+}
+
+// parseTimeParam accepts RFC 3339 timestamps or plain dates. A plain date
+// used as an upper bound covers the whole day.
+func parseTimeParam(values url.Values, key string, endOfDay bool) (*time.Time, error) {
+	s := values.Get(key)
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return nil, &InvalidFieldError{Field: key, Err: errors.New("must be an RFC 3339 timestamp or YYYY-MM-DD date")}
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newProductHandler() *ProductHandler {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	db.AutoMigrate(&entity.Product{}, &entity.ProductCategory{}, &entity.ProductTag{}, &entity.AuditEntry{})
+	return NewProductHandler(database.NewProductRepository(db), DefaultPagination(), "USD", NewAuditor(database.NewAuditRepository(db)))
+}
+
+func TestGetProductNotFound(t *testing.T) {
+	h := newProductHandler()
+	r := httptest.NewRequest(http.MethodGet, "/products/x", nil)
+	r.SetPathValue("id", pkgentity.NewId().String())
+	w := httptest.NewRecorder()
+	h.GetProduct(w, r)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+}
+
+func TestGetProductEmptyID(t *testing.T) {
+	h := newProductHandler()
+	r := httptest.NewRequest(http.MethodGet, "/products/", nil)
+	w := httptest.NewRecorder()
+	h.GetProduct(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetProduct(t *testing.T) {
+	h := newProductHandler()
+	p, _ := entity.NewProduct("Product", 1000, "USD")
+	assert.Nil(t, h.ProductDB.Create(context.Background(), p))
+
+	r := httptest.NewRequest(http.MethodGet, "/products/x", nil)
+	r.SetPathValue("id", p.ID.String())
+	w := httptest.NewRecorder()
+	h.GetProduct(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
+
+func findAllProducts(h *ProductHandler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.FindAllProducts(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestFindAllProductsFilters(t *testing.T) {
+	h := newProductHandler()
+	for _, p := range []struct {
+		name  string
+		price int64
+	}{{"Blue Shirt", 3000}, {"Red Shirt", 2000}, {"Blue Pants", 5000}} {
+		product, _ := entity.NewProduct(p.name, p.price, "USD")
+		assert.Nil(t, h.ProductDB.Create(context.Background(), product))
+	}
+
+	w := findAllProducts(h, "/products?name=blue&min_price=10&max_price=40&sort=-price")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var products []entity.Product
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&products))
+	assert.Len(t, products, 1)
+	assert.Equal(t, "Blue Shirt", products[0].Name)
+
+	w = findAllProducts(h, "/products?sort=price,-name&created_to="+time.Now().Format(time.DateOnly))
+	assert.Equal(t, http.StatusOK, w.Code)
+	products = nil
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&products))
+	assert.Len(t, products, 3)
+	assert.Equal(t, "Red Shirt", products[0].Name)
+}
+
+func TestFindAllProductsInvalidQuery(t *testing.T) {
+	h := newProductHandler()
+	for target, field := range map[string]string{
+		"/products?sort=password":              "sort",
+		"/products?color=red":                  "color",
+		"/products?min_price=cheap":            "min_price",
+		"/products?min_price=10&max_price=5":   "filter",
+		"/products?created_from=yesterday":     "created_from",
+		"/products?page=abc":                   "page",
+		"/products?page=0":                     "page",
+		"/products?limit=-1":                   "limit",
+		"/products?limit=101":                  "limit",
+		"/products?cursor=garbage":             "cursor",
+		"/products?cursor=&page=2":             "page",
+		"/products?cursor=&sort=price":         "sort",
+		"/products?min_price=1.005":            "min_price",
+		"/products?currency=JPY&max_price=1.5": "max_price",
+		"/products?currency=usd":               "currency",
+	} {
+		w := findAllProducts(h, target)
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+		var p Error
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&p))
+		assert.Equal(t, field, p.Errors[0].Field, target)
+	}
+}
+
+func TestCreateProductPrice(t *testing.T) {
+	h := newProductHandler()
+	for _, body := range []string{
+		`{"name":"Default","price":"12.30"}`,
+		`{"name":"Number","price":7.5,"currency":"EUR"}`,
+		`{"name":"Yen","price":"1500","currency":"JPY"}`,
+		`{"name":"Dinar","price":"1.234","currency":"KWD"}`,
+	} {
+		w := httptest.NewRecorder()
+		h.CreateProduct(w, httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body)))
+		assert.Equal(t, http.StatusCreated, w.Code, body)
+	}
+	w := findAllProducts(h, "/products?sort=name")
+	var products []entity.Product
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&products))
+	var got []string
+	for _, p := range products {
+		got = append(got, string(p.Price())+" "+p.Currency)
+	}
+	assert.ElementsMatch(t, []string{"12.30 USD", "7.50 EUR", "1500 JPY", "1.234 KWD"}, got)
+
+	w = findAllProducts(h, "/products?currency=EUR&max_price=10")
+	products = nil
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&products))
+	assert.Len(t, products, 1)
+	assert.Equal(t, "Number", products[0].Name)
+
+	for body, field := range map[string]string{
+		`{"name":"Cents","price":"0.001"}`:                "price",
+		`{"name":"Yen","price":"10.5","currency":"JPY"}`:  "price",
+		`{"name":"Unknown","price":"1","currency":"XYZ"}`: "currency",
+		`{"name":"Missing"}`:                              "price",
+	} {
+		w := httptest.NewRecorder()
+		h.CreateProduct(w, httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		var problem Error
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, field, problem.Errors[0].Field, body)
+	}
+}
+
+func TestFindAllProductsPagination(t *testing.T) {
+	h := newProductHandler()
+	for i := 0; i < 5; i++ {
+		product, _ := entity.NewProduct(fmt.Sprintf("Product %d", i), int64(i+1)*100, "USD")
+		assert.Nil(t, h.ProductDB.Create(context.Background(), product))
+	}
+
+	w := findAllProducts(h, "/products?limit=2&page=2&sort=price")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "5", w.Header().Get("X-Total-Count"))
+	link := w.Header().Get("Link")
+	assert.Contains(t, link, `</products?limit=2&page=1&sort=price>; rel="first"`)
+	assert.Contains(t, link, `</products?limit=2&page=1&sort=price>; rel="prev"`)
+	assert.Contains(t, link, `</products?limit=2&page=3&sort=price>; rel="next"`)
+	assert.Contains(t, link, `</products?limit=2&page=3&sort=price>; rel="last"`)
+	var products []entity.Product
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&products))
+	assert.Len(t, products, 2)
+	assert.Equal(t, int64(300), products[0].PriceMinor)
+
+	w = findAllProducts(h, "/products?limit=2&page=3")
+	assert.NotContains(t, w.Header().Get("Link"), `rel="next"`)
+
+	h.Pagination.DefaultLimit = 3
+	w = findAllProducts(h, "/products")
+	products = nil
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&products))
+	assert.Len(t, products, 3)
+}
+
+func TestFindAllProductsEnvelope(t *testing.T) {
+	h := newProductHandler()
+	for i := 0; i < 3; i++ {
+		product, _ := entity.NewProduct(fmt.Sprintf("Product %d", i), 1000, "USD")
+		assert.Nil(t, h.ProductDB.Create(context.Background(), product))
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/products?limit=2", nil)
+	r.Header.Set("Accept", PageMediaType)
+	w := httptest.NewRecorder()
+	h.FindAllProducts(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, PageMediaType, w.Header().Get("Content-Type"))
+	var page dto.ProductPage
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.Len(t, page.Items, 2)
+	assert.Equal(t, 1, page.Page)
+	assert.Equal(t, 2, page.Limit)
+	assert.Equal(t, int64(3), page.Total)
+	assert.Equal(t, 2, page.TotalPages)
+
+	h.Pagination.Envelope = true
+	w = findAllProducts(h, "/products?page=5")
+	page = dto.ProductPage{}
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&page))
+	assert.Empty(t, page.Items)
+	assert.Equal(t, int64(3), page.Total)
+}
+
+func TestFindAllProductsCursor(t *testing.T) {
+	h := newProductHandler()
+	for i := 0; i < 5; i++ {
+		product, _ := entity.NewProduct(fmt.Sprintf("Product %d", i), 1000, "USD")
+		assert.Nil(t, h.ProductDB.Create(context.Background(), product))
+	}
+
+	var names []string
+	target := "/products?cursor=&limit=2&max_price=20"
+	for pages := 0; ; pages++ {
+		assert.Less(t, pages, 3)
+		w := findAllProducts(h, target)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var page dto.ProductCursorPage
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&page))
+		for _, p := range page.Items {
+			names = append(names, p.Name)
+		}
+		if page.NextCursor == "" {
+			assert.Empty(t, w.Header().Get("Link"))
+			break
+		}
+		assert.Contains(t, w.Header().Get("Link"), `rel="next"`)
+		target = "/products?limit=2&max_price=20&cursor=" + page.NextCursor
+	}
+	assert.Equal(t, []string{"Product 0", "Product 1", "Product 2", "Product 3", "Product 4"}, names)
+}
+
+func TestFindAllProductsCancelled(t *testing.T) {
+	h := newProductHandler()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	h.FindAllProducts(w, httptest.NewRequest(http.MethodGet, "/products", nil).WithContext(ctx))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func productRequest(method, id, body, ifMatch string) *http.Request {
+	r := httptest.NewRequest(method, "/products/"+id, strings.NewReader(body))
+	r.SetPathValue("id", id)
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	return r
+}
+
+func TestGetProductETag(t *testing.T) {
+	h := newProductHandler()
+	p, _ := entity.NewProduct("Product", 1000, "USD")
+	assert.Nil(t, h.ProductDB.Create(context.Background(), p))
+
+	w := httptest.NewRecorder()
+	h.GetProduct(w, productRequest(http.MethodGet, p.ID.String(), "", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	r := productRequest(http.MethodGet, p.ID.String(), "", "")
+	r.Header.Set("If-None-Match", `"0", W/"1"`)
+	w = httptest.NewRecorder()
+	h.GetProduct(w, r)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestUpdateProductPreconditions(t *testing.T) {
+	h := newProductHandler()
+	p, _ := entity.NewProduct("Product", 1000, "USD")
+	assert.Nil(t, h.ProductDB.Create(context.Background(), p))
+	id, body := p.ID.String(), `{"name":"Renamed","price":12}`
+
+	w := httptest.NewRecorder()
+	h.UpdateProduct(w, productRequest(http.MethodPut, id, body, ""))
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+
+	w = httptest.NewRecorder()
+	h.UpdateProduct(w, productRequest(http.MethodPut, id, body, `"1"`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// a second writer holding the old ETag loses
+	w = httptest.NewRecorder()
+	h.UpdateProduct(w, productRequest(http.MethodPut, id, `{"name":"Clobber","price":1}`, `"1"`))
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = httptest.NewRecorder()
+	h.DeleteProduct(w, productRequest(http.MethodDelete, id, "", `"1"`))
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	w = httptest.NewRecorder()
+	h.DeleteProduct(w, productRequest(http.MethodDelete, id, "", ""))
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+
+	w = httptest.NewRecorder()
+	h.DeleteProduct(w, productRequest(http.MethodDelete, id, "", `"2"`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	h.DeleteProduct(w, productRequest(http.MethodDelete, id, "", "*"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func patchRequest(id, contentType, body string) *http.Request {
+	r := productRequest(http.MethodPatch, id, body, "*")
+	r.Header.Set("Content-Type", contentType)
+	return r
+}
+
+func TestPatchProduct(t *testing.T) {
+	h := newProductHandler()
+	p, _ := entity.NewProduct("Product", 1000, "USD")
+	assert.Nil(t, h.ProductDB.Create(context.Background(), p))
+	id := p.ID.String()
+
+	w := httptest.NewRecorder()
+	h.PatchProduct(w, patchRequest(id, MergePatchContentType, `{"price":12.5}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var patched entity.Product
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&patched))
+	assert.Equal(t, "Product", patched.Name)
+	assert.Equal(t, int64(1250), patched.PriceMinor)
+
+	w = httptest.NewRecorder()
+	h.PatchProduct(w, patchRequest(id, JSONPatchContentType,
+		`[{"op":"test","path":"/version","value":2},{"op":"replace","path":"/name","value":"Renamed"}]`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	stored, err := h.ProductDB.FindByID(context.Background(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, "Renamed", stored.Name)
+	assert.Equal(t, int64(1250), stored.PriceMinor)
+	assert.Equal(t, int64(3), stored.Version)
+}
+
+func TestPatchProductRejected(t *testing.T) {
+	h := newProductHandler()
+	p, _ := entity.NewProduct("Product", 1000, "USD")
+	assert.Nil(t, h.ProductDB.Create(context.Background(), p))
+	id := p.ID.String()
+
+	for _, c := range []struct {
+		contentType, body string
+		status            int
+	}{
+		{"application/json", `{"price":1}`, http.StatusUnsupportedMediaType},
+		{MergePatchContentType, `{"price":-1}`, http.StatusBadRequest},
+		{MergePatchContentType, `{"name":null}`, http.StatusBadRequest},
+		{MergePatchContentType, `{"version":7}`, http.StatusBadRequest},
+		{MergePatchContentType, `{"color":"red"}`, http.StatusBadRequest},
+		{MergePatchContentType, `{"price":"cheap"}`, http.StatusBadRequest},
+		{MergePatchContentType, `{"price":"1.001"}`, http.StatusBadRequest},
+		{MergePatchContentType, `{"currency":"JPY"}`, http.StatusBadRequest},
+		{JSONPatchContentType, `[{"op":"replace","path":"/id","value":"x"}]`, http.StatusBadRequest},
+		{JSONPatchContentType, `[{"op":"test","path":"/name","value":"Other"}]`, http.StatusConflict},
+		{JSONPatchContentType, `[{"op":"remove","path":"/sku"}]`, http.StatusUnprocessableEntity},
+		{MergePatchContentType, `{"stock":5}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		h.PatchProduct(w, patchRequest(id, c.contentType, c.body))
+		assert.Equal(t, c.status, w.Code, c.body)
+	}
+
+	r := productRequest(http.MethodPatch, id, `{"price":1}`, `"9"`)
+	r.Header.Set("Content-Type", MergePatchContentType)
+	w := httptest.NewRecorder()
+	h.PatchProduct(w, r)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	stored, err := h.ProductDB.FindByID(context.Background(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), stored.Version)
+}
+
+func TestUpdateProductValidates(t *testing.T) {
+	h := newProductHandler()
+	p, _ := entity.NewProduct("Product", 1000, "USD")
+	assert.Nil(t, h.ProductDB.Create(context.Background(), p))
+	id := p.ID.String()
+
+	for body, field := range map[string]string{
+		`{"name":"Renamed"}`: "price",
+		`{"price":5}`:        "name",
+		`{"id":"` + pkgentity.NewId().String() + `","name":"A","price":1}`: "id",
+	} {
+		w := httptest.NewRecorder()
+		h.UpdateProduct(w, productRequest(http.MethodPut, id, body, "*"))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		var problem Error
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, field, problem.Errors[0].Field, body)
+	}
+}
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	h := newProductHandler()
+	p, _ := entity.NewProduct("Product", 1000, "USD")
+	assert.Nil(t, h.ProductDB.Create(context.Background(), p))
+	id := p.ID.String()
+
+	w := httptest.NewRecorder()
+	h.DeleteProduct(w, productRequest(http.MethodDelete, id, "", `"1"`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	h.GetProduct(w, productRequest(http.MethodGet, id, "", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	h.FindTrash(w, httptest.NewRequest(http.MethodGet, "/products/trash", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var products []entity.Product
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&products))
+	assert.Len(t, products, 1)
+	assert.True(t, products[0].DeletedAt.Valid)
+
+	w = httptest.NewRecorder()
+	h.RestoreProduct(w, productRequest(http.MethodPost, id, "", ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	h.PurgeProduct(w, productRequest(http.MethodDelete, id, "", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code, "only trashed products can be purged")
+
+	w = httptest.NewRecorder()
+	h.DeleteProduct(w, productRequest(http.MethodDelete, id, "", `"2"`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	h.PurgeProduct(w, productRequest(http.MethodDelete, id, "", ""))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	h.RestoreProduct(w, productRequest(http.MethodPost, id, "", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/antoniofmoliveira/apis/pkg/money"
+)
+
+const (
+	// MaxImportErrors bounds the row errors listed in an import report;
+	// Failed still counts every rejected row.
+	MaxImportErrors = 100
+	// MaxNDJSONLine is the longest NDJSON line accepted by an import.
+	MaxNDJSONLine = 1 << 20
+
+	exportBatchSize = 500
+)
+
+var (
+	ErrMissingColumn = errors.New("missing required column")
+	ErrInvalidFormat = errors.New("format must be csv or ndjson")
+)
+
+// productCSVHeader lists the columns written by ExportProducts. Imports only
+// read name, price and currency, so an export can be edited and imported.
+var productCSVHeader = []string{"id", "name", "price", "currency", "stock", "reserved", "created_at", "version"}
+
+// importRow is one parsed line of an import file. err is set when the line
+// could not be parsed.
+type importRow struct {
+	line  int
+	input dto.CreateProductInput
+	err   error
+}
+
+// @Summary      Import products
+// @Description  Create products from a CSV or NDJSON body, read and validated row by row. CSV needs a header row with name and price columns and may have currency; other columns are ignored, so an export can be imported. A name starting with an apostrophe followed by =, +, -, @ or another apostrophe loses the first apostrophe, undoing the export's formula escaping. NDJSON has one dto.CreateProductInput object per line.
+// @Description  Invalid rows are reported by line and skipped; the valid rows are created. With dry_run=true nothing is written and the report tells what would be imported. At most 100 row errors are listed.
+// @Tags         products
+// @Accept       text/csv
+// @Accept       application/x-ndjson
+// @Produce      json
+// @Param        dry_run  query     bool  false  "Validate without creating products"
+// @Success      200  {object}  dto.ImportResult
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      415  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /products/import [post]
+// @Security     ApiKeyAuth
+func (h *ProductHandler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	for key := range values {
+		if key != "dry_run" {
+			WriteError(w, r, &InvalidFieldError{Field: key, Err: ErrUnknownParameter})
+			return
+		}
+	}
+	result := dto.ImportResult{Errors: []dto.ImportError{}}
+	if s := values.Get("dry_run"); s != "" {
+		dryRun, err := strconv.ParseBool(s)
+		if err != nil {
+			WriteError(w, r, &InvalidFieldError{Field: "dry_run", Err: errors.New("must be true or false")})
+			return
+		}
+		result.DryRun = dryRun
+	}
+
+	var read func(io.Reader, func(importRow) error) error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case CSVContentType:
+		read = readCSVRows
+	case NDJSONContentType:
+		read = readNDJSONRows
+	default:
+		WriteError(w, r, ErrUnsupportedMediaType)
+		return
+	}
+
+	err := read(r.Body, func(row importRow) error {
+		result.Rows++
+		if row.err == nil {
+			row.err = h.importProduct(r, row.input, result.DryRun)
+		}
+		if row.err == nil {
+			result.Imported++
+			return nil
+		}
+		if errorStatus(row.err) >= http.StatusInternalServerError {
+			return row.err
+		}
+		result.Failed++
+		if len(result.Errors) < MaxImportErrors {
+			importErr := dto.ImportError{Line: row.line, Message: row.err.Error()}
+			if p := problemFor(row.err); len(p.Errors) > 0 {
+				importErr.Field = p.Errors[0].Field
+			}
+			result.Errors = append(result.Errors, importErr)
+		}
+		return nil
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// importProduct validates input like CreateProduct and, unless dryRun is
+// set, stores it.
+func (h *ProductHandler) importProduct(r *http.Request, input dto.CreateProductInput, dryRun bool) error {
+	if input.Currency == "" {
+		input.Currency = h.Currency
+	}
+	price, err := entity.ParsePrice(input.Price, input.Currency)
+	if err != nil {
+		return err
+	}
+	p, err := entity.NewProduct(input.Name, price, input.Currency)
+	if err != nil || dryRun {
+		return err
+	}
+	if err := h.ProductDB.Create(r.Context(), p); err != nil {
+		return err
+	}
+	h.Audit.Record(r, entity.AuditCreate, AuditEntityProduct, p.ID.String(), nil, p)
+	return nil
+}
+
+// readCSVRows calls fn for each record after the header. Malformed records
+// are passed on with err set; only read failures stop the scan.
+func readCSVRows(body io.Reader, fn func(importRow) error) error {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return &InvalidFieldError{Field: "name", Err: ErrMissingColumn}
+	}
+	if err != nil {
+		return &InvalidFieldError{Field: "header", Err: err}
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return &InvalidFieldError{Field: required, Err: ErrMissingColumn}
+		}
+	}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			if err := fn(importRow{line: parseErr.StartLine, err: fmt.Errorf("%w: %v", ErrInvalidBody, parseErr.Err)}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBody, err)
+		}
+		line, _ := reader.FieldPos(0)
+		row := importRow{line: line, input: dto.CreateProductInput{
+			Name:  unescapeCSVText(record[columns["name"]]),
+			Price: money.Decimal(record[columns["price"]]),
+		}}
+		if i, ok := columns["currency"]; ok {
+			row.input.Currency = strings.TrimSpace(record[i])
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// readNDJSONRows calls fn for each non-blank line. Lines that are not a JSON
+// object are passed on with err set.
+func readNDJSONRows(body io.Reader, fn func(importRow) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxNDJSONLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		row := importRow{line: line}
+		if err := json.Unmarshal(data, &row.input); err != nil {
+			row.err = fmt.Errorf("%w: %v", ErrInvalidBody, err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: line %d: %v", ErrInvalidBody, line+1, err)
+	}
+	return nil
+}
+
+// @Summary      Export products
+// @Description  Stream every product that is not deleted, in creation order, as CSV (the default) or NDJSON. The catalog is read in batches, so exports of any size use constant memory. CSV columns are id, name, price, currency, stock, reserved, created_at and version, and names starting with =, +, -, @ or an apostrophe get a leading apostrophe so spreadsheets show them as text instead of running them as formulas; NDJSON has one product object per line.
+// @Tags         products
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Param        format  query     string  false  "csv or ndjson"  Enums(csv, ndjson)
+// @Success      200  {file}  file
+// @Failure      400  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /products/export [get]
+// @Security     ApiKeyAuth
+func (h *ProductHandler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	for key := range values {
+		if key != "format" {
+			WriteError(w, r, &InvalidFieldError{Field: key, Err: ErrUnknownParameter})
+			return
+		}
+	}
+	var write func(io.Writer, []entity.Product) error
+	var contentType, extension string
+	switch values.Get("format") {
+	case "", "csv":
+		write, contentType, extension = csvProductWriter(), CSVContentType, "csv"
+	case "ndjson":
+		write, contentType, extension = writeNDJSONProducts, NDJSONContentType, "ndjson"
+	default:
+		WriteError(w, r, &InvalidFieldError{Field: "format", Err: ErrInvalidFormat})
+		return
+	}
+
+	// Fetch the first batch before writing headers so that a failing query
+	// still gets a problem response.
+	products, err := h.ProductDB.SearchAfter(r.Context(), database.ProductFilter{}, nil, exportBatchSize)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="products.`+extension+`"`)
+	rc := http.NewResponseController(w)
+	for {
+		if err := write(w, products); err != nil {
+			panic(http.ErrAbortHandler)
+		}
+		rc.Flush()
+		if len(products) < exportBatchSize {
+			return
+		}
+		after := database.CursorFor(products[len(products)-1])
+		products, err = h.ProductDB.SearchAfter(r.Context(), database.ProductFilter{}, &after, exportBatchSize)
+		if err != nil {
+			// The status line is gone; abort so the client sees a
+			// truncated download rather than a complete-looking one.
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// csvFormulaPrefixes start cells that spreadsheets run as formulas.
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// escapeCSVText quotes text that a spreadsheet would run as a formula with
+// a leading apostrophe, which spreadsheets hide. Text that already starts
+// with an apostrophe gets another so unescapeCSVText can undo it.
+func escapeCSVText(s string) string {
+	if s != "" && strings.ContainsRune(csvFormulaPrefixes+"'", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// unescapeCSVText drops the apostrophe escapeCSVText adds, leaving other
+// text as written.
+func unescapeCSVText(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes+"'", rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
+
+// csvProductWriter returns a batch writer that starts with the header row.
+func csvProductWriter() func(io.Writer, []entity.Product) error {
+	headerWritten := false
+	return func(w io.Writer, products []entity.Product) error {
+		cw := csv.NewWriter(w)
+		if !headerWritten {
+			cw.Write(productCSVHeader)
+			headerWritten = true
+		}
+		for _, p := range products {
+			cw.Write([]string{
+				p.ID.String(),
+				escapeCSVText(p.Name),
+				string(p.Price()),
+				p.Currency,
+				strconv.FormatInt(p.Stock, 10),
+				strconv.FormatInt(p.Reserved, 10),
+				p.CreatedAt.UTC().Format(time.RFC3339Nano),
+				strconv.FormatInt(p.Version, 10),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+}
+
+func writeNDJSONProducts(w io.Writer, products []entity.Product) error {
+	enc := json.NewEncoder(w)
+	for _, p := range products {
+		if err := enc.Encode(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
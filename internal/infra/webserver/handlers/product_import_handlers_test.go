@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func importRequest(target, contentType, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	return r
+}
+
+func decodeImportResult(t *testing.T, w *httptest.ResponseRecorder) dto.ImportResult {
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result dto.ImportResult
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&result))
+	return result
+}
+
+func TestImportProductsCSV(t *testing.T) {
+	h := newProductHandler()
+	body := "\ufeffName,Price,Currency,stock\n" +
+		"Pen,1.50,,3\n" +
+		"Yen pen,150,JPY,0\n" +
+		",2.00,USD,0\n" +
+		"Cheap,1.234,USD,0\n" +
+		"Short,1.00\n"
+
+	w := httptest.NewRecorder()
+	h.ImportProducts(w, importRequest("/products/import?dry_run=true", "text/csv; charset=utf-8", body))
+	result := decodeImportResult(t, w)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 5, result.Rows)
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, 3, result.Failed)
+	assert.Equal(t, []dto.ImportError{
+		{Line: 4, Field: "name", Message: entity.ErrNameIsRequired.Error()},
+		{Line: 5, Field: "price", Message: result.Errors[1].Message},
+		{Line: 6, Message: result.Errors[2].Message},
+	}, result.Errors)
+	total, _ := h.ProductDB.Count(context.Background(), database.ProductFilter{})
+	assert.Equal(t, int64(0), total)
+
+	w = httptest.NewRecorder()
+	h.ImportProducts(w, importRequest("/products/import", "text/csv", body))
+	result = decodeImportResult(t, w)
+	assert.False(t, result.DryRun)
+	assert.Equal(t, 2, result.Imported)
+	products, _ := h.ProductDB.Search(context.Background(), database.ProductQuery{Page: 1, Limit: 10, Sort: []database.SortField{{Field: "name"}}})
+	assert.Len(t, products, 2)
+	assert.Equal(t, "Pen", products[0].Name)
+	assert.Equal(t, int64(150), products[0].PriceMinor)
+	assert.Equal(t, "USD", products[0].Currency)
+	assert.Equal(t, "JPY", products[1].Currency)
+
+	w = httptest.NewRecorder()
+	h.ImportProducts(w, importRequest("/products/import", "text/csv", "title,price\nPen,1\n"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var problem Error
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&problem))
+	assert.Equal(t, "name", problem.Errors[0].Field)
+}
+
+func TestImportProductsNDJSON(t *testing.T) {
+	h := newProductHandler()
+	body := `{"name":"Pen","price":"1.50"}` + "\n\n" +
+		`{"name":"Pad","price":2.25,"currency":"EUR"}` + "\n" +
+		`{"name":"Bad"` + "\n" +
+		`{"name":"Free","price":"0"}` + "\n"
+
+	w := httptest.NewRecorder()
+	h.ImportProducts(w, importRequest("/products/import", "application/x-ndjson", body))
+	result := decodeImportResult(t, w)
+	assert.Equal(t, 4, result.Rows)
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, 2, result.Failed)
+	assert.Equal(t, 4, result.Errors[0].Line)
+	assert.Equal(t, 5, result.Errors[1].Line)
+	assert.Equal(t, "price", result.Errors[1].Field)
+
+	w = httptest.NewRecorder()
+	h.ImportProducts(w, importRequest("/products/import", "application/json", body))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ImportProducts(w, importRequest("/products/import?dryrun=1", "application/x-ndjson", body))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestImportErrorsAreCapped(t *testing.T) {
+	h := newProductHandler()
+	var body strings.Builder
+	body.WriteString("name,price\n")
+	for i := 0; i < MaxImportErrors+5; i++ {
+		body.WriteString(",1\n")
+	}
+	w := httptest.NewRecorder()
+	h.ImportProducts(w, importRequest("/products/import?dry_run=1", "text/csv", body.String()))
+	result := decodeImportResult(t, w)
+	assert.Equal(t, MaxImportErrors+5, result.Failed)
+	assert.Len(t, result.Errors, MaxImportErrors)
+}
+
+func TestExportProducts(t *testing.T) {
+	h := newProductHandler()
+	for i := 0; i < exportBatchSize+2; i++ {
+		p, _ := entity.NewProduct(fmt.Sprintf("Product %d", i), int64(100+i), "USD")
+		h.ProductDB.Create(context.Background(), p)
+	}
+
+	w := httptest.NewRecorder()
+	h.ExportProducts(w, httptest.NewRequest(http.MethodGet, "/products/export", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, CSVContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "products.csv")
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, records, exportBatchSize+3)
+	assert.Equal(t, productCSVHeader, records[0])
+	assert.Equal(t, []string{"Product 0", "1.00", "USD", "0", "0"}, findRecord(records, "Product 0")[1:6])
+
+	// An export can be imported again as is.
+	var export strings.Builder
+	csv.NewWriter(&export).WriteAll(records[:3])
+	w = httptest.NewRecorder()
+	h.ImportProducts(w, importRequest("/products/import?dry_run=true", "text/csv", export.String()))
+	assert.Equal(t, 2, decodeImportResult(t, w).Imported)
+
+	w = httptest.NewRecorder()
+	h.ExportProducts(w, httptest.NewRequest(http.MethodGet, "/products/export?format=ndjson", nil))
+	assert.Equal(t, NDJSONContentType, w.Header().Get("Content-Type"))
+	lines := 0
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var p entity.Product
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &p))
+		lines++
+	}
+	assert.Equal(t, exportBatchSize+2, lines)
+
+	w = httptest.NewRecorder()
+	h.ExportProducts(w, httptest.NewRequest(http.MethodGet, "/products/export?format=xml", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExportEscapesFormulas(t *testing.T) {
+	h := newProductHandler()
+	names := map[string]string{
+		"=HYPERLINK(\"http://x\")": "'=HYPERLINK(\"http://x\")",
+		"+1 pack":                  "'+1 pack",
+		"-5% off":                  "'-5% off",
+		"@home":                    "'@home",
+		"'quoted":                  "''quoted",
+		"Plain":                    "Plain",
+	}
+	for name := range names {
+		p, _ := entity.NewProduct(name, 100, "USD")
+		h.ProductDB.Create(context.Background(), p)
+	}
+
+	w := httptest.NewRecorder()
+	h.ExportProducts(w, httptest.NewRequest(http.MethodGet, "/products/export", nil))
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	assert.Nil(t, err)
+	for name, cell := range names {
+		assert.NotNil(t, findRecord(records, cell), name)
+	}
+
+	// Importing the export restores the names.
+	imported := newProductHandler()
+	w2 := httptest.NewRecorder()
+	imported.ImportProducts(w2, importRequest("/products/import", "text/csv", w.Body.String()))
+	assert.Equal(t, len(names), decodeImportResult(t, w2).Imported)
+	products, _ := imported.ProductDB.Search(context.Background(), database.ProductQuery{Page: 1, Limit: 10})
+	for _, p := range products {
+		assert.Contains(t, names, p.Name)
+	}
+	assert.Len(t, products, len(names))
+}
+
+func findRecord(records [][]string, name string) []string {
+	for _, record := range records {
+		if record[1] == name {
+			return record
+		}
+	}
+	return nil
+}
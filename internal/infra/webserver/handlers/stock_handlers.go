@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
+)
+
+// MaxReservationTTL bounds the expires_in a client may ask for, so a
+// forgotten reservation cannot hold stock indefinitely.
+const MaxReservationTTL = 24 * time.Hour
+
+var ErrInvalidExpiresIn = errors.New("expires_in must be between 1 second and 24 hours")
+
+type StockHandler struct {
+	StockDB   database.StockRepositoryInterface
+	ProductDB database.ProductRepositoryInterface
+	// ReservationTTL is used when a reservation request has no expires_in.
+	ReservationTTL time.Duration
+	Audit          *Auditor
+}
+
+func NewStockHandler(stock database.StockRepositoryInterface, products database.ProductRepositoryInterface, reservationTTL time.Duration, audit *Auditor) *StockHandler {
+	return &StockHandler{StockDB: stock, ProductDB: products, ReservationTTL: reservationTTL, Audit: audit}
+}
+
+// @Summary      Adjust product stock
+// @Description  Add to or remove from the quantity on hand. reason is one of received, returned, damaged, lost or correction. Stock cannot drop below the reserved quantity.
+// @Tags         stock
+// @Accept       json
+// @Produce      json
+// @Param        id  path      string  true  "Product ID"
+// @Param        input  body      dto.AdjustStockInput  true  "adjustment"
+// @Param        Idempotency-Key  header    string  false  "Unique key; retries with it replay the first response"
+// @Success      200  {object}  entity.Product
+// @Header       200  {string}  ETag  "New product version"
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      409  {object}  Error  "Not enough unreserved stock"
+// @Failure      422  {object}  Error  "Idempotency-Key reused with a different request"
+// @Failure      500  {object}  Error
+// @Router       /products/{id}/stock/adjust [post]
+// @Security     ApiKeyAuth
+func (h *StockHandler) AdjustStock(w http.ResponseWriter, r *http.Request) {
+	productID, err := pkgentity.ParseId(r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, entity.ErrInvalidID)
+		return
+	}
+	var input dto.AdjustStockInput
+	if err := decodeJSON(r, &input); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	movement, err := entity.NewStockAdjustment(productID, input.Delta, input.Reason, input.Note)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	before, err := h.ProductDB.FindByID(r.Context(), productID.String())
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if err := h.StockDB.Adjust(r.Context(), movement); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	after, err := h.ProductDB.FindByID(r.Context(), productID.String())
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.Audit.Record(r, entity.AuditAdjustStock, AuditEntityProduct, productID.String(), before, after)
+	w.Header().Set("ETag", versionETag(after.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(after)
+}
+
+// @Summary      Reserve product stock
+// @Description  Hold quantity units for an order until the reservation is committed, released or expires. Expired reservations give their units back.
+// @Tags         stock
+// @Accept       json
+// @Produce      json
+// @Param        id  path      string  true  "Product ID"
+// @Param        input  body      dto.ReserveStockInput  true  "reservation"
+// @Param        Idempotency-Key  header    string  false  "Unique key; retries with it replay the first response"
+// @Success      201  {object}  entity.Reservation
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      409  {object}  Error  "Not enough available stock"
+// @Failure      422  {object}  Error  "Idempotency-Key reused with a different request"
+// @Failure      500  {object}  Error
+// @Router       /products/{id}/reservations [post]
+// @Security     ApiKeyAuth
+func (h *StockHandler) ReserveStock(w http.ResponseWriter, r *http.Request) {
+	productID, err := pkgentity.ParseId(r.PathValue("id"))
+	if err != nil {
+		WriteError(w, r, entity.ErrInvalidID)
+		return
+	}
+	var input dto.ReserveStockInput
+	if err := decodeJSON(r, &input); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	ttl := h.ReservationTTL
+	if input.ExpiresIn != 0 {
+		ttl = time.Duration(input.ExpiresIn) * time.Second
+		if ttl < time.Second || ttl > MaxReservationTTL {
+			WriteError(w, r, &InvalidFieldError{Field: "expires_in", Err: ErrInvalidExpiresIn})
+			return
+		}
+	}
+	reservation, err := entity.NewReservation(productID, input.Quantity, ttl)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	err = h.StockDB.Reserve(r.Context(), reservation)
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Product not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.Audit.Record(r, entity.AuditReserve, AuditEntityReservation, reservation.ID.String(), nil, reservation)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reservation)
+}
+
+// @Summary      Get reservation by ID
+// @Description  Get a stock reservation. A pending reservation past expires_at no longer holds stock.
+// @Tags         stock
+// @Produce      json
+// @Param        id  path      string  true  "Reservation ID"
+// @Success      200  {object}  entity.Reservation
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /reservations/{id} [get]
+// @Security     ApiKeyAuth
+func (h *StockHandler) GetReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, err := h.StockDB.FindReservation(r.Context(), r.PathValue("id"))
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Reservation not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reservation)
+}
+
+// @Summary      Commit reservation
+// @Description  Complete a pending reservation: its units leave the stock and a sold movement is recorded.
+// @Tags         stock
+// @Produce      json
+// @Param        id  path      string  true  "Reservation ID"
+// @Success      200  {object}  entity.Reservation
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      409  {object}  Error  "Reservation is not pending or has expired"
+// @Failure      500  {object}  Error
+// @Router       /reservations/{id}/commit [post]
+// @Security     ApiKeyAuth
+func (h *StockHandler) CommitReservation(w http.ResponseWriter, r *http.Request) {
+	h.closeReservation(w, r, h.StockDB.Commit, entity.AuditCommit)
+}
+
+// @Summary      Release reservation
+// @Description  Cancel a pending reservation and return its units to the available stock.
+// @Tags         stock
+// @Produce      json
+// @Param        id  path      string  true  "Reservation ID"
+// @Success      200  {object}  entity.Reservation
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      409  {object}  Error  "Reservation is not pending"
+// @Failure      500  {object}  Error
+// @Router       /reservations/{id}/release [post]
+// @Security     ApiKeyAuth
+func (h *StockHandler) ReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	h.closeReservation(w, r, h.StockDB.Release, entity.AuditRelease)
+}
+
+// closeReservation runs a commit or release and records it as action.
+func (h *StockHandler) closeReservation(w http.ResponseWriter, r *http.Request, finish func(ctx context.Context, id string) (*entity.Reservation, error), action string) {
+	id := r.PathValue("id")
+	reservation, err := finish(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "Reservation not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.Audit.Record(r, action, AuditEntityReservation, id, nil, reservation)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reservation)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newStockHandler() (*StockHandler, *entity.Product) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	db.AutoMigrate(&entity.Product{}, &entity.StockMovement{}, &entity.Reservation{}, &entity.AuditEntry{})
+	products := database.NewProductRepository(db)
+	p, _ := entity.NewProduct("Product", 1000, "USD")
+	products.Create(context.Background(), p)
+	return NewStockHandler(database.NewStockRepository(db), products, 15*time.Minute, NewAuditor(database.NewAuditRepository(db))), p
+}
+
+func stockRequest(method, id, body string) *http.Request {
+	r := httptest.NewRequest(method, "/", strings.NewReader(body))
+	r.SetPathValue("id", id)
+	return r
+}
+
+func TestAdjustStockHandler(t *testing.T) {
+	h, p := newStockHandler()
+	id := p.ID.String()
+
+	w := httptest.NewRecorder()
+	h.AdjustStock(w, stockRequest(http.MethodPost, id, `{"delta":5,"reason":"received","note":"PO-1"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var product entity.Product
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&product))
+	assert.Equal(t, int64(5), product.Stock)
+
+	w = httptest.NewRecorder()
+	h.AdjustStock(w, stockRequest(http.MethodPost, id, `{"delta":-6,"reason":"lost"}`))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	for body, field := range map[string]string{
+		`{"delta":0,"reason":"received"}`: "delta",
+		`{"delta":1,"reason":"sold"}`:     "reason",
+		`{"delta":1}`:                     "reason",
+	} {
+		w := httptest.NewRecorder()
+		h.AdjustStock(w, stockRequest(http.MethodPost, id, body))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		var problem Error
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, field, problem.Errors[0].Field, body)
+	}
+
+	w = httptest.NewRecorder()
+	h.AdjustStock(w, stockRequest(http.MethodPost, "00000000-0000-0000-0000-000000000009", `{"delta":1,"reason":"received"}`))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestReservationHandlers(t *testing.T) {
+	h, p := newStockHandler()
+	id := p.ID.String()
+	w := httptest.NewRecorder()
+	h.AdjustStock(w, stockRequest(http.MethodPost, id, `{"delta":3,"reason":"received"}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ReserveStock(w, stockRequest(http.MethodPost, id, `{"quantity":2,"expires_in":60}`))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var reservation entity.Reservation
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&reservation))
+	assert.Equal(t, entity.ReservationPending, reservation.Status)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), reservation.ExpiresAt, 5*time.Second)
+
+	w = httptest.NewRecorder()
+	h.ReserveStock(w, stockRequest(http.MethodPost, id, `{"quantity":2}`))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	for body, field := range map[string]string{
+		`{"quantity":0}`:                     "quantity",
+		`{"quantity":1,"expires_in":-1}`:     "expires_in",
+		`{"quantity":1,"expires_in":864000}`: "expires_in",
+	} {
+		w := httptest.NewRecorder()
+		h.ReserveStock(w, stockRequest(http.MethodPost, id, body))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		var problem Error
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&problem))
+		assert.Equal(t, field, problem.Errors[0].Field, body)
+	}
+
+	rid := reservation.ID.String()
+	w = httptest.NewRecorder()
+	h.CommitReservation(w, stockRequest(http.MethodPost, rid, ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	h.ReleaseReservation(w, stockRequest(http.MethodPost, rid, ""))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	h.GetReservation(w, stockRequest(http.MethodGet, rid, ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&reservation))
+	assert.Equal(t, entity.ReservationCommitted, reservation.Status)
+
+	w = httptest.NewRecorder()
+	h.CommitReservation(w, stockRequest(http.MethodPost, "missing", ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	product, err := h.ProductDB.FindByID(context.Background(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), product.Stock)
+	assert.Equal(t, int64(0), product.Reserved)
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+)
+
+// @Summary      Get user by ID
+// @Description  Get user by ID
+// @Tags         users
+// @Produce      json
+// @Param        id  path      string  true  "User ID"
+// @Success      200  {object}  entity.User
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /users/{id} [get]
+// @Security     ApiKeyAuth
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	h.writeUser(w, r, r.PathValue("id"))
+}
+
+// @Summary      Get the signed-in user
+// @Description  Get the user the access token was issued to
+// @Tags         users
+// @Produce      json
+// @Success      200  {object}  entity.User
+// @Failure      401  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /users/me [get]
+// @Security     ApiKeyAuth
+func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	h.writeUser(w, r, callerSubject(r))
+}
+
+func (h *UserHandler) writeUser(w http.ResponseWriter, r *http.Request, id string) {
+	user, err := h.UserDB.FindByID(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "User not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// @Summary      Replace user by ID
+// @Description  Replace the name, email and roles of a user. Roles default to viewer when empty. The last admin cannot lose the admin role.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id     path      string               true  "User ID"
+// @Param        input  body      dto.UpdateUserInput  true  "user request"
+// @Success      200  {object}  entity.User
+// @Failure      400  {object}  Error
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      409  {object}  Error  "Email taken, or the last admin would be demoted"
+// @Failure      500  {object}  Error
+// @Router       /users/{id} [put]
+// @Security     ApiKeyAuth
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	var input dto.UpdateUserInput
+	if err := decodeJSON(r, &input); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	before, err := h.UserDB.FindByID(r.Context(), r.PathValue("id"))
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "User not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	user := *before
+	user.Name, user.Email = input.Name, input.Email
+	if err := user.Validate(); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if err := user.SetRoles(input.Roles...); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	err = h.UnitOfWork.Do(r.Context(), func(repos database.Repositories) error {
+		if !user.Roles.Has(entity.RoleAdmin) {
+			if err := keepAdmin(r.Context(), repos.Users, before); err != nil {
+				return err
+			}
+		}
+		rows, err := repos.Users.Update(r.Context(), &user)
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return database.ErrNotFound
+		}
+		h.Audit.With(repos.Audit).Record(r, entity.AuditUpdate, AuditEntityUser, user.ID.String(), before, &user)
+		return nil
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "User not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// @Summary      Delete user by ID
+// @Description  Delete a user. The last admin cannot be deleted.
+// @Tags         users
+// @Param        id  path      string  true  "User ID"
+// @Success      204
+// @Failure      403  {object}  Error
+// @Failure      404  {object}  Error
+// @Failure      409  {object}  Error  "The last admin would be deleted"
+// @Failure      500  {object}  Error
+// @Router       /users/{id} [delete]
+// @Security     ApiKeyAuth
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	before, err := h.UserDB.FindByID(r.Context(), id)
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "User not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	err = h.UnitOfWork.Do(r.Context(), func(repos database.Repositories) error {
+		if err := keepAdmin(r.Context(), repos.Users, before); err != nil {
+			return err
+		}
+		rows, err := repos.Users.Delete(r.Context(), id)
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return database.ErrNotFound
+		}
+		// the deleted user's refresh tokens can no longer be used
+		if _, err := repos.RefreshTokens.RevokeUser(r.Context(), id); err != nil {
+			return err
+		}
+		h.Audit.With(repos.Audit).Record(r, entity.AuditDelete, AuditEntityUser, id, before, nil)
+		return nil
+	})
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "User not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary      Change the signed-in user's password
+// @Description  Replace the password of the signed-in user after checking the current one. A wrong current password is a validation error on current_password, not 401, so clients do not mistake it for an expired session. Every refresh token of the user is revoked, so other sessions must log in again; access tokens stay valid until they expire.
+// @Tags         users
+// @Accept       json
+// @Param        input  body      dto.ChangePasswordInput  true  "passwords"
+// @Success      204
+// @Failure      400  {object}  Error  "Wrong current password, or invalid new password"
+// @Failure      401  {object}  Error  "Missing or invalid access token"
+// @Failure      404  {object}  Error
+// @Failure      429  {object}  Error
+// @Failure      500  {object}  Error
+// @Router       /users/me/password [post]
+// @Security     ApiKeyAuth
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var input dto.ChangePasswordInput
+	if err := decodeJSON(r, &input); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	user, err := h.UserDB.FindByID(r.Context(), callerSubject(r))
+	if errors.Is(err, database.ErrNotFound) {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "User not found"))
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if !user.ValidatePassword(input.CurrentPassword) {
+		WriteError(w, r, ErrIncorrectPassword)
+		return
+	}
+	if err := user.SetPassword(input.NewPassword); err != nil {
+		WriteError(w, r, &InvalidFieldError{Field: "new_password", Err: err})
+		return
+	}
+	rows, err := h.UserDB.UpdatePassword(r.Context(), user.ID.String(), user.Password)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if rows == 0 {
+		WriteProblem(w, r, NewProblem(http.StatusNotFound, "User not found"))
+		return
+	}
+	// sign out every session, which may include whoever learned the old password
+	if _, err := h.RefreshTokenDB.RevokeUser(context.WithoutCancel(r.Context()), user.ID.String()); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.Audit.Record(r, entity.AuditChangePassword, AuditEntityUser, user.ID.String(), nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// keepAdmin fails with ErrLastAdmin when user is the only admin left, so
+// demoting or deleting them would lock everyone out of admin endpoints. Run
+// it in the transaction that demotes or deletes user: the count locks the
+// admins until it ends, so two requests cannot remove the last two at once.
+func keepAdmin(ctx context.Context, users database.UserRepositoryInterface, user *entity.User) error {
+	if !user.Roles.Has(entity.RoleAdmin) {
+		return nil
+	}
+	admins, err := users.CountByRole(ctx, entity.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
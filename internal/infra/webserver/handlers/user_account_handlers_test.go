@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+)
+
+// asUser attaches a verified token for user to r, as jwtauth.Verifier would.
+func asUser(r *http.Request, user *entity.User) *http.Request {
+	auth := jwtauth.New("HS256", []byte("secret"), nil)
+	_, tokenString, _ := auth.Encode(map[string]interface{}{"sub": user.ID.String(), RolesClaim: []string(user.Roles)})
+	token, err := jwtauth.VerifyToken(auth, tokenString)
+	return r.WithContext(jwtauth.NewContext(r.Context(), token, err))
+}
+
+func userRequest(method, id string, body any) *http.Request {
+	var b []byte
+	if body != nil {
+		b, _ = json.Marshal(body)
+	}
+	r := httptest.NewRequest(method, "/users/"+id, bytes.NewReader(b))
+	r.SetPathValue("id", id)
+	return r
+}
+
+func TestGetUser(t *testing.T) {
+	h := newUserHandler()
+	user, _ := h.UserDB.FindByEmail(context.Background(), "j@j.com")
+
+	w := httptest.NewRecorder()
+	h.GetUser(w, userRequest(http.MethodGet, user.ID.String(), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var found map[string]any
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&found))
+	assert.Equal(t, "j@j.com", found["email"])
+	assert.NotContains(t, found, "password")
+
+	w = httptest.NewRecorder()
+	h.GetMe(w, asUser(userRequest(http.MethodGet, "me", nil), user))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), user.ID.String())
+
+	w = httptest.NewRecorder()
+	h.GetUser(w, userRequest(http.MethodGet, "00000000-0000-0000-0000-000000000009", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestUpdateUser(t *testing.T) {
+	h := newUserHandler()
+	ctx := context.Background()
+	user, _ := h.UserDB.FindByEmail(ctx, "j@j.com")
+	id := user.ID.String()
+
+	w := httptest.NewRecorder()
+	h.UpdateUser(w, userRequest(http.MethodPut, id, dto.UpdateUserInput{Name: "Johnny", Email: "johnny@j.com", Roles: []string{entity.RoleAdmin}}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	found, _ := h.UserDB.FindByID(ctx, id)
+	assert.Equal(t, "Johnny", found.Name)
+	assert.Equal(t, "johnny@j.com", found.Email)
+	assert.Equal(t, entity.Roles{entity.RoleAdmin}, found.Roles)
+	assert.True(t, found.ValidatePassword("123456"))
+
+	// The only admin keeps the role.
+	w = httptest.NewRecorder()
+	h.UpdateUser(w, userRequest(http.MethodPut, id, dto.UpdateUserInput{Name: "Johnny", Email: "johnny@j.com"}))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	h.UpdateUser(w, userRequest(http.MethodPut, id, dto.UpdateUserInput{Name: "Johnny", Email: "johnny"}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var problem Error
+	json.NewDecoder(w.Body).Decode(&problem)
+	assert.Equal(t, "email", problem.Errors[0].Field)
+
+	w = httptest.NewRecorder()
+	h.UpdateUser(w, userRequest(http.MethodPut, "00000000-0000-0000-0000-000000000009", dto.UpdateUserInput{Name: "A", Email: "a@j.com"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDeleteUser(t *testing.T) {
+	h := newUserHandler()
+	ctx := context.Background()
+	admin, _ := entity.NewUser("Admin", "admin@j.com", "123456")
+	admin.SetRoles(entity.RoleAdmin)
+	h.UserDB.Create(ctx, admin)
+
+	w := httptest.NewRecorder()
+	h.DeleteUser(w, userRequest(http.MethodDelete, admin.ID.String(), nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	user, _ := h.UserDB.FindByEmail(ctx, "j@j.com")
+	tokens := login(t, h)
+	w = httptest.NewRecorder()
+	h.DeleteUser(w, userRequest(http.MethodDelete, user.ID.String(), nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	_, err := h.UserDB.FindByID(ctx, user.ID.String())
+	assert.ErrorIs(t, err, database.ErrNotFound)
+	assert.Equal(t, http.StatusUnauthorized, refresh(h, tokens.RefreshToken).Code)
+
+	w = httptest.NewRecorder()
+	h.DeleteUser(w, userRequest(http.MethodDelete, user.ID.String(), nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestDeleteLastTwoAdminsConcurrently(t *testing.T) {
+	h := newUserHandler()
+	ctx := context.Background()
+	var ids []string
+	for _, email := range []string{"a1@j.com", "a2@j.com"} {
+		admin, _ := entity.NewUser("Admin", email, "123456")
+		admin.SetRoles(entity.RoleAdmin)
+		h.UserDB.Create(ctx, admin)
+		ids = append(ids, admin.ID.String())
+	}
+
+	codes := make([]int, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			h.DeleteUser(w, userRequest(http.MethodDelete, id, nil))
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+	assert.ElementsMatch(t, []int{http.StatusNoContent, http.StatusConflict}, codes)
+	admins, _ := h.UserDB.CountByRole(ctx, entity.RoleAdmin)
+	assert.Equal(t, int64(1), admins)
+}
+
+func TestChangePassword(t *testing.T) {
+	h := newUserHandler()
+	ctx := context.Background()
+	user, _ := h.UserDB.FindByEmail(ctx, "j@j.com")
+	tokens := login(t, h)
+
+	change := func(current, next string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		b, _ := json.Marshal(dto.ChangePasswordInput{CurrentPassword: current, NewPassword: next})
+		r := httptest.NewRequest(http.MethodPost, "/users/me/password", bytes.NewReader(b))
+		h.ChangePassword(w, asUser(r, user))
+		return w
+	}
+
+	// A wrong current password is a validation error, not a failed
+	// authentication that would send the client back to the login page.
+	w := change("wrong", "abcdef")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var problem Error
+	json.NewDecoder(w.Body).Decode(&problem)
+	assert.Equal(t, ProblemTypeValidation, problem.Type)
+	assert.Equal(t, "current_password", problem.Errors[0].Field)
+
+	w = change("123456", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	json.NewDecoder(w.Body).Decode(&problem)
+	assert.Equal(t, "new_password", problem.Errors[0].Field)
+
+	assert.Equal(t, http.StatusNoContent, change("123456", "abcdef").Code)
+	found, _ := h.UserDB.FindByID(ctx, user.ID.String())
+	assert.True(t, found.ValidatePassword("abcdef"))
+	// Other sessions are signed out.
+	assert.Equal(t, http.StatusUnauthorized, refresh(h, tokens.RefreshToken).Code)
+}
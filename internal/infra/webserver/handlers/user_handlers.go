@@ -1,106 +1,452 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/antoniofmoliveira/apis/internal/dto"
 	"github.com/antoniofmoliveira/apis/internal/entity"
 	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	pkgentity "github.com/antoniofmoliveira/apis/pkg/entity"
 	"github.com/go-chi/jwtauth"
 )
 
+// RolesClaim is the JWT claim carrying the user's roles.
+const RolesClaim = "roles"
+
+// RegistrationMode decides who may call CreateUser. Admins can always create
+// users; the mode only applies to anonymous and non-admin callers.
+type RegistrationMode string
+
+const (
+	RegistrationClosed     RegistrationMode = "closed"
+	RegistrationOpen       RegistrationMode = "open"
+	RegistrationInviteOnly RegistrationMode = "invite-only"
+)
+
+var ErrUnknownRegistrationMode = errors.New("unknown registration mode")
+
+// dummyUser stands in for unknown emails in GetJwt, so they cost the same
+// bcrypt compare as a real account and response times do not reveal which
+// emails are registered.
+var dummyUser = sync.OnceValue(func() *entity.User {
+	user := &entity.User{}
+	if err := user.SetPassword("not a real password"); err != nil {
+		panic(err)
+	}
+	return user
+})
+
+// ParseRegistrationMode validates a configured mode, defaulting to closed.
+func ParseRegistrationMode(s string) (RegistrationMode, error) {
+	switch mode := RegistrationMode(strings.ToLower(s)); mode {
+	case "":
+		return RegistrationClosed, nil
+	case RegistrationClosed, RegistrationOpen, RegistrationInviteOnly:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownRegistrationMode, s)
+	}
+}
+
+// RolesFromClaims reads the roles claim set by issueTokens.
+func RolesFromClaims(claims map[string]interface{}) entity.Roles {
+	var roles entity.Roles
+	switch v := claims[RolesClaim].(type) {
+	case []interface{}:
+		for _, role := range v {
+			if s, ok := role.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+	case []string:
+		roles = append(roles, v...)
+	}
+	return roles
+}
+
+// callerClaims returns the claims of a verified token, or nil for anonymous
+// requests and invalid tokens.
+func callerClaims(r *http.Request) map[string]interface{} {
+	token, claims, err := jwtauth.FromContext(r.Context())
+	if err != nil || token == nil {
+		return nil
+	}
+	return claims
+}
+
 type UserHandler struct {
-	UserDB database.UserRepositoryInterface
+	UserDB         database.UserRepositoryInterface
+	RefreshTokenDB database.RefreshTokenRepositoryInterface
+	InviteDB       database.InviteRepositoryInterface
+	// UnitOfWork runs the account changes that must not half apply, such as
+	// the last-admin check with the write it guards.
+	UnitOfWork       database.UnitOfWorkInterface
+	RegistrationMode RegistrationMode
+	Lockout          entity.LockoutPolicy
+	Audit            *Auditor
 }
 
-func NewUserHandler(userDB database.UserRepositoryInterface) *UserHandler {
-	return &UserHandler{UserDB: userDB}
+func NewUserHandler(userDB database.UserRepositoryInterface, refreshTokenDB database.RefreshTokenRepositoryInterface, inviteDB database.InviteRepositoryInterface, uow database.UnitOfWorkInterface, registrationMode RegistrationMode, lockout entity.LockoutPolicy, audit *Auditor) *UserHandler {
+	return &UserHandler{
+		UserDB:           userDB,
+		RefreshTokenDB:   refreshTokenDB,
+		InviteDB:         inviteDB,
+		UnitOfWork:       uow,
+		RegistrationMode: registrationMode,
+		Lockout:          lockout,
+		Audit:            audit,
+	}
 }
 
 // Get Jwt godoc
 // @Summary      Get Jwt
-// @Description  Get Jwt
+// @Description  Get Jwt. Logins are rate limited per client IP address and per account, answered 429 with Retry-After. Repeated failed logins lock the account for a while; a locked account is answered 401 like any other failed login, so responses do not reveal which emails are registered.
 // @Tags         users
 // @Accept       json
 // @Produce      json
 // @Param        input  body      dto.GetJWTInput  true  "user request"
 // @Success      200     {object}  dto.AccessToken
 // @Failure      400     {object}  Error
+// @Failure      401     {object}  Error
+// @Failure      429     {object}  Error
 // @Failure      500     {object}  Error
 // @Router       /users/generate_token [post]
 func (h *UserHandler) GetJwt(w http.ResponseWriter, r *http.Request) {
-	jwt := r.Context().Value("jwt").(*jwtauth.JWTAuth)
-	jwtExpiresIn := r.Context().Value("jwtExpiresIn").(int)
-
 	var userdto dto.GetJWTInput
-	err := json.NewDecoder(r.Body).Decode(&userdto)
+	err := decodeJSON(r, &userdto)
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
 	var entityUser *entity.User
-	entityUser, err = h.UserDB.FindByEmail(userdto.Email)
+	entityUser, err = h.UserDB.FindByEmail(r.Context(), userdto.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		dummyUser().ValidatePassword(userdto.Password)
+		WriteError(w, r, ErrInvalidCredentials)
+		return
+	}
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
+		return
+	}
+	now := time.Now()
+	if entityUser.IsLocked(now) {
+		// compare anyway, so a locked account looks and takes as long as a
+		// wrong password
+		entityUser.ValidatePassword(userdto.Password)
+		WriteError(w, r, ErrInvalidCredentials)
 		return
 	}
 	if !entityUser.ValidatePassword(userdto.Password) {
-		json.NewEncoder(w).Encode(Error{Message: "Invalid credentials"})
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		// count the failure even when the client has gone away
+		lockedUntil, err := h.UserDB.RecordFailedLogin(context.WithoutCancel(r.Context()), entityUser.ID.String(), h.Lockout, now)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		if lockedUntil != nil {
+			h.Audit.RecordAs(r, entityUser.ID.String(), entity.AuditLockout, AuditEntityUser, entityUser.ID.String(), nil, nil)
+		}
+		WriteError(w, r, ErrInvalidCredentials)
 		return
 	}
-	_, tokenString, _ := jwt.Encode(map[string]interface{}{
-		"sub": entityUser.ID.String(),
-		"exp": time.Now().Add(time.Second * time.Duration(jwtExpiresIn)).Unix(),
+	if entityUser.FailedLogins > 0 || entityUser.LockedUntil != nil {
+		if err := h.UserDB.ResetFailedLogins(r.Context(), entityUser.ID.String()); err != nil {
+			WriteError(w, r, err)
+			return
+		}
+	}
+	h.issueTokens(w, r, entityUser, pkgentity.NewId(), entity.AuditLogin)
+}
+
+// Refresh Token godoc
+// @Summary      Refresh Jwt
+// @Description  Exchange a refresh token for a new access and refresh token pair. Each refresh token is single-use; presenting a spent one revokes every token of its session.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input  body      dto.RefreshTokenInput  true  "refresh token"
+// @Success      200     {object}  dto.AccessToken
+// @Failure      400     {object}  Error
+// @Failure      401     {object}  Error
+// @Failure      429     {object}  Error
+// @Failure      500     {object}  Error
+// @Router       /users/refresh_token [post]
+func (h *UserHandler) RefreshJwt(w http.ResponseWriter, r *http.Request) {
+	var input dto.RefreshTokenInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	token, err := h.RefreshTokenDB.FindByHash(r.Context(), entity.HashRefreshToken(input.RefreshToken))
+	if errors.Is(err, database.ErrNotFound) || errors.Is(err, database.ErrInvalidInput) {
+		WriteError(w, r, ErrInvalidRefreshToken)
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if token.IsSpent() {
+		h.revokeFamily(w, r, token)
+		return
+	}
+	if token.IsExpired(time.Now()) {
+		WriteError(w, r, ErrInvalidRefreshToken)
+		return
+	}
+	rows, err := h.RefreshTokenDB.MarkUsed(r.Context(), token.ID.String())
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if rows == 0 {
+		// spent concurrently by another request
+		h.revokeFamily(w, r, token)
+		return
+	}
+	user, err := h.UserDB.FindByID(r.Context(), token.UserID.String())
+	if errors.Is(err, database.ErrNotFound) {
+		WriteError(w, r, ErrInvalidRefreshToken)
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.issueTokens(w, r, user, token.FamilyID, entity.AuditRefresh)
+}
+
+// Logout godoc
+// @Summary      Logout
+// @Description  Revoke a refresh token and every token rotated from the same login
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input  body      dto.RefreshTokenInput  true  "refresh token"
+// @Success      204
+// @Failure      400     {object}  Error
+// @Failure      401     {object}  Error
+// @Failure      500     {object}  Error
+// @Router       /users/logout [post]
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var input dto.RefreshTokenInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	token, err := h.RefreshTokenDB.FindByHash(r.Context(), entity.HashRefreshToken(input.RefreshToken))
+	if errors.Is(err, database.ErrNotFound) || errors.Is(err, database.ErrInvalidInput) {
+		WriteError(w, r, ErrInvalidRefreshToken)
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if _, err := h.RefreshTokenDB.RevokeFamily(r.Context(), token.FamilyID.String()); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.Audit.RecordAs(r, token.UserID.String(), entity.AuditLogout, AuditEntitySession, token.FamilyID.String(), nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeFamily handles reuse of a spent refresh token: the token has leaked,
+// so the whole session is revoked and the request rejected. Revocation is not
+// tied to the request context so a disconnecting client cannot abort it.
+func (h *UserHandler) revokeFamily(w http.ResponseWriter, r *http.Request, token *entity.RefreshToken) {
+	if _, err := h.RefreshTokenDB.RevokeFamily(context.WithoutCancel(r.Context()), token.FamilyID.String()); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.Audit.RecordAs(r, token.UserID.String(), entity.AuditRevoke, AuditEntitySession, token.FamilyID.String(), nil, nil)
+	WriteError(w, r, ErrInvalidRefreshToken)
+}
+
+// issueTokens signs an access token for user and stores a new refresh
+// token in familyID, writing both to the response. action names the
+// session event for the audit log.
+func (h *UserHandler) issueTokens(w http.ResponseWriter, r *http.Request, user *entity.User, familyID pkgentity.ID, action string) {
+	jwt := r.Context().Value("jwt").(*jwtauth.JWTAuth)
+	jwtExpiresIn := r.Context().Value("jwtExpiresIn").(int)
+	jwtRefreshExpiresIn := r.Context().Value("jwtRefreshExpiresIn").(int)
+
+	// jwx cannot serialize a nil slice claim
+	roles := []string{}
+	roles = append(roles, user.Roles...)
+	_, tokenString, err := jwt.Encode(map[string]interface{}{
+		"sub":      user.ID.String(),
+		"exp":      time.Now().Add(time.Second * time.Duration(jwtExpiresIn)).Unix(),
+		RolesClaim: roles,
 	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	refreshToken, refreshTokenString, err := entity.NewRefreshToken(user.ID, familyID, time.Second*time.Duration(jwtRefreshExpiresIn))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if err := h.RefreshTokenDB.Create(r.Context(), refreshToken); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.Audit.RecordAs(r, user.ID.String(), action, AuditEntitySession, familyID.String(), nil, nil)
 
 	accessToken := dto.AccessToken{
-		AccessToken: tokenString,
+		AccessToken:  tokenString,
+		RefreshToken: refreshTokenString,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(accessToken)
-
 }
 
 // Create User godoc
 // @Summary      Create a new user
-// @Description  Create a new user
+// @Description  Create a new user. Admins may always create users and assign roles. Other callers depend on the registration mode: closed rejects them, open creates a viewer, invite-only creates a viewer when invite_code is valid.
 // @Tags         users
 // @Accept       json
 // @Produce      json
 // @Param        input  body      dto.CreateUserInput  true  "user request"
+// @Param        Idempotency-Key  header    string  false  "Unique key; retries with it replay the first response"
 // @Success      201
 // @Failure      400     {object}  Error
+// @Failure      403     {object}  Error
+// @Failure      409     {object}  Error
+// @Failure      422  {object}  Error  "Idempotency-Key reused with a different request"
+// @Failure      429     {object}  Error
 // @Failure      500     {object}  Error
 // @Router       /users [post]
 // @Security     ApiKeyAuth
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var userdto dto.CreateUserInput
-	err := json.NewDecoder(r.Body).Decode(&userdto)
+	err := decodeJSON(r, &userdto)
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
 		return
 	}
 	var entityUser *entity.User
 	entityUser, err = entity.NewUser(userdto.Name, userdto.Email, userdto.Password)
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		WriteError(w, r, err)
+		return
+	}
+	if err = entityUser.SetRoles(userdto.Roles...); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	var invite *entity.Invite
+	if !RolesFromClaims(callerClaims(r)).Has(entity.RoleAdmin) {
+		if h.RegistrationMode != RegistrationOpen && h.RegistrationMode != RegistrationInviteOnly {
+			WriteError(w, r, ErrRegistrationClosed)
+			return
+		}
+		if len(entityUser.Roles) != 1 || !entityUser.Roles.Has(entity.RoleViewer) {
+			WriteError(w, r, ErrRoleAssignmentForbidden)
+			return
+		}
+		if h.RegistrationMode == RegistrationInviteOnly {
+			if invite, err = h.consumeInvite(r.Context(), userdto.InviteCode, userdto.Email); err != nil {
+				WriteError(w, r, err)
+				return
+			}
+		}
+	}
+	err = h.UserDB.Create(r.Context(), entityUser)
+	if err != nil {
+		if invite != nil {
+			// release even when the client has gone away
+			h.InviteDB.Release(context.WithoutCancel(r.Context()), invite.ID.String())
+		}
+		WriteError(w, r, err)
+		return
+	}
+	// self-registrations are attributed to the new user
+	actor := callerSubject(r)
+	if actor == "" {
+		actor = entityUser.ID.String()
+	}
+	h.Audit.RecordAs(r, actor, entity.AuditCreate, AuditEntityUser, entityUser.ID.String(), nil, entityUser)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// consumeInvite spends the invite identified by code for email.
+func (h *UserHandler) consumeInvite(ctx context.Context, code, email string) (*entity.Invite, error) {
+	if code == "" {
+		return nil, ErrInvalidInvite
+	}
+	invite, err := h.InviteDB.FindByHash(ctx, entity.HashInviteCode(code))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidInvite
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !invite.Accepts(email, time.Now()) {
+		return nil, ErrInvalidInvite
+	}
+	rows, err := h.InviteDB.MarkUsed(ctx, invite.ID.String())
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, ErrInvalidInvite
+	}
+	return invite, nil
+}
+
+// Create Invite godoc
+// @Summary      Create a registration invite
+// @Description  Create a single-use invite code for invite-only registration. Leave email empty to accept any address.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        input  body      dto.CreateInviteInput  true  "invite request"
+// @Success      201     {object}  dto.InviteOutput
+// @Failure      400     {object}  Error
+// @Failure      403     {object}  Error
+// @Failure      500     {object}  Error
+// @Router       /users/invites [post]
+// @Security     ApiKeyAuth
+func (h *UserHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	inviteExpiresIn := r.Context().Value("inviteExpiresIn").(int)
+
+	var input dto.CreateInviteInput
+	err := decodeJSON(r, &input)
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
-	err = h.UserDB.Create(entityUser)
+	createdBy, _ := pkgentity.ParseId(callerSubject(r))
+	invite, code, err := entity.NewInvite(input.Email, createdBy, time.Second*time.Duration(inviteExpiresIn))
 	if err != nil {
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
+		return
+	}
+	if err = h.InviteDB.Create(r.Context(), invite); err != nil {
+		WriteError(w, r, err)
 		return
 	}
+	h.Audit.Record(r, entity.AuditCreate, AuditEntityInvite, invite.ID.String(), nil, invite)
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(dto.InviteOutput{
+		Code:      code,
+		Email:     invite.Email,
+		ExpiresAt: invite.ExpiresAt,
+	})
 }
 
 // @Summary      Find user by email
@@ -110,6 +456,7 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 // @Produce      json
 // @Param        email   query     string  true  "User email"
 // @Success      200  {object}  entity.User
+// @Failure      403  {object}  Error
 // @Failure      404  {object}  Error
 // @Failure      500  {object}  Error
 // @Router       /users [get]
@@ -117,18 +464,16 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) FindByEmail(w http.ResponseWriter, r *http.Request) {
 	email := r.URL.Query().Get("email")
 	if email == "" {
-		json.NewEncoder(w).Encode(Error{Message: "Email is required"})
-		http.Error(w, "Email is required", http.StatusBadRequest)
+		WriteError(w, r, ErrEmailIsRequired)
+		return
 	}
-	user, err := h.UserDB.FindByEmail(email)
+	user, err := h.UserDB.FindByEmail(r.Context(), email)
 	if err != nil {
-		if err.Error() == "record not found" {
-			json.NewEncoder(w).Encode(Error{Message: "User not found"})
-			http.Error(w, "User not found", http.StatusNotFound)
+		if errors.Is(err, database.ErrNotFound) {
+			WriteProblem(w, r, NewProblem(http.StatusNotFound, "User not found"))
 			return
 		}
-		json.NewEncoder(w).Encode(Error{Message: err.Error()})
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/dto"
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newUserHandler() *UserHandler {
+	return newUserHandlerWithMode(RegistrationClosed)
+}
+
+func newUserHandlerWithMode(mode RegistrationMode) *UserHandler {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&entity.User{}, &entity.RefreshToken{}, &entity.Invite{}, &entity.AuditEntry{})
+	user, _ := entity.NewUser("John Doe", "j@j.com", "123456")
+	db.Create(user)
+	return NewUserHandler(database.NewUserRepository(db), database.NewRefreshTokenRepository(db), database.NewInviteRepository(db), database.NewUnitOfWork(db), mode, entity.LockoutPolicy{Threshold: 3, Duration: time.Minute}, NewAuditor(database.NewAuditRepository(db)))
+}
+
+func newTokenRequest(path string, body any) *http.Request {
+	b, _ := json.Marshal(body)
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+	ctx := context.WithValue(r.Context(), "jwt", jwtauth.New("HS256", []byte("secret"), nil))
+	ctx = context.WithValue(ctx, "jwtExpiresIn", 300)
+	ctx = context.WithValue(ctx, "jwtRefreshExpiresIn", 3600)
+	ctx = context.WithValue(ctx, "inviteExpiresIn", 3600)
+	return r.WithContext(ctx)
+}
+
+// asCaller attaches a verified token with roles to r, as jwtauth.Verifier would.
+func asCaller(r *http.Request, roles ...string) *http.Request {
+	auth := jwtauth.New("HS256", []byte("secret"), nil)
+	_, tokenString, _ := auth.Encode(map[string]interface{}{"sub": "00000000-0000-0000-0000-000000000001", RolesClaim: roles})
+	token, err := jwtauth.VerifyToken(auth, tokenString)
+	return r.WithContext(jwtauth.NewContext(r.Context(), token, err))
+}
+
+func createUser(h *UserHandler, r *http.Request) int {
+	w := httptest.NewRecorder()
+	h.CreateUser(w, r)
+	return w.Code
+}
+
+func login(t *testing.T, h *UserHandler) dto.AccessToken {
+	w := httptest.NewRecorder()
+	h.GetJwt(w, newTokenRequest("/users/generate_token", dto.GetJWTInput{Email: "j@j.com", Password: "123456"}))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tokens dto.AccessToken
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&tokens))
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	return tokens
+}
+
+func TestGetJwtRolesClaim(t *testing.T) {
+	h := newUserHandler()
+	tokens := login(t, h)
+	token, err := jwtauth.VerifyToken(jwtauth.New("HS256", []byte("secret"), nil), tokens.AccessToken)
+	assert.Nil(t, err)
+	claims, _ := token.AsMap(context.Background())
+	assert.Equal(t, []interface{}{entity.RoleViewer}, claims[RolesClaim])
+}
+
+func refresh(h *UserHandler, refreshToken string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.RefreshJwt(w, newTokenRequest("/users/refresh_token", dto.RefreshTokenInput{RefreshToken: refreshToken}))
+	return w
+}
+
+func TestGetJwtInvalidCredentials(t *testing.T) {
+	h := newUserHandler()
+	w := httptest.NewRecorder()
+	h.GetJwt(w, newTokenRequest("/users/generate_token", dto.GetJWTInput{Email: "x@j.com", Password: "123456"}))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	h.GetJwt(w, newTokenRequest("/users/generate_token", dto.GetJWTInput{Email: "j@j.com", Password: "654321"}))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestGetJwtLockout(t *testing.T) {
+	h := newUserHandler()
+	wrong := dto.GetJWTInput{Email: "j@j.com", Password: "654321"}
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		h.GetJwt(w, newTokenRequest("/users/generate_token", wrong))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// Locked accounts are refused even with the right password, with the
+	// same answer an unknown email gets.
+	w := httptest.NewRecorder()
+	h.GetJwt(w, newTokenRequest("/users/generate_token", dto.GetJWTInput{Email: "j@j.com", Password: "123456"}))
+	unknown := httptest.NewRecorder()
+	h.GetJwt(unknown, newTokenRequest("/users/generate_token", dto.GetJWTInput{Email: "x@j.com", Password: "123456"}))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, unknown.Body.String(), w.Body.String())
+	assert.Empty(t, w.Header().Get("Retry-After"))
+	db := h.UserDB.(*database.UserRepository).DB
+	var lockouts int64
+	db.Model(&entity.AuditEntry{}).Where("action = ?", entity.AuditLockout).Count(&lockouts)
+	assert.Equal(t, int64(1), lockouts)
+
+	// Once the lock expires a good login clears the failures.
+	db.Model(&entity.User{}).Where("email = ?", "j@j.com").Update("locked_until", time.Now().Add(-time.Second))
+	login(t, h)
+	user, _ := h.UserDB.FindByEmail(context.Background(), "j@j.com")
+	assert.Equal(t, 0, user.FailedLogins)
+	assert.Nil(t, user.LockedUntil)
+}
+
+func TestRefreshJwtRotates(t *testing.T) {
+	h := newUserHandler()
+	tokens := login(t, h)
+
+	w := refresh(h, tokens.RefreshToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rotated dto.AccessToken
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&rotated))
+	assert.NotEqual(t, tokens.RefreshToken, rotated.RefreshToken)
+
+	w = refresh(h, rotated.RefreshToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRefreshJwtReuseRevokesFamily(t *testing.T) {
+	h := newUserHandler()
+	tokens := login(t, h)
+
+	w := refresh(h, tokens.RefreshToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var rotated dto.AccessToken
+	json.NewDecoder(w.Body).Decode(&rotated)
+
+	w = refresh(h, tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = refresh(h, rotated.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRefreshJwtUnknownToken(t *testing.T) {
+	h := newUserHandler()
+	w := refresh(h, "unknown")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLogout(t *testing.T) {
+	h := newUserHandler()
+	tokens := login(t, h)
+
+	w := httptest.NewRecorder()
+	h.Logout(w, newTokenRequest("/users/logout", dto.RefreshTokenInput{RefreshToken: tokens.RefreshToken}))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = refresh(h, tokens.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestParseRegistrationMode(t *testing.T) {
+	mode, err := ParseRegistrationMode("")
+	assert.Nil(t, err)
+	assert.Equal(t, RegistrationClosed, mode)
+	mode, err = ParseRegistrationMode("Invite-Only")
+	assert.Nil(t, err)
+	assert.Equal(t, RegistrationInviteOnly, mode)
+	_, err = ParseRegistrationMode("public")
+	assert.True(t, errors.Is(err, ErrUnknownRegistrationMode))
+}
+
+func TestRolesFromClaims(t *testing.T) {
+	roles := RolesFromClaims(map[string]interface{}{RolesClaim: []interface{}{"admin", 1, "viewer"}})
+	assert.Equal(t, entity.Roles{entity.RoleAdmin, entity.RoleViewer}, roles)
+	assert.Empty(t, RolesFromClaims(map[string]interface{}{}))
+}
+
+func TestCreateUserClosed(t *testing.T) {
+	h := newUserHandler()
+	input := dto.CreateUserInput{Name: "Jane", Email: "jane@j.com", Password: "123456"}
+	assert.Equal(t, http.StatusForbidden, createUser(h, newTokenRequest("/users", input)))
+	assert.Equal(t, http.StatusForbidden, createUser(h, asCaller(newTokenRequest("/users", input), entity.RoleViewer)))
+
+	input.Roles = []string{entity.RoleAdmin}
+	assert.Equal(t, http.StatusCreated, createUser(h, asCaller(newTokenRequest("/users", input), entity.RoleAdmin)))
+	user, _ := h.UserDB.FindByEmail(context.Background(), "jane@j.com")
+	assert.True(t, user.Roles.Has(entity.RoleAdmin))
+}
+
+func TestCreateUserOpen(t *testing.T) {
+	h := newUserHandlerWithMode(RegistrationOpen)
+	input := dto.CreateUserInput{Name: "Jane", Email: "jane@j.com", Password: "123456", Roles: []string{entity.RoleAdmin}}
+	assert.Equal(t, http.StatusForbidden, createUser(h, newTokenRequest("/users", input)))
+
+	input.Roles = nil
+	assert.Equal(t, http.StatusCreated, createUser(h, newTokenRequest("/users", input)))
+	user, _ := h.UserDB.FindByEmail(context.Background(), "jane@j.com")
+	assert.Equal(t, entity.Roles{entity.RoleViewer}, user.Roles)
+}
+
+func TestCreateUserInviteOnly(t *testing.T) {
+	h := newUserHandlerWithMode(RegistrationInviteOnly)
+	input := dto.CreateUserInput{Name: "Jane", Email: "jane@j.com", Password: "123456"}
+	assert.Equal(t, http.StatusBadRequest, createUser(h, newTokenRequest("/users", input)))
+
+	w := httptest.NewRecorder()
+	h.CreateInvite(w, asCaller(newTokenRequest("/users/invites", dto.CreateInviteInput{Email: "jane@j.com"}), entity.RoleAdmin))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var invite dto.InviteOutput
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&invite))
+	assert.NotEmpty(t, invite.Code)
+
+	input.InviteCode = invite.Code
+	input.Email = "other@j.com"
+	assert.Equal(t, http.StatusBadRequest, createUser(h, newTokenRequest("/users", input)))
+	input.Email = "jane@j.com"
+	assert.Equal(t, http.StatusCreated, createUser(h, newTokenRequest("/users", input)))
+	input.Email = "jane2@j.com"
+	assert.Equal(t, http.StatusBadRequest, createUser(h, newTokenRequest("/users", input)))
+}
@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/antoniofmoliveira/apis/internal/infra/webserver/handlers"
+	"github.com/go-chi/jwtauth"
+)
+
+// RequireRoles lets the request through when the verified token carries at
+// least one of roles and answers 403 otherwise. It must run after
+// jwtauth.Verifier and jwtauth.Authenticator.
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, claims, err := jwtauth.FromContext(r.Context())
+			if err != nil {
+				handlers.WriteProblem(w, r, handlers.NewProblem(http.StatusUnauthorized, err.Error()))
+				return
+			}
+			if !handlers.RolesFromClaims(claims).HasAny(roles...) {
+				handlers.WriteProblem(w, r, handlers.NewProblem(http.StatusForbidden, "insufficient role"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+)
+
+var tokenAuth = jwtauth.New("HS256", []byte("secret"), nil)
+
+func serve(t *testing.T, roles []string, required ...string) int {
+	claims := map[string]interface{}{"sub": "1"}
+	if roles != nil {
+		claims["roles"] = roles
+	}
+	_, token, err := tokenAuth.Encode(claims)
+	assert.Nil(t, err)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	h := jwtauth.Verifier(tokenAuth)(jwtauth.Authenticator(RequireRoles(required...)(ok)))
+
+	r := httptest.NewRequest(http.MethodGet, "/products", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestRequireRolesAllows(t *testing.T) {
+	assert.Equal(t, http.StatusOK, serve(t, []string{entity.RoleAdmin}, entity.RoleAdmin))
+	assert.Equal(t, http.StatusOK, serve(t, []string{entity.RoleViewer}, entity.RoleAdmin, entity.RoleViewer))
+}
+
+func TestRequireRolesForbids(t *testing.T) {
+	assert.Equal(t, http.StatusForbidden, serve(t, []string{entity.RoleViewer}, entity.RoleAdmin))
+	assert.Equal(t, http.StatusForbidden, serve(t, nil, entity.RoleViewer))
+}
@@ -0,0 +1,179 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/antoniofmoliveira/apis/internal/infra/webserver/handlers"
+	"github.com/go-chi/jwtauth"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// Idempotency makes retries of a request carrying an Idempotency-Key safe.
+// The first response for a key is stored for ttl and replayed to later
+// requests from the same caller with that key. A key reused with a
+// different method, target or body is answered 422, and a retry that
+// arrives while the first request is still running 409. A claim still
+// pending after lease is taken to belong to a request that died, say in a
+// crash, and the next retry takes it over, so lease must outlast the
+// slowest request on the route. 5xx responses are
+// not stored, so the request can be retried. Keyed bodies are read into
+// memory for hashing, so ones over handlers.MaxBodyBytes are answered 413.
+// Requests without the header pass through. It must run after jwtauth.Verifier so keys are scoped to
+// the caller; anonymous callers are scoped by IP address.
+func Idempotency(store database.IdempotencyRepositoryInterface, ttl, lease time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			body, err := handlers.ReadBody(w, r)
+			if err != nil {
+				handlers.WriteError(w, r, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			record, err := entity.NewIdempotencyRecord(idempotencyScope(r), key, entity.HashRequest(r.Method, r.URL.RequestURI(), body), ttl)
+			if err != nil {
+				handlers.WriteProblem(w, r, handlers.NewProblem(http.StatusBadRequest, err.Error()))
+				return
+			}
+
+			existing, err := claimKey(r.Context(), store, record, lease)
+			if err != nil {
+				handlers.WriteError(w, r, err)
+				return
+			}
+			if existing != nil {
+				switch {
+				case existing.RequestHash != record.RequestHash:
+					handlers.WriteProblem(w, r, handlers.NewProblem(http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request"))
+				case existing.IsPending():
+					handlers.WriteProblem(w, r, handlers.NewProblem(http.StatusConflict, "a request with this Idempotency-Key is still being processed"))
+				default:
+					replay(w, existing)
+				}
+				return
+			}
+
+			// The request owns the key now. Release it unless a response
+			// worth replaying is stored, including when next panics.
+			ctx := context.WithoutCancel(r.Context())
+			stored := false
+			defer func() {
+				if stored {
+					return
+				}
+				if err := store.Delete(ctx, record.ID.String()); err != nil {
+					slog.Error("releasing idempotency key", "error", err, "key", key)
+				}
+			}()
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.WriteHeader(http.StatusOK)
+			}
+			if rec.status >= http.StatusInternalServerError {
+				return
+			}
+			header, _ := json.Marshal(rec.header)
+			record.Status, record.Header, record.Body = rec.status, string(header), rec.body.Bytes()
+			if err := store.Complete(ctx, record); err != nil {
+				slog.Error("storing idempotent response", "error", err, "key", key)
+				return
+			}
+			stored = true
+		})
+	}
+}
+
+// claimKey stores record as pending and returns nil, or returns the live
+// record that already holds its key. An expired or abandoned record is
+// replaced.
+func claimKey(ctx context.Context, store database.IdempotencyRepositoryInterface, record *entity.IdempotencyRecord, lease time.Duration) (*entity.IdempotencyRecord, error) {
+	for attempt := 0; ; attempt++ {
+		err := store.Create(ctx, record)
+		if !errors.Is(err, database.ErrConflict) {
+			return nil, err
+		}
+		existing, err := store.Find(ctx, record.Scope, record.Key)
+		if errors.Is(err, database.ErrNotFound) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		if (!existing.IsExpired(now) && !existing.IsAbandoned(now, lease)) || attempt > 0 {
+			return existing, nil
+		}
+		if err := store.Delete(ctx, existing.ID.String()); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// replay writes a stored response, marking it with Idempotent-Replayed.
+func replay(w http.ResponseWriter, record *entity.IdempotencyRecord) {
+	var header http.Header
+	json.Unmarshal([]byte(record.Header), &header)
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.Status)
+	w.Write(record.Body)
+}
+
+// idempotencyScope identifies the caller: the token subject, or the client
+// IP address for anonymous requests.
+func idempotencyScope(r *http.Request) string {
+	if _, claims, err := jwtauth.FromContext(r.Context()); err == nil {
+		if sub, _ := claims["sub"].(string); sub != "" {
+			return "user:" + sub
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+		rec.header = rec.ResponseWriter.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
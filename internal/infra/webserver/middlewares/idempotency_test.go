@@ -0,0 +1,127 @@
+package middlewares
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/antoniofmoliveira/apis/internal/infra/webserver/handlers"
+	"github.com/go-chi/jwtauth"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newIdempotentHandler(status int) (http.Handler, *int, *database.IdempotencyRepository) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{TranslateError: true})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	db.AutoMigrate(&entity.IdempotencyRecord{})
+	calls := 0
+	create := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Location", "/products/"+string(body))
+		w.WriteHeader(status)
+		w.Write([]byte(`{"call":` + strconv.Itoa(calls) + `}`))
+	})
+	store := database.NewIdempotencyRepository(db)
+	h := jwtauth.Verifier(tokenAuth)(Idempotency(store, time.Hour, time.Minute)(create))
+	return h, &calls, store
+}
+
+func idempotentRequest(h http.Handler, key, sub, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(IdempotencyKeyHeader, key)
+	}
+	if sub != "" {
+		_, token, _ := tokenAuth.Encode(map[string]interface{}{"sub": sub})
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotencyReplays(t *testing.T) {
+	h, calls, _ := newIdempotentHandler(http.StatusCreated)
+
+	first := idempotentRequest(h, "k1", "1", "a")
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+
+	retry := idempotentRequest(h, "k1", "1", "a")
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, "/products/a", retry.Header().Get("Location"))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, 1, *calls)
+
+	// Keys belong to the caller, and requests without a key always run.
+	assert.Equal(t, http.StatusCreated, idempotentRequest(h, "k1", "2", "a").Code)
+	assert.Equal(t, http.StatusCreated, idempotentRequest(h, "k1", "", "a").Code)
+	assert.Equal(t, http.StatusCreated, idempotentRequest(h, "", "1", "a").Code)
+	assert.Equal(t, 4, *calls)
+}
+
+func TestIdempotencyRejectsChangedRequest(t *testing.T) {
+	h, calls, _ := newIdempotentHandler(http.StatusCreated)
+	idempotentRequest(h, "k1", "1", "a")
+	w := idempotentRequest(h, "k1", "1", "b")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, 1, *calls)
+
+	w = idempotentRequest(h, "has space", "1", "a")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestIdempotencyRejectsLargeBody(t *testing.T) {
+	h, calls, _ := newIdempotentHandler(http.StatusCreated)
+	w := idempotentRequest(h, "k1", "1", strings.Repeat("a", handlers.MaxBodyBytes+1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, 0, *calls)
+
+	assert.Equal(t, http.StatusCreated, idempotentRequest(h, "k1", "1", strings.Repeat("a", handlers.MaxBodyBytes)).Code)
+}
+
+func TestIdempotencyForgetsServerErrors(t *testing.T) {
+	h, calls, _ := newIdempotentHandler(http.StatusServiceUnavailable)
+	idempotentRequest(h, "k1", "1", "a")
+	w := idempotentRequest(h, "k1", "1", "a")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 2, *calls)
+}
+
+func TestIdempotencyRejectsConcurrentRetry(t *testing.T) {
+	h, calls, store := newIdempotentHandler(http.StatusCreated)
+	hash := entity.HashRequest(http.MethodPost, "/products", []byte("a"))
+	pending, _ := entity.NewIdempotencyRecord("user:1", "k1", hash, time.Hour)
+	store.Create(context.Background(), pending)
+
+	w := idempotentRequest(h, "k1", "1", "a")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, 0, *calls)
+}
+
+func TestIdempotencyTakesOverAbandonedClaim(t *testing.T) {
+	h, calls, store := newIdempotentHandler(http.StatusCreated)
+	hash := entity.HashRequest(http.MethodPost, "/products", []byte("a"))
+	pending, _ := entity.NewIdempotencyRecord("user:1", "k1", hash, time.Hour)
+	pending.CreatedAt = time.Now().Add(-2 * time.Minute)
+	store.Create(context.Background(), pending)
+
+	w := idempotentRequest(h, "k1", "1", "a")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 1, *calls)
+	assert.Equal(t, "true", idempotentRequest(h, "k1", "1", "a").Header().Get(IdempotentReplayedHeader))
+}
@@ -0,0 +1,89 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/infra/webserver/handlers"
+	"github.com/antoniofmoliveira/apis/pkg/ratelimit"
+	"golang.org/x/exp/slog"
+)
+
+// maxKeyBody bounds how much of a body RateLimitByJSONField reads.
+const maxKeyBody = 1 << 16
+
+// RateLimitKey names the bucket a request is counted in. An empty key lets
+// the request through uncounted.
+type RateLimitKey func(r *http.Request) string
+
+// RateLimit counts requests in the bucket named by key and answers 429 with
+// Retry-After once it is empty. If the store fails the request is let
+// through, so an outage of a shared store does not take logins down with it.
+func RateLimit(store ratelimit.Store, limit ratelimit.Limit, key RateLimitKey) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit.Disabled() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ok, retryAfter, err := store.Allow(r.Context(), k, limit, time.Now())
+			if err != nil {
+				slog.Error("rate limiting", "error", err, "key", k)
+			}
+			if err == nil && !ok {
+				handlers.WriteTooManyRequests(w, r, retryAfter, handlers.ErrTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimitByIP counts requests per client IP address. name keeps the
+// buckets of different routes apart.
+func RateLimitByIP(name string) RateLimitKey {
+	return func(r *http.Request) string {
+		return name + ":ip:" + clientIP(r)
+	}
+}
+
+// RateLimitByJSONField counts requests per value of a top-level string
+// field of the JSON body, compared case-insensitively, such as the email of
+// a login. The body is left for the handler to read. Requests without the
+// field are not counted.
+func RateLimitByJSONField(name, field string) RateLimitKey {
+	return func(r *http.Request) string {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxKeyBody))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil {
+			return ""
+		}
+		var fields map[string]json.RawMessage
+		var value string
+		if json.Unmarshal(body, &fields) != nil || json.Unmarshal(fields[field], &value) != nil || value == "" {
+			return ""
+		}
+		return name + ":" + field + ":" + strings.ToLower(strings.TrimSpace(value))
+	}
+}
+
+// clientIP returns the IP address of the client, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
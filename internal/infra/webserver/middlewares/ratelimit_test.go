@@ -0,0 +1,74 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/pkg/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingStore struct{}
+
+func (failingStore) Allow(context.Context, string, ratelimit.Limit, time.Time) (bool, time.Duration, error) {
+	return false, 0, errors.New("store is down")
+}
+
+func loginRequest(h http.Handler, ip, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/users/generate_token", strings.NewReader(body))
+	r.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func echoBody() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	})
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	limit := ratelimit.Limit{Burst: 2, Per: time.Minute}
+	h := RateLimit(ratelimit.NewMemoryStore(), limit, RateLimitByIP("login"))(echoBody())
+
+	assert.Equal(t, http.StatusOK, loginRequest(h, "10.0.0.1", "").Code)
+	assert.Equal(t, http.StatusOK, loginRequest(h, "10.0.0.1", "").Code)
+	w := loginRequest(h, "10.0.0.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, loginRequest(h, "10.0.0.2", "").Code)
+}
+
+func TestRateLimitByJSONField(t *testing.T) {
+	limit := ratelimit.Limit{Burst: 1, Per: time.Minute}
+	h := RateLimit(ratelimit.NewMemoryStore(), limit, RateLimitByJSONField("login", "email"))(echoBody())
+
+	w := loginRequest(h, "10.0.0.1", `{"email":"a@example.com","password":"x"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"email":"a@example.com","password":"x"}`, w.Body.String())
+	// The account is limited whatever address the attempts come from.
+	w = loginRequest(h, "10.0.0.2", `{"email":" A@Example.com","password":"y"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, http.StatusOK, loginRequest(h, "10.0.0.1", `{"email":"b@example.com"}`).Code)
+
+	// Bodies without the field are left to the handler to reject.
+	assert.Equal(t, http.StatusOK, loginRequest(h, "10.0.0.1", `{"email":1}`).Code)
+	assert.Equal(t, http.StatusOK, loginRequest(h, "10.0.0.1", `{"email":1}`).Code)
+	assert.Equal(t, "[", loginRequest(h, "10.0.0.1", `[`).Body.String())
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	h := RateLimit(failingStore{}, ratelimit.Limit{Burst: 1, Per: time.Minute}, RateLimitByIP("login"))(echoBody())
+	assert.Equal(t, http.StatusOK, loginRequest(h, "10.0.0.1", "").Code)
+
+	h = RateLimit(failingStore{}, ratelimit.Limit{}, RateLimitByIP("login"))(echoBody())
+	assert.Equal(t, http.StatusOK, loginRequest(h, "10.0.0.1", "").Code)
+}
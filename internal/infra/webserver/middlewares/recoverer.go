@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/middleware"
+	"golang.org/x/exp/slog"
+)
+
+// Recoverer logs panics and answers 500 like chi's middleware.Recoverer,
+// but lets http.ErrAbortHandler through so net/http aborts the response.
+// chi's version swallows it, which turns an aborted streaming response into
+// one that looks complete. The stack is logged with slog because chi's
+// pretty printer panics on the stack traces of current Go releases.
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+			slog.Error("panic serving request", "panic", rvr, "request_id", middleware.GetReqID(r.Context()), "stack", string(debug.Stack()))
+			w.WriteHeader(http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
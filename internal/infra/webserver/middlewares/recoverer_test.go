@@ -0,0 +1,70 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/antoniofmoliveira/apis/internal/entity"
+	"github.com/antoniofmoliveira/apis/internal/infra/database"
+	"github.com/antoniofmoliveira/apis/internal/infra/webserver/handlers"
+	"github.com/go-chi/chi/middleware"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// secondBatchFails serves the first page of an export and fails the next.
+type secondBatchFails struct {
+	*database.ProductRepository
+	calls int
+}
+
+func (r *secondBatchFails) SearchAfter(ctx context.Context, filter database.ProductFilter, after *database.ProductCursor, limit int) ([]entity.Product, error) {
+	r.calls++
+	if r.calls > 1 {
+		return nil, errors.New("connection lost")
+	}
+	return r.ProductRepository.SearchAfter(ctx, filter, after, limit)
+}
+
+func TestRecovererAbortsFailedExport(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&entity.Product{}, &entity.ProductCategory{}, &entity.ProductTag{})
+	products := database.NewProductRepository(db)
+	// a full first batch, so the export asks for a second one
+	for i := 0; i < 500; i++ {
+		p, _ := entity.NewProduct("Product "+strconv.Itoa(i), 100, "USD")
+		products.Create(context.Background(), p)
+	}
+	h := handlers.NewProductHandler(&secondBatchFails{ProductRepository: products}, handlers.DefaultPagination(), "USD", nil)
+	server := httptest.NewServer(middleware.RequestID(middleware.Logger(Recoverer(QueryTimeout(time.Minute)(http.HandlerFunc(h.ExportProducts))))))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.NotEmpty(t, body)
+}
+
+func TestRecovererAnswersPanics(t *testing.T) {
+	h := middleware.Logger(Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
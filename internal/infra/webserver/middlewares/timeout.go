@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// QueryTimeout bounds the request context by d so repository calls made
+// with r.Context() are cancelled once it elapses. A zero d disables it.
+func QueryTimeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
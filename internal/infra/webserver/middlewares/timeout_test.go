@@ -0,0 +1,27 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	h := QueryTimeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/products", nil))
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Second), deadline, time.Second)
+
+	h = QueryTimeout(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok = r.Context().Deadline()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/products", nil))
+	assert.False(t, ok)
+}
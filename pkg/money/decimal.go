@@ -0,0 +1,37 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Decimal is a decimal amount as it appears in JSON. It is emitted as a
+// string and accepts either a string or a bare number, whose literal text
+// is kept as written so no float rounding happens.
+type Decimal string
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(d))
+}
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*d = ""
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*d = Decimal(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidAmount, data)
+	}
+	*d = Decimal(n)
+	return nil
+}
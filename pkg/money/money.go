@@ -0,0 +1,92 @@
+// Package money converts between decimal strings and integer amounts in the
+// minor unit of an ISO 4217 currency, so prices never pass through floats.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrInvalidAmount   = errors.New("invalid amount")
+)
+
+// exponents maps ISO 4217 codes to the number of digits of their minor unit.
+var exponents = map[string]int{
+	"AED": 2, "ARS": 2, "AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2,
+	"CLP": 0, "CNY": 2, "COP": 2, "CZK": 2, "DKK": 2, "EGP": 2, "EUR": 2,
+	"GBP": 2, "HKD": 2, "HUF": 2, "IDR": 2, "ILS": 2, "INR": 2, "ISK": 0,
+	"JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3, "MXN": 2, "MYR": 2, "NGN": 2,
+	"NOK": 2, "NZD": 2, "OMR": 3, "PEN": 2, "PHP": 2, "PLN": 2, "RON": 2,
+	"SAR": 2, "SEK": 2, "SGD": 2, "THB": 2, "TND": 3, "TRY": 2, "TWD": 2,
+	"UAH": 2, "USD": 2, "UYU": 2, "VND": 0, "ZAR": 2,
+}
+
+// Exponent returns the number of minor unit digits of currency.
+func Exponent(currency string) (int, error) {
+	exp, ok := exponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return exp, nil
+}
+
+// Parse converts a decimal string such as "12.30" into minor units of
+// currency. More fraction digits than the currency allows is an error, not
+// a rounding.
+func Parse(s, currency string) (int64, error) {
+	exp, err := Exponent(currency)
+	if err != nil {
+		return 0, err
+	}
+	negative := strings.HasPrefix(s, "-")
+	whole, fraction, hasPoint := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if whole == "" || !digits(whole) || (hasPoint && (fraction == "" || !digits(fraction))) {
+		return 0, fmt.Errorf("%w: %q is not a decimal number", ErrInvalidAmount, s)
+	}
+	if len(fraction) > exp {
+		return 0, fmt.Errorf("%w: %s allows %d decimal places", ErrInvalidAmount, currency, exp)
+	}
+	fraction += strings.Repeat("0", exp-len(fraction))
+	var amount int64
+	for _, c := range whole + fraction {
+		d := int64(c - '0')
+		if amount > (math.MaxInt64-d)/10 {
+			return 0, fmt.Errorf("%w: %q is too large", ErrInvalidAmount, s)
+		}
+		amount = amount*10 + d
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// Format renders minor units of currency as a decimal string with exactly
+// as many fraction digits as the currency has. Unknown currencies are
+// rendered in minor units.
+func Format(amount int64, currency string) string {
+	exp, err := Exponent(currency)
+	if err != nil || exp == 0 {
+		return fmt.Sprintf("%d", amount)
+	}
+	sign := ""
+	u := uint64(amount)
+	if amount < 0 {
+		sign, u = "-", uint64(-amount)
+	}
+	s := fmt.Sprintf("%0*d", exp+1, u)
+	return sign + s[:len(s)-exp] + "." + s[len(s)-exp:]
+}
+
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
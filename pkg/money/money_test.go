@@ -0,0 +1,73 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct {
+		s, currency string
+		want        int64
+	}{
+		{"12.30", "USD", 1230},
+		{"12.3", "USD", 1230},
+		{"12", "USD", 1200},
+		{"0.01", "EUR", 1},
+		{"-5.5", "BRL", -550},
+		{"1500", "JPY", 1500},
+		{"1.234", "KWD", 1234},
+	} {
+		got, err := Parse(c.s, c.currency)
+		assert.Nil(t, err, c.s)
+		assert.Equal(t, c.want, got, c.s)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, c := range []struct {
+		s, currency string
+		want        error
+	}{
+		{"1.005", "USD", ErrInvalidAmount},
+		{"10.5", "JPY", ErrInvalidAmount},
+		{"1e3", "USD", ErrInvalidAmount},
+		{"", "USD", ErrInvalidAmount},
+		{"1.", "USD", ErrInvalidAmount},
+		{".5", "USD", ErrInvalidAmount},
+		{"+1", "USD", ErrInvalidAmount},
+		{"99999999999999999999", "USD", ErrInvalidAmount},
+		{"1", "XXX", ErrUnknownCurrency},
+	} {
+		_, err := Parse(c.s, c.currency)
+		assert.True(t, errors.Is(err, c.want), "%s %s: %v", c.s, c.currency, err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "12.30", Format(1230, "USD"))
+	assert.Equal(t, "0.01", Format(1, "EUR"))
+	assert.Equal(t, "-5.50", Format(-550, "BRL"))
+	assert.Equal(t, "1500", Format(1500, "JPY"))
+	assert.Equal(t, "1.234", Format(1234, "KWD"))
+	// 0.1 + 0.2 stays exact in minor units
+	a, _ := Parse("0.1", "USD")
+	b, _ := Parse("0.2", "USD")
+	assert.Equal(t, "0.30", Format(a+b, "USD"))
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var v struct{ Price Decimal }
+	assert.Nil(t, json.Unmarshal([]byte(`{"Price":10.50}`), &v))
+	assert.Equal(t, Decimal("10.50"), v.Price)
+	assert.Nil(t, json.Unmarshal([]byte(`{"Price":"0.30"}`), &v))
+	assert.Equal(t, Decimal("0.30"), v.Price)
+	assert.NotNil(t, json.Unmarshal([]byte(`{"Price":true}`), &v))
+
+	b, err := json.Marshal(v)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"Price":"0.30"}`, string(b))
+}
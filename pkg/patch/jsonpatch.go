@@ -0,0 +1,274 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Operation is a single RFC 6902 operation. Value is nil when the member
+// is absent, which is distinct from an explicit null.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch applies an RFC 6902 patch to doc. Operations are applied in
+// order and the whole patch fails if any of them does.
+func JSONPatch(doc, patch []byte) ([]byte, error) {
+	var target any
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	for i, op := range ops {
+		var err error
+		if target, err = op.apply(target); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func (op Operation) apply(doc any) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			return replace(doc, path, value)
+		}
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, fmt.Errorf("%w: %s", ErrTestFailed, op.Path)
+		}
+		return doc, nil
+	case "remove":
+		return remove(doc, path)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			return add(doc, path, deepCopy(value))
+		}
+		if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+			return nil, fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPatch, op.From)
+		}
+		if doc, err = remove(doc, from); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+func (op Operation) value() (any, error) {
+	if op.Value == nil {
+		return nil, fmt.Errorf("%w: %s requires a value", ErrInvalidPatch, op.Op)
+	}
+	var v any
+	if err := json.Unmarshal(op.Value, &v); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return v, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: pointer %q must start with /", ErrInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex resolves token against an array of length n. end allows the
+// index n itself, as "add" does.
+func arrayIndex(token string, n int, end bool) (int, error) {
+	if end && token == "-" {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+	if i > n || (i == n && !end) {
+		return 0, fmt.Errorf("%w: index %d", ErrPathNotFound, i)
+	}
+	return i, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch n := doc.(type) {
+		case map[string]any:
+			v, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrPathNotFound, token)
+			}
+			doc = v
+		case []any:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = n[i]
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, token)
+		}
+	}
+	return doc, nil
+}
+
+// update walks to the parent of the last token in path and replaces it
+// with the result of leaf. The root itself is replaced by root.
+func update(doc any, path []string, root func() (any, error), leaf func(parent any, key string) (any, error)) (any, error) {
+	if len(path) == 0 {
+		return root()
+	}
+	if len(path) == 1 {
+		return leaf(doc, path[0])
+	}
+	switch n := doc.(type) {
+	case map[string]any:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, path[0])
+		}
+		child, err := update(child, path[1:], root, leaf)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = child
+		return n, nil
+	case []any:
+		i, err := arrayIndex(path[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		if n[i], err = update(n[i], path[1:], root, leaf); err != nil {
+			return nil, err
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrPathNotFound, path[0])
+	}
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	return update(doc, path, func() (any, error) { return value, nil }, func(parent any, key string) (any, error) {
+		switch n := parent.(type) {
+		case map[string]any:
+			n[key] = value
+			return n, nil
+		case []any:
+			i, err := arrayIndex(key, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, key)
+		}
+	})
+}
+
+func remove(doc any, path []string) (any, error) {
+	root := func() (any, error) {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+	return update(doc, path, root, func(parent any, key string) (any, error) {
+		switch n := parent.(type) {
+		case map[string]any:
+			if _, ok := n[key]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrPathNotFound, key)
+			}
+			delete(n, key)
+			return n, nil
+		case []any:
+			i, err := arrayIndex(key, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(n[:i], n[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, key)
+		}
+	})
+}
+
+func replace(doc any, path []string, value any) (any, error) {
+	return update(doc, path, func() (any, error) { return value, nil }, func(parent any, key string) (any, error) {
+		switch n := parent.(type) {
+		case map[string]any:
+			if _, ok := n[key]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrPathNotFound, key)
+			}
+			n[key] = value
+			return n, nil
+		case []any:
+			i, err := arrayIndex(key, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			n[i] = value
+			return n, nil
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, key)
+		}
+	})
+}
+
+func deepCopy(v any) any {
+	switch n := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(n))
+		for k, v := range n {
+			c[k] = deepCopy(v)
+		}
+		return c
+	case []any:
+		c := make([]any, len(n))
+		for i, v := range n {
+			c[i] = deepCopy(v)
+		}
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,49 @@
+// Package patch applies RFC 7396 JSON Merge Patch and RFC 6902 JSON Patch
+// documents to JSON values.
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidPatch reports a malformed patch document.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrPathNotFound reports an operation whose target does not exist.
+	ErrPathNotFound = errors.New("patch path not found")
+	// ErrTestFailed reports a JSON Patch test operation that did not match.
+	ErrTestFailed = errors.New("patch test failed")
+)
+
+// MergePatch applies an RFC 7396 merge patch to doc.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p any
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = merge(t[key], value)
+		}
+	}
+	return t
+}
@@ -0,0 +1,69 @@
+package patch
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	// examples from RFC 7396 appendix A
+	for _, c := range []struct{ doc, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		got, err := MergePatch([]byte(c.doc), []byte(c.patch))
+		assert.Nil(t, err)
+		assert.JSONEq(t, c.want, string(got), c.patch)
+	}
+
+	_, err := MergePatch([]byte(`{}`), []byte(`{`))
+	assert.True(t, errors.Is(err, ErrInvalidPatch))
+}
+
+func TestJSONPatch(t *testing.T) {
+	for _, c := range []struct{ doc, patch, want string }{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"foo":"bar","baz":"qux"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":"qux"}]`, `{"foo":["bar","qux"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{`{"a/b":1,"m~n":2}`, `[{"op":"test","path":"/a~1b","value":1},{"op":"remove","path":"/m~0n"}]`, `{"a/b":1}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":null}]`, `{"foo":"bar","child":null}`},
+	} {
+		got, err := JSONPatch([]byte(c.doc), []byte(c.patch))
+		assert.Nil(t, err, c.patch)
+		assert.JSONEq(t, c.want, string(got), c.patch)
+	}
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	for patch, want := range map[string]error{
+		`{"op":"add"}`:                                   ErrInvalidPatch,
+		`[{"op":"frobnicate","path":"/a"}]`:              ErrInvalidPatch,
+		`[{"op":"add","path":"a","value":1}]`:            ErrInvalidPatch,
+		`[{"op":"add","path":"/a"}]`:                     ErrInvalidPatch,
+		`[{"op":"remove","path":"/missing"}]`:            ErrPathNotFound,
+		`[{"op":"replace","path":"/missing","value":1}]`: ErrPathNotFound,
+		`[{"op":"add","path":"/list/5","value":1}]`:      ErrPathNotFound,
+		`[{"op":"add","path":"/list/01","value":1}]`:     ErrInvalidPatch,
+		`[{"op":"test","path":"/a","value":2}]`:          ErrTestFailed,
+		`[{"op":"move","from":"/obj","path":"/obj/x"}]`:  ErrInvalidPatch,
+	} {
+		_, err := JSONPatch([]byte(`{"a":1,"list":[1],"obj":{}}`), []byte(patch))
+		assert.True(t, errors.Is(err, want), "%s: %v", patch, err)
+	}
+}
@@ -0,0 +1,127 @@
+// Package ratelimit implements token bucket rate limiting. Buckets live
+// behind the Store interface so they can move to a shared store when the
+// API runs on more than one instance.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New(`limit must look like "10/1m"`)
+
+// Limit allows Burst requests at once and refills the bucket evenly over
+// Per, so "10/1m" allows a burst of 10 and then one request every 6s. The
+// zero Limit allows everything.
+type Limit struct {
+	Burst int
+	Per   time.Duration
+}
+
+// ParseLimit reads a limit written as requests/period, such as "10/1m" or
+// "100/h". An empty string is the zero Limit.
+func ParseLimit(s string) (Limit, error) {
+	if s == "" {
+		return Limit{}, nil
+	}
+	burst, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, ErrInvalidLimit
+	}
+	n, err := strconv.Atoi(burst)
+	if err != nil || n < 0 {
+		return Limit{}, ErrInvalidLimit
+	}
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	per, err := time.ParseDuration(period)
+	if err != nil || per <= 0 {
+		return Limit{}, ErrInvalidLimit
+	}
+	return Limit{Burst: n, Per: per}, nil
+}
+
+// Disabled reports whether the limit lets every request through.
+func (l Limit) Disabled() bool {
+	return l.Burst <= 0 || l.Per <= 0
+}
+
+func (l Limit) interval() time.Duration {
+	return l.Per / time.Duration(l.Burst)
+}
+
+// Store keeps the buckets. Allow takes a token from the bucket of key and
+// reports whether there was one; when there was not, it also returns how
+// long until there is.
+type Store interface {
+	Allow(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error)
+}
+
+// sweepInterval is how often MemoryStore drops buckets that have refilled.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	per     time.Duration
+}
+
+// MemoryStore keeps buckets in process memory. Buckets that have refilled
+// are dropped as the store is used, so idle keys do not accumulate.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryStore) Allow(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	if limit.Disabled() {
+		return true, 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	interval := limit.interval()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens += float64(elapsed) / float64(interval)
+		if b.tokens > float64(limit.Burst) {
+			b.tokens = float64(limit.Burst)
+		}
+		b.updated = now
+	}
+	b.per = limit.Per
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	return false, time.Duration((1 - b.tokens) * float64(interval)), nil
+}
+
+// sweep drops buckets untouched for long enough to be full again, which
+// behave exactly like a missing bucket.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) >= b.per {
+			delete(s.buckets, key)
+		}
+	}
+}
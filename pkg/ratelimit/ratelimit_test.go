@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLimit(t *testing.T) {
+	for s, want := range map[string]Limit{
+		"":       {},
+		"10/1m":  {Burst: 10, Per: time.Minute},
+		"100/h":  {Burst: 100, Per: time.Hour},
+		"5/30s":  {Burst: 5, Per: 30 * time.Second},
+		"0/1m":   {Per: time.Minute},
+		"3/1h0m": {Burst: 3, Per: time.Hour},
+	} {
+		got, err := ParseLimit(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"10", "x/1m", "-1/1m", "10/", "10/0s", "10/fortnight"} {
+		_, err := ParseLimit(s)
+		assert.ErrorIs(t, err, ErrInvalidLimit, s)
+	}
+	assert.True(t, Limit{}.Disabled())
+	assert.True(t, Limit{Per: time.Minute}.Disabled())
+}
+
+func TestMemoryStoreAllow(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	limit := Limit{Burst: 2, Per: time.Minute}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		ok, _, err := s.Allow(ctx, "a", limit, now)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	ok, retryAfter, _ := s.Allow(ctx, "a", limit, now)
+	assert.False(t, ok)
+	assert.Equal(t, 30*time.Second, retryAfter)
+
+	// Keys have their own buckets.
+	ok, _, _ = s.Allow(ctx, "b", limit, now)
+	assert.True(t, ok)
+
+	ok, retryAfter, _ = s.Allow(ctx, "a", limit, now.Add(20*time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, 10*time.Second, retryAfter)
+	ok, _, _ = s.Allow(ctx, "a", limit, now.Add(30*time.Second))
+	assert.True(t, ok)
+
+	ok, _, _ = s.Allow(ctx, "a", Limit{}, now)
+	assert.True(t, ok)
+}
+
+func TestMemoryStoreSweepsFullBuckets(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	now := time.Now()
+	s.Allow(ctx, "short", Limit{Burst: 1, Per: time.Minute}, now)
+	s.Allow(ctx, "long", Limit{Burst: 1, Per: time.Hour}, now)
+	assert.Len(t, s.buckets, 2)
+
+	s.Allow(ctx, "other", Limit{Burst: 1, Per: time.Minute}, now.Add(2*time.Minute))
+	assert.Len(t, s.buckets, 2)
+	assert.NotContains(t, s.buckets, "short")
+	assert.Contains(t, s.buckets, "long")
+}